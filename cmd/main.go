@@ -1,13 +1,15 @@
 package main
 
 import (
-	"flag"
 	"os"
 
-	"github.com/kubesphere/s2irun/pkg/run"
+	"github.com/kubesphere/s2irun/pkg/cmd/cli"
 )
 
 func main() {
-	flag.Parse()
-	os.Exit(run.App())
+	command := cli.NewCmdCLI()
+	command.SetArgs(cli.NormalizeArgs(os.Args[1:]))
+	if err := command.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
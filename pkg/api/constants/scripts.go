@@ -48,6 +48,10 @@ const (
 	// RuntimeArtifactsDir is the location of application artifacts and scripts that will be copied into a runtime image.
 	RuntimeArtifactsDir = "upload" + string(os.PathSeparator) + "runtimeArtifacts"
 
+	// OCILayoutDir is the location of the OCI image layout the images are
+	// assembled in when no layout path is configured.
+	OCILayoutDir = "oci"
+
 	// IgnoreFile is the s2i version for ignore files like we see with .gitignore or .dockerignore .. initial impl mirrors documented .dockerignore capabilities
 	IgnoreFile = ".s2iignore"
 )
@@ -2,6 +2,7 @@ package describe
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"runtime"
@@ -13,8 +14,9 @@ import (
 	"github.com/kubesphere/s2irun/pkg/docker"
 )
 
-// Config returns the Config object in nice readable, tabbed format.
-func Config(client docker.Client, config *api.Config) string {
+// Config returns the Config object in nice readable, tabbed format. Pulling
+// the builder image to describe it is aborted when ctx is done.
+func Config(ctx context.Context, client docker.Client, config *api.Config) string {
 	out, err := tabbedString(func(out io.Writer) error {
 		if len(config.DisplayName) > 0 {
 			fmt.Fprintf(out, "Application Name:\t%s\n", config.DisplayName)
@@ -23,10 +25,12 @@ func Config(client docker.Client, config *api.Config) string {
 			fmt.Fprintf(out, "Description:\t%s\n", config.Description)
 		}
 		if len(config.AsDockerfile) == 0 {
-			describeBuilderImage(client, config, out)
+			describeBuilderImage(ctx, client, config, out)
 			describeRuntimeImage(config, out)
 		}
-		fmt.Fprintf(out, "Source:\t%s\n", config.Source)
+		if config.Source != nil {
+			fmt.Fprintf(out, "Source:\t%s\n", config.Source.StringNoCredentials())
+		}
 		if len(config.ContextDir) > 0 {
 			fmt.Fprintf(out, "Context Directory:\t%s\n", config.ContextDir)
 		}
@@ -94,7 +98,7 @@ func Config(client docker.Client, config *api.Config) string {
 	return out
 }
 
-func describeBuilderImage(client docker.Client, config *api.Config, out io.Writer) {
+func describeBuilderImage(ctx context.Context, client docker.Client, config *api.Config, out io.Writer) {
 	c := &api.Config{
 		DockerConfig:              config.DockerConfig,
 		PullAuthentication:        config.PullAuthentication,
@@ -103,8 +107,8 @@ func describeBuilderImage(client docker.Client, config *api.Config, out io.Write
 		Tag:                       config.Tag,
 		IncrementalAuthentication: config.IncrementalAuthentication,
 	}
-	dkr := docker.New(client, c.PullAuthentication, c.PushAuthentication)
-	builderImage, err := docker.GetBuilderImage(dkr, c)
+	dkr := docker.NewForConfig(client, c)
+	builderImage, err := docker.GetBuilderImage(ctx, dkr, c)
 	if err == nil {
 		build.GenerateConfigFromLabels(c, builderImage)
 		if len(c.DisplayName) > 0 {
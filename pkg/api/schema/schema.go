@@ -0,0 +1,127 @@
+// Package schema generates the JSON Schema of the build configuration.
+package schema
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+)
+
+// Draft is the JSON Schema version of the generated schemas.
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+}
+
+// enums holds the accepted values of the string types which are enumerations.
+var enums = map[reflect.Type][]string{
+	reflect.TypeOf(api.PullPolicy("")): {string(api.PullAlways), string(api.PullNever), string(api.PullIfNotPresent)},
+}
+
+// ForConfig returns the JSON Schema of api.Config.
+func ForConfig() *Schema {
+	s := Generate(reflect.TypeOf(api.Config{}))
+	s.Schema = Draft
+	s.Title = "s2irun build configuration"
+	return s
+}
+
+// Generate returns the JSON Schema of the JSON encoding of values of type t,
+// as defined by the json struct tags.
+func Generate(t reflect.Type) *Schema {
+	return generate(t, map[reflect.Type]bool{})
+}
+
+func generate(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if enum, ok := enums[t]; ok {
+		return &Schema{Type: "string", Enum: enum}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded as base64 strings.
+			return &Schema{Type: "string"}
+		}
+		return &Schema{Type: "array", Items: generate(t.Elem(), visiting)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: generate(t.Elem(), visiting)}
+	case reflect.Struct:
+		s := &Schema{Type: "object"}
+		// Recursive types are only described down to their first repetition.
+		if visiting[t] {
+			return s
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		for name, field := range Fields(t) {
+			if s.Properties == nil {
+				s.Properties = map[string]*Schema{}
+			}
+			s.Properties[name] = generate(field.Type, visiting)
+		}
+		if s.Properties != nil {
+			s.AdditionalProperties = false
+		}
+		return s
+	}
+	// Interfaces and the types which are not encoded accept any value.
+	return &Schema{}
+}
+
+// Fields returns the fields of the struct type t by the name they have in the
+// JSON encoding. The fields of embedded structs without a name are promoted.
+func Fields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" && tag == "-" {
+			continue
+		}
+		if field.Anonymous && len(name) == 0 {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for n, f := range Fields(ft) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = f
+					}
+				}
+				continue
+			}
+		}
+		if len(field.PkgPath) > 0 {
+			// Unexported field.
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
@@ -0,0 +1,62 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestForConfig(t *testing.T) {
+	s := ForConfig()
+	if s.Schema != Draft || s.Type != "object" || s.AdditionalProperties != false {
+		t.Fatalf("unexpected root schema %#v", s)
+	}
+	tests := []struct {
+		path     []string
+		expected *Schema
+	}{
+		{[]string{"tag"}, &Schema{Type: "string"}},
+		{[]string{"export"}, &Schema{Type: "boolean"}},
+		{[]string{"builderPullPolicy"}, &Schema{Type: "string", Enum: []string{"always", "never", "if-not-present"}}},
+		{[]string{"dropCapabilities"}, &Schema{Type: "array", Items: &Schema{Type: "string"}}},
+		{[]string{"labels"}, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}},
+		{[]string{"dockerConfig", "endpoint"}, &Schema{Type: "string"}},
+		{[]string{"cGroupLimits", "memoryLimitBytes"}, &Schema{Type: "integer"}},
+	}
+	for _, tc := range tests {
+		got := s
+		for _, name := range tc.path {
+			if got = got.Properties[name]; got == nil {
+				t.Fatalf("%v: missing property %q", tc.path, name)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%v: expected %#v, got %#v", tc.path, tc.expected, got)
+		}
+	}
+	env := s.Properties["environment"]
+	if env.Type != "array" || env.Items.Properties["name"] == nil || env.Items.AdditionalProperties != false {
+		t.Errorf("unexpected environment schema %#v", env)
+	}
+}
+
+func TestFields(t *testing.T) {
+	type embedded struct {
+		Promoted string `json:"promoted"`
+		Shadowed string `json:"name"`
+	}
+	type sample struct {
+		embedded
+		Name     string `json:"name,omitempty"`
+		Untagged string
+		Ignored  string `json:"-"`
+		private  string
+	}
+	fields := Fields(reflect.TypeOf(sample{}))
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	if len(fields) != 3 || fields["promoted"].Name != "Promoted" || fields["name"].Name != "Name" || fields["Untagged"].Name != "Untagged" {
+		t.Errorf("unexpected fields %v", names)
+	}
+}
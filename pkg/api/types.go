@@ -6,6 +6,7 @@ import (
 	"github.com/opencontainers/go-digest"
 	"net/url"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -113,6 +114,51 @@ type Config struct {
 	// previous image from private repositories
 	IncrementalAuthentication AuthConfig `json:"incrementalAuthentication,omitempty"`
 
+	// AdditionalTags are the other tags the image is given, and pushed to when
+	// Export is set, such as the same repository with other tags or a mirror in
+	// another registry.
+	AdditionalTags []string `json:"additionalTags,omitempty"`
+
+	// RegistryAuthentications holds the authentication information for pushing
+	// the additional tags and pulling from the registry mirrors, by registry,
+	// such as "registry.example.com:5000" or "https://index.docker.io/v1/" for
+	// Docker Hub. The tags of the registries missing from it are pushed with
+	// PushAuthentication.
+	RegistryAuthentications map[string]AuthConfig `json:"registryAuthentications,omitempty"`
+
+	// RegistryMirrors maps a registry, such as "docker.io", to the mirrors the
+	// images of that registry are pulled from, in order, before falling back to
+	// the registry itself.
+	RegistryMirrors RegistryMirrors `json:"registryMirrors,omitempty"`
+
+	// InsecureRegistries are the registries, such as "registry.local:5000",
+	// served over plain HTTP to the OCI image assembly. The registries the
+	// Docker engine pulls from insecurely are configured in the engine.
+	InsecureRegistries []string `json:"insecureRegistries,omitempty"`
+
+	// PullRetryCount is the number of times a failed pull is retried, 6 when
+	// zero and none when negative.
+	PullRetryCount int `json:"pullRetryCount,omitempty"`
+
+	// PullRetryDelaySeconds is the delay before the first retry of a failed
+	// pull, 5 seconds when zero.
+	PullRetryDelaySeconds int64 `json:"pullRetryDelaySeconds,omitempty"`
+
+	// PullRetryBackoff multiplies the delay after each retry of a failed pull,
+	// the delay is constant when zero.
+	PullRetryBackoff float64 `json:"pullRetryBackoff,omitempty"`
+
+	// PullRetriableErrors are the substrings of the errors of the pulls which
+	// are retried, in addition to the network errors retried by default.
+	PullRetriableErrors []string `json:"pullRetriableErrors,omitempty"`
+
+	// DockerConfigPaths are the Docker config files, or the directories holding
+	// them such as a mounted Kubernetes dockerconfigjson secret, the missing
+	// authentications are resolved from by registry host, along with their
+	// credential helpers. When empty, the config of the Docker CLI of the user
+	// is used.
+	DockerConfigPaths []string `json:"dockerConfigPaths,omitempty"`
+
 	// DockerNetworkMode is used to set the docker network setting to --net=container:<id>
 	// when the builder is invoked from a container.
 	DockerNetworkMode DockerNetworkMode `json:"dockerNetworkMode,omitempty"`
@@ -124,6 +170,31 @@ type Config struct {
 	// (via --recursive or submodule init)
 	IgnoreSubmodules bool `json:"ignoreSubmodules,omitempty"`
 
+	// GitCacheDir holds the bare mirrors of the git sources, shared by the
+	// builds, the sources are cloned with. The mirror of a source is updated
+	// before it is cloned, or created when it is missing.
+	GitCacheDir string `json:"gitCacheDir,omitempty"`
+
+	// CloneDepth truncates the history of the git clone of the source to this
+	// number of commits, the whole history is cloned when it is 0.
+	CloneDepth int `json:"cloneDepth,omitempty"`
+
+	// CloneSingleBranch clones the history of the branch or tag of RevisionId
+	// only, or of the default branch when RevisionId is a commit.
+	CloneSingleBranch bool `json:"cloneSingleBranch,omitempty"`
+
+	// ClonePartial clones the source without the content of the files, which
+	// is fetched when they are checked out (blob-less partial clone).
+	ClonePartial bool `json:"clonePartial,omitempty"`
+
+	// CloneSparse checks out ContextDir only, along with the files of the root
+	// directory of the source. It has no effect without ContextDir.
+	CloneSparse bool `json:"cloneSparse,omitempty"`
+
+	// DisableGitLFS leaves the files of the source stored in Git LFS as
+	// pointer files rather than pulling their content.
+	DisableGitLFS bool `json:"disableGitLFS,omitempty"`
+
 	// Source URL describing the location of sources used to build the result image.
 	Source *git.URL `json:"source,omitempty"`
 
@@ -278,8 +349,92 @@ type Config struct {
 	// The RevisionId is a branch name or a SHA-1 hash of every important thing about the commit
 	RevisionId string `json:"revisionId,omitempty"`
 
+	// GitAuthentication holds the authentication information for cloning the
+	// git source and its submodules from private repositories.
+	GitAuthentication GitAuthConfig `json:"gitAuthentication,omitempty"`
+
+	// SourceRefspec is a ref fetched from the git source and built instead of
+	// RevisionId, such as refs/pull/42/head, refs/merge-requests/42/head or a
+	// Gerrit change ref like refs/changes/34/1234/2.
+	SourceRefspec string `json:"sourceRefspec,omitempty"`
+
+	// MergeInto is the branch the commit of SourceRefspec is merged into, the
+	// merge commit being built rather than the fetched commit.
+	MergeInto string `json:"mergeInto,omitempty"`
+
 	// Output build result. If build not in k8s cluster, can not use this field.
 	OutputBuildResult bool `json:"outputBuildResult,omitempty"`
+
+	// BuildDeadlineSeconds is the number of seconds the build may run for. Once
+	// it is exceeded the build is aborted and its containers are removed.
+	// Zero means no deadline.
+	BuildDeadlineSeconds int64 `json:"buildDeadlineSeconds,omitempty"`
+
+	// BuildResultPath is the file the result of the build, including the
+	// timings of its stages and the failure reason, is written to as JSON.
+	// "-" writes it to the standard output.
+	BuildResultPath string `json:"buildResultPath,omitempty"`
+
+	// MetricsAddress is the address, such as ":9090", on which the metrics of
+	// the build are served at the /metrics path while it runs.
+	MetricsAddress string `json:"metricsAddress,omitempty"`
+
+	// MetricsGracePeriodSeconds is the number of seconds the metrics are still
+	// served on MetricsAddress once the build completed or failed, for
+	// Prometheus to scrape their final values.
+	MetricsGracePeriodSeconds int64 `json:"metricsGracePeriodSeconds,omitempty"`
+
+	// MetricsTextfilePath is the file the metrics of the build are written to
+	// once it completes, in the format of the node exporter textfile collector.
+	MetricsTextfilePath string `json:"metricsTextfilePath,omitempty"`
+
+	// TracingEndpoint is the OTLP/HTTP endpoint of the collector, such as
+	// "http://collector:4318", the spans of the build are exported to.
+	TracingEndpoint string `json:"tracingEndpoint,omitempty"`
+
+	// TracingFilePath is the file the spans of the build are written to, in
+	// the OTLP JSON encoding.
+	TracingFilePath string `json:"tracingFilePath,omitempty"`
+
+	// LogFormat is the format of the log records, "text" (the default) or
+	// "json" to write every record as a JSON line with the build stage, the
+	// container and the image it relates to.
+	LogFormat string `json:"logFormat,omitempty"`
+
+	// PullByDigest makes the pull command of the build result reference the
+	// pushed image by its digest, name@sha256:..., instead of its tag.
+	PullByDigest bool `json:"pullByDigest,omitempty"`
+
+	// OCIAssemble assembles the image from the runtime image and the runtime
+	// artifacts as OCI layers, without running a container of the runtime
+	// image nor committing one. The image is written to OCILayoutPath and
+	// pushed to Tag when Export is set.
+	OCIAssemble bool `json:"ociAssemble,omitempty"`
+
+	// OCILayoutPath is the directory of the OCI image layout the image
+	// assembled with OCIAssemble is written to.
+	OCILayoutPath string `json:"ociLayoutPath,omitempty"`
+
+	// OCIArtifactsDir is the local directory holding the output of the
+	// builder, assembled with the runtime image when generating a Dockerfile
+	// with OCIAssemble.
+	OCIArtifactsDir string `json:"ociArtifactsDir,omitempty"`
+
+	// ExportPath is the file the built image is saved to, in ExportFormat, to
+	// promote it without a registry. The image is saved by its tag, or by its
+	// ID when it has no tag.
+	ExportPath string `json:"exportPath,omitempty"`
+
+	// ExportFormat is the format of the archive written to ExportPath,
+	// docker-archive (the default) or oci-archive.
+	ExportFormat ArchiveFormat `json:"exportFormat,omitempty"`
+
+	// ExportCompress compresses the archive written to ExportPath with gzip.
+	ExportCompress bool `json:"exportCompress,omitempty"`
+
+	// ExportChecksum writes the SHA-256 checksum of the archive next to it,
+	// to ExportPath with the .sha256 extension, in the format of sha256sum.
+	ExportChecksum bool `json:"exportChecksum,omitempty"`
 }
 
 // DeepCopyInto to implement k8s api requirement
@@ -303,6 +458,36 @@ func (c *Config) DeepCopyInto(out *Config) {
 		out.SecurityOpt = make([]string, len(c.SecurityOpt))
 		copy(out.SecurityOpt, c.SecurityOpt)
 	}
+	if c.AdditionalTags != nil {
+		out.AdditionalTags = make([]string, len(c.AdditionalTags))
+		copy(out.AdditionalTags, c.AdditionalTags)
+	}
+	if c.DockerConfigPaths != nil {
+		out.DockerConfigPaths = make([]string, len(c.DockerConfigPaths))
+		copy(out.DockerConfigPaths, c.DockerConfigPaths)
+	}
+	if c.InsecureRegistries != nil {
+		out.InsecureRegistries = make([]string, len(c.InsecureRegistries))
+		copy(out.InsecureRegistries, c.InsecureRegistries)
+	}
+	if c.PullRetriableErrors != nil {
+		out.PullRetriableErrors = make([]string, len(c.PullRetriableErrors))
+		copy(out.PullRetriableErrors, c.PullRetriableErrors)
+	}
+
+	//map
+	if c.RegistryAuthentications != nil {
+		out.RegistryAuthentications = make(map[string]AuthConfig, len(c.RegistryAuthentications))
+		for k, v := range c.RegistryAuthentications {
+			out.RegistryAuthentications[k] = v
+		}
+	}
+	if c.RegistryMirrors != nil {
+		out.RegistryMirrors = make(RegistryMirrors, len(c.RegistryMirrors))
+		for k, v := range c.RegistryMirrors {
+			out.RegistryMirrors[k] = append([]string{}, v...)
+		}
+	}
 
 	//pointer
 	if c.DockerConfig != nil {
@@ -372,6 +557,10 @@ type DockerConfig struct {
 	// Endpoint is the docker network endpoint or socket
 	Endpoint string `json:"endpoint,omitempty"`
 
+	// Engine is the container engine serving Endpoint, docker by default. A
+	// podman:// endpoint selects Podman as well.
+	Engine ContainerEngine `json:"engine,omitempty"`
+
 	// CertFile is the certificate file path for a TLS connection
 	CertFile string `json:"certFile,omitempty"`
 
@@ -395,6 +584,9 @@ type AuthConfig struct {
 	Password      string `json:"password,omitempty"`
 	Email         string `json:"email,omitempty"`
 	ServerAddress string `json:"serverAddress,omitempty"`
+	// IdentityToken is used to authenticate to the registry instead of the
+	// username and password, as returned by some credential helpers.
+	IdentityToken string `json:"identityToken,omitempty"`
 }
 
 // ContainerConfig is the abstraction of the docker client provider (formerly go-dockerclient, now either
@@ -415,21 +607,21 @@ type Image struct {
 // Result structure contains information from build process.
 type Result struct {
 	// Success describes whether the build was successful.
-	Success bool
+	Success bool `json:"success"`
 
 	// Messages is a list of messages from build process.
-	Messages []string
+	Messages []string `json:"messages,omitempty"`
 
 	// WorkingDir describes temporary directory used for downloading sources, scripts and tar operations.
-	WorkingDir string
+	WorkingDir string `json:"workingDir,omitempty"`
 
 	// BuildInfo holds information about the result of a build.
-	BuildInfo BuildInfo
+	BuildInfo BuildInfo `json:"buildInfo"`
 
 	// ImageInfo describes resulting image info.
-	ResultInfo OutputResultInfo
+	ResultInfo OutputResultInfo `json:"resultInfo"`
 	// Source info.
-	SourceInfo SourceInfo
+	SourceInfo SourceInfo `json:"sourceInfo"`
 }
 
 type SourceInfo struct {
@@ -441,44 +633,88 @@ type SourceInfo struct {
 	CommitID       string `json:"commitID,omitempty"`
 	CommitterName  string `json:"committerName,omitempty"`
 	CommitterEmail string `json:"committerEmail,omitempty"`
+	// Refspec is the ref fetched to build, and ParentIDs the parents of the
+	// merge commit built when it was merged into a branch.
+	Refspec   string   `json:"refspec,omitempty"`
+	ParentIDs []string `json:"parentIDs,omitempty"`
 
 	BinaryName string `json:"binaryName,omitempty"`
 	BinarySize uint64 `json:"binarySize,omitempty"`
 }
 
 type OutputResultInfo struct {
-	ImageName     string   `json:"imageName,omitempty"`
-	ImageID       string   `json:"imageID,omitempty"`
-	ImageSize     int64    `json:"imageSize,omitempty"`
-	ImageCreated  string   `json:"imageCreated,omitempty"`
-	ImageRepoTags []string `json:"imageRepoTags,omitempty"`
-	CommandPull   string   `json:"commandPull,omitempty"`
+	ImageName        string   `json:"imageName,omitempty"`
+	ImageID          string   `json:"imageID,omitempty"`
+	ImageSize        int64    `json:"imageSize,omitempty"`
+	ImageCreated     string   `json:"imageCreated,omitempty"`
+	ImageRepoTags    []string `json:"imageRepoTags,omitempty"`
+	ImageRepoDigests []string `json:"imageRepoDigests,omitempty"`
+	// ImageDigest is the digest of the manifest stored by the registry the
+	// image was pushed to.
+	ImageDigest string `json:"imageDigest,omitempty"`
+	CommandPull string `json:"commandPull,omitempty"`
+	// Pushes holds the outcome of the push of the image to each of its tags.
+	Pushes []PushInfo `json:"pushes,omitempty"`
+	// ExportPath is the archive the image was saved to.
+	ExportPath string `json:"exportPath,omitempty"`
+	// ExportChecksum is the digest of the archive the image was saved to.
+	ExportChecksum string `json:"exportChecksum,omitempty"`
+}
+
+// PushInfo is the outcome of the push of the image to one of its tags.
+type PushInfo struct {
+	Tag     string `json:"tag"`
+	Success bool   `json:"success"`
+	// Digest is the digest of the manifest stored by the registry.
+	Digest string `json:"digest,omitempty"`
+	// Error is the error which failed the push.
+	Error string `json:"error,omitempty"`
 }
 
 // BuildInfo contains information about the build process.
 type BuildInfo struct {
 	// Stages contains details about each build stage.
-	Stages []StageInfo
+	Stages []StageInfo `json:"stages,omitempty"`
 
 	// FailureReason is a camel case reason that is used by the machine to reply
 	// back to the OpenShift builder with information why any of the steps in the
 	// build failed.
-	FailureReason FailureReason
+	FailureReason FailureReason `json:"failureReason"`
+
+	// ImageSources records where each image pulled by the build was pulled
+	// from.
+	ImageSources []ImageSourceInfo `json:"imageSources,omitempty"`
+
+	// SourceCache records whether the git source was cloned with a mirror of
+	// GitCacheDir which was already there, or which was created.
+	SourceCache *git.CacheInfo `json:"sourceCache,omitempty"`
+}
+
+// ImageSourceInfo records where an image was pulled from.
+type ImageSourceInfo struct {
+	// Image is the image pulled.
+	Image string `json:"image"`
+	// Source is the mirror the image was pulled from, or the image itself. It
+	// is empty when the pull failed.
+	Source string `json:"source,omitempty"`
+	// FailedMirrors are the mirrors which failed to serve the image before
+	// Source.
+	FailedMirrors []string `json:"failedMirrors,omitempty"`
 }
 
 // StageInfo contains details about a build stage.
 type StageInfo struct {
 	// Name is the identifier for each build stage.
-	Name StageName
+	Name StageName `json:"name"`
 
 	// StartTime identifies when this stage started.
-	StartTime time.Time
+	StartTime time.Time `json:"startTime"`
 
 	// DurationMilliseconds identifies how long this stage ran.
-	DurationMilliseconds int64
+	DurationMilliseconds int64 `json:"durationMilliseconds"`
 
 	// Steps contains details about each build step within a build stage.
-	Steps []StepInfo
+	Steps []StepInfo `json:"steps,omitempty"`
 }
 
 // StageName is the identifier for each build stage.
@@ -500,18 +736,30 @@ const (
 
 	// StageRetrieve retrieves artifacts.
 	StageRetrieve StageName = "RetrieveArtifacts"
+
+	// StageFetchSource fetches the source and applies the ignore rules to it.
+	StageFetchSource StageName = "FetchSource"
+
+	// StageInstallScripts installs the s2i scripts.
+	StageInstallScripts StageName = "InstallScripts"
+
+	// StagePushImage pushes the resulting image.
+	StagePushImage StageName = "PushImage"
+
+	// StageExportImage saves the resulting image to an archive.
+	StageExportImage StageName = "ExportImage"
 )
 
 // StepInfo contains details about a build step.
 type StepInfo struct {
 	// Name is the identifier for each build step.
-	Name StepName
+	Name StepName `json:"name"`
 
 	// StartTime identifies when this step started.
-	StartTime time.Time
+	StartTime time.Time `json:"startTime"`
 
 	// DurationMilliseconds identifies how long this step ran.
-	DurationMilliseconds int64
+	DurationMilliseconds int64 `json:"durationMilliseconds"`
 }
 
 // StepName is the identifier for each build step.
@@ -537,8 +785,35 @@ const (
 	// StepCommitContainer commits the container to the builder image.
 	StepCommitContainer StepName = "CommitContainer"
 
+	// StepAssembleOCIImage assembles the image as OCI layers without a container.
+	StepAssembleOCIImage StepName = "AssembleOCIImage"
+
 	// StepRetrievePreviousArtifacts restores archived artifacts from the previous build.
 	StepRetrievePreviousArtifacts StepName = "RetrievePreviousArtifacts"
+
+	// StepRetrieveRuntimeArtifacts copies the runtime artifacts out of the builder container.
+	StepRetrieveRuntimeArtifacts StepName = "RetrieveRuntimeArtifacts"
+
+	// StepAssembleRuntimeScripts runs the assemble-runtime script in the runtime image.
+	StepAssembleRuntimeScripts StepName = "AssembleRuntimeScripts"
+
+	// StepDownloadSource downloads the source.
+	StepDownloadSource StepName = "DownloadSource"
+
+	// StepApplyIgnoreRules removes the files matching the .s2iignore rules from the source.
+	StepApplyIgnoreRules StepName = "ApplyIgnoreRules"
+
+	// StepInstallScripts installs the s2i scripts into the working directory.
+	StepInstallScripts StepName = "InstallScripts"
+
+	// StepCreateDockerfile writes the Dockerfile of the build.
+	StepCreateDockerfile StepName = "CreateDockerfile"
+
+	// StepPushImage pushes the resulting image to its registry.
+	StepPushImage StepName = "PushImage"
+
+	// StepExportImage saves the resulting image to an archive.
+	StepExportImage StepName = "ExportImage"
 )
 
 // StepFailureReason holds the type of failure that occurred during the build
@@ -551,8 +826,8 @@ type StepFailureMessage string
 // FailureReason holds the type of failure that occurred during the build
 // process.
 type FailureReason struct {
-	Reason  StepFailureReason
-	Message StepFailureMessage
+	Reason  StepFailureReason  `json:"reason,omitempty"`
+	Message StepFailureMessage `json:"message,omitempty"`
 }
 
 // InstallResult structure describes the result of install operation
@@ -607,6 +882,80 @@ func NewDockerNetworkModeContainer(id string) DockerNetworkMode {
 	return DockerNetworkMode(DockerNetworkModeContainerPrefix + id)
 }
 
+// ContainerEngine is the container engine which runs the build containers.
+type ContainerEngine string
+
+const (
+	// DockerEngine is the Docker engine.
+	DockerEngine ContainerEngine = "docker"
+
+	// PodmanEngine is Podman, driven through its Docker compatible API.
+	PodmanEngine ContainerEngine = "podman"
+)
+
+// GitAuthConfig is the authentication to the remote of a git source.
+type GitAuthConfig struct {
+	// Username and Password are the credentials of an HTTPS remote.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Token is an access token of an HTTPS remote, sent as the password of
+	// Username, or of "oauth2" when Username is empty.
+	Token string `json:"token,omitempty"`
+	// SSHKeyPath is the private key of an SSH remote.
+	SSHKeyPath string `json:"sshKeyPath,omitempty"`
+	// KnownHostsPath is the known_hosts file the host key of an SSH remote
+	// is checked against.
+	KnownHostsPath string `json:"knownHostsPath,omitempty"`
+}
+
+// RegistryMirrors maps a registry to the mirrors its images are pulled from.
+type RegistryMirrors map[string][]string
+
+// String implements the String() function of pflags.Value interface.
+func (m *RegistryMirrors) String() string {
+	result := []string{}
+	for registry, mirrors := range *m {
+		for _, mirror := range mirrors {
+			result = append(result, registry+"="+mirror)
+		}
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
+
+// Set implements the Set() function of pflags.Value interface. The value is
+// given as "registry=mirror", the mirrors of a registry being tried in the
+// order they are set.
+func (m *RegistryMirrors) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 || len(strings.TrimSpace(parts[1])) == 0 {
+		return fmt.Errorf("invalid registry mirror format %q, must be REGISTRY=MIRROR", value)
+	}
+	if *m == nil {
+		*m = RegistryMirrors{}
+	}
+	registry := strings.TrimSpace(parts[0])
+	(*m)[registry] = append((*m)[registry], strings.TrimSpace(parts[1]))
+	return nil
+}
+
+// Type implements the Type() function of pflags.Value interface.
+func (m *RegistryMirrors) Type() string {
+	return "string"
+}
+
+// ArchiveFormat is the format of the archive an image is saved to.
+type ArchiveFormat string
+
+const (
+	// DockerArchiveFormat is the format of the archives of docker save,
+	// loaded with docker load.
+	DockerArchiveFormat ArchiveFormat = "docker-archive"
+
+	// OCIArchiveFormat is an OCI image layout archived with tar.
+	OCIArchiveFormat ArchiveFormat = "oci-archive"
+)
+
 // PullPolicy specifies a type for the method used to retrieve the Docker image
 type PullPolicy string
 
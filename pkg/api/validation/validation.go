@@ -2,11 +2,19 @@ package validation
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/distribution/reference"
 
 	"github.com/kubesphere/s2irun/pkg/api"
+	utilglog "github.com/kubesphere/s2irun/pkg/utils/glog"
 )
 
 // ValidateConfig returns a list of error from validation.
@@ -34,13 +42,300 @@ func ValidateConfig(config *api.Config) []Error {
 		}
 	}
 	if config.Tag != "" {
-		if err := validateDockerReference(config.Tag); err != nil {
+		if err := validateTag(config.Tag); err != nil {
 			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("tag", err.Error(), config.Tag))
 		}
 	}
+	if len(config.AdditionalTags) > 0 && config.Tag == "" {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReason("additionalTags", "additional tags require a tag"))
+	}
+	for i, tag := range config.AdditionalTags {
+		if err := validateTag(tag); err != nil {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue(fmt.Sprintf("additionalTags[%d]", i), err.Error(), tag))
+		}
+	}
+	if config.Incremental && len(config.RuntimeImage) > 0 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("incremental", "incremental build with runtime image isn't supported", config.Incremental))
+	}
+	allErrs = append(allErrs, validateInjections(config.Injections)...)
+	allErrs = append(allErrs, validateRuntimeArtifacts(config.RuntimeArtifacts)...)
+	allErrs = append(allErrs, validateCGroupLimits(config.CGroupLimits)...)
+	for i, capability := range config.DropCapabilities {
+		if !validateCapability(capability) {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue(fmt.Sprintf("dropCapabilities[%d]", i), "unknown Linux capability", capability))
+		}
+	}
+	for i, host := range config.AddHost {
+		if err := validateAddHost(host); err != nil {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue(fmt.Sprintf("addHost[%d]", i), err.Error(), host))
+		}
+	}
+	for i, opt := range config.SecurityOpt {
+		if err := validateSecurityOpt(opt); err != nil {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue(fmt.Sprintf("securityOpt[%d]", i), err.Error(), opt))
+		}
+	}
+	if len(config.ExcludeRegExp) > 0 {
+		if _, err := regexp.Compile(config.ExcludeRegExp); err != nil {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("excludeRegExp", err.Error(), config.ExcludeRegExp))
+		}
+	}
+	if len(config.ScriptsURL) > 0 {
+		if err := validateScriptsURL(config.ScriptsURL); err != nil {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("scriptsURL", err.Error(), config.ScriptsURL))
+		}
+	}
+	if config.BuildDeadlineSeconds < 0 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("buildDeadlineSeconds", "must not be negative", config.BuildDeadlineSeconds))
+	}
+	if config.MetricsGracePeriodSeconds < 0 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("metricsGracePeriodSeconds", "must not be negative", config.MetricsGracePeriodSeconds))
+	} else if config.MetricsGracePeriodSeconds > 0 && len(config.MetricsAddress) == 0 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReason("metricsGracePeriodSeconds", "the grace period requires the address the metrics are served on"))
+	}
+	if config.OCIAssemble {
+		if len(config.RuntimeImage) == 0 {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReason("ociAssemble", "assembling the image as OCI layers requires a runtime image"))
+		}
+		if len(config.OCILayoutPath) == 0 && !config.Export {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReason("ociAssemble", "the assembled image must be written to an OCI layout or exported"))
+		}
+		if config.Export && len(config.Tag) == 0 {
+			allErrs = append(allErrs, NewFieldRequired("tag"))
+		}
+		if len(config.AsDockerfile) > 0 && len(config.OCIArtifactsDir) == 0 {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReason("ociArtifactsDir", "the builder output is required to assemble the image when generating a Dockerfile"))
+		}
+	}
+	if len(config.OCIArtifactsDir) > 0 && (!config.OCIAssemble || len(config.AsDockerfile) == 0) {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("ociArtifactsDir", "only used with ociAssemble when generating a Dockerfile", config.OCIArtifactsDir))
+	}
+	if len(config.AsDockerfile) > 0 {
+		// The generated Dockerfile cannot start from an image archive.
+		if strings.HasPrefix(config.BuilderImage, "archive:") {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("builderImage", "an image archive cannot be used when generating a Dockerfile", config.BuilderImage))
+		}
+		if strings.HasPrefix(config.RuntimeImage, "archive:") && !config.OCIAssemble {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("runtimeImage", "an image archive can only be used with ociAssemble when generating a Dockerfile", config.RuntimeImage))
+		}
+	}
+	switch config.ExportFormat {
+	case "", api.DockerArchiveFormat, api.OCIArchiveFormat:
+	default:
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("exportFormat", "must be docker-archive or oci-archive", config.ExportFormat))
+	}
+	if len(config.ExportPath) == 0 && (len(config.ExportFormat) > 0 || config.ExportCompress || config.ExportChecksum) {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReason("exportPath", "the export options require the path of the archive"))
+	}
+	if len(config.ExportPath) > 0 && len(config.AsDockerfile) > 0 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("exportPath", "no image is built when generating a Dockerfile", config.ExportPath))
+	}
+	for registry, mirrors := range config.RegistryMirrors {
+		if len(registry) == 0 || len(mirrors) == 0 {
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("registryMirrors", "must map a registry to its mirrors", registry))
+		}
+		for _, mirror := range mirrors {
+			if len(mirror) == 0 {
+				allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("registryMirrors", "must not hold an empty mirror", registry))
+			}
+		}
+	}
+	if len(config.GitAuthentication.Token) > 0 && len(config.GitAuthentication.Password) > 0 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReason("gitAuthentication.token", "a token is given instead of a password"))
+	}
+	if len(config.GitAuthentication.Password) > 0 && len(config.GitAuthentication.Username) == 0 {
+		allErrs = append(allErrs, NewFieldRequired("gitAuthentication.username"))
+	}
+	if len(config.MergeInto) > 0 && len(config.SourceRefspec) == 0 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("mergeInto", "a branch is merged into with sourceRefspec only", config.MergeInto))
+	}
+	if config.CloneDepth < 0 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("cloneDepth", "must not be negative", config.CloneDepth))
+	}
+	if config.PullRetryDelaySeconds < 0 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("pullRetryDelaySeconds", "must not be negative", config.PullRetryDelaySeconds))
+	}
+	if config.PullRetryBackoff != 0 && config.PullRetryBackoff < 1 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("pullRetryBackoff", "must be 0 or at least 1", config.PullRetryBackoff))
+	}
+	switch config.LogFormat {
+	case "", utilglog.TextFormat, utilglog.JSONFormat:
+	default:
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("logFormat", "must be text or json", config.LogFormat))
+	}
+	return allErrs
+}
+
+// validateVolumeSpec checks the source of a volume is set and neither path
+// contains characters forbidden in file names.
+func validateVolumeSpec(field string, spec api.VolumeSpec) []Error {
+	allErrs := []Error{}
+	if len(spec.Source) == 0 {
+		allErrs = append(allErrs, NewFieldRequired(field+".source"))
+	} else if api.IsInvalidFilename(spec.Source) {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue(field+".source", "contains invalid characters", spec.Source))
+	}
+	if api.IsInvalidFilename(spec.Destination) {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue(field+".destination", "contains invalid characters", spec.Destination))
+	}
 	return allErrs
 }
 
+// validateInjections checks the volumes injected into the build container.
+func validateInjections(injections api.VolumeList) []Error {
+	allErrs := []Error{}
+	for i, spec := range injections {
+		allErrs = append(allErrs, validateVolumeSpec(fmt.Sprintf("injections[%d]", i), spec)...)
+	}
+	return allErrs
+}
+
+// validateRuntimeArtifacts checks the artifacts copied into the runtime image
+// are taken from an absolute path of the builder image and placed at a path
+// relative to the working directory of the runtime image.
+func validateRuntimeArtifacts(artifacts api.VolumeList) []Error {
+	allErrs := []Error{}
+	for i, spec := range artifacts {
+		field := fmt.Sprintf("runtimeArtifacts[%d]", i)
+		errs := validateVolumeSpec(field, spec)
+		if len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+			continue
+		}
+		switch {
+		case !path.IsAbs(filepath.ToSlash(spec.Source)):
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue(field+".source", "must be an absolute path", spec.Source))
+		case path.IsAbs(spec.Destination):
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue(field+".destination", "must be a relative path", spec.Destination))
+		case strings.HasPrefix(spec.Destination, ".."):
+			allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue(field+".destination", "cannot start with '..'", spec.Destination))
+		}
+	}
+	return allErrs
+}
+
+// validateCGroupLimits checks the resource limits are consistent. A memory
+// swap or CPU quota of -1 means unlimited.
+func validateCGroupLimits(limits *api.CGroupLimits) []Error {
+	allErrs := []Error{}
+	if limits == nil {
+		return allErrs
+	}
+	if limits.MemoryLimitBytes < 0 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("cGroupLimits.memoryLimitBytes", "must not be negative", limits.MemoryLimitBytes))
+	}
+	if limits.CPUShares < 0 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("cGroupLimits.cpuShares", "must not be negative", limits.CPUShares))
+	}
+	if limits.CPUPeriod != 0 && (limits.CPUPeriod < 1000 || limits.CPUPeriod > 1000000) {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("cGroupLimits.cpuPeriod", "must be between 1000 and 1000000 microseconds", limits.CPUPeriod))
+	}
+	if limits.CPUQuota != 0 && limits.CPUQuota != -1 && limits.CPUQuota < 1000 {
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("cGroupLimits.cpuQuota", "must be at least 1000 microseconds, or -1 for unlimited", limits.CPUQuota))
+	}
+	switch {
+	case limits.MemorySwap == 0 || limits.MemorySwap == -1:
+	case limits.MemorySwap < -1:
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("cGroupLimits.memorySwap", "must not be negative, or -1 for unlimited", limits.MemorySwap))
+	case limits.MemoryLimitBytes == 0:
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("cGroupLimits.memorySwap", "requires memoryLimitBytes to be set", limits.MemorySwap))
+	case limits.MemorySwap < limits.MemoryLimitBytes:
+		allErrs = append(allErrs, NewFieldInvalidValueWithReasonAndValue("cGroupLimits.memorySwap", "must be greater than or equal to memoryLimitBytes", limits.MemorySwap))
+	}
+	return allErrs
+}
+
+// linuxCapabilities are the names of the Linux capabilities, without their
+// CAP_ prefix.
+var linuxCapabilities = map[string]bool{
+	"AUDIT_CONTROL": true, "AUDIT_READ": true, "AUDIT_WRITE": true, "BLOCK_SUSPEND": true,
+	"BPF": true, "CHECKPOINT_RESTORE": true, "CHOWN": true, "DAC_OVERRIDE": true,
+	"DAC_READ_SEARCH": true, "FOWNER": true, "FSETID": true, "IPC_LOCK": true,
+	"IPC_OWNER": true, "KILL": true, "LEASE": true, "LINUX_IMMUTABLE": true,
+	"MAC_ADMIN": true, "MAC_OVERRIDE": true, "MKNOD": true, "NET_ADMIN": true,
+	"NET_BIND_SERVICE": true, "NET_BROADCAST": true, "NET_RAW": true, "PERFMON": true,
+	"SETFCAP": true, "SETGID": true, "SETPCAP": true, "SETUID": true,
+	"SYS_ADMIN": true, "SYS_BOOT": true, "SYS_CHROOT": true, "SYS_MODULE": true,
+	"SYS_NICE": true, "SYS_PACCT": true, "SYS_PTRACE": true, "SYS_RAWIO": true,
+	"SYS_RESOURCE": true, "SYS_TIME": true, "SYS_TTY_CONFIG": true, "SYSLOG": true,
+	"WAKE_ALARM": true,
+}
+
+// validateCapability checks the capability is a Linux capability, with or
+// without the CAP_ prefix, or ALL.
+func validateCapability(capability string) bool {
+	name := strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+	return name == "ALL" || linuxCapabilities[name]
+}
+
+// validateAddHost checks the host-to-IP mapping has the "host:ip" format
+// understood by Docker.
+func validateAddHost(host string) error {
+	parts := strings.SplitN(host, ":", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return fmt.Errorf("must be in the host:ip format")
+	}
+	if parts[1] != "host-gateway" && net.ParseIP(parts[1]) == nil {
+		return fmt.Errorf("%q is not a valid IP address", parts[1])
+	}
+	return nil
+}
+
+// validateSecurityOpt checks the security option is one of those supported
+// by Docker, in the "name=value" or legacy "name:value" format.
+func validateSecurityOpt(opt string) error {
+	if opt == "no-new-privileges" {
+		return nil
+	}
+	parts := strings.SplitN(opt, "=", 2)
+	if len(parts) != 2 {
+		parts = strings.SplitN(opt, ":", 2)
+	}
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		return fmt.Errorf("must be in the name=value format")
+	}
+	name, value := parts[0], parts[1]
+	switch name {
+	case "label":
+		if value == "disable" {
+			return nil
+		}
+		for _, prefix := range []string{"user:", "role:", "type:", "level:", "filetype:"} {
+			if strings.HasPrefix(value, prefix) {
+				return nil
+			}
+		}
+		return fmt.Errorf("label must be disable, or one of user:, role:, type:, level: or filetype: followed by a value")
+	case "apparmor", "seccomp":
+		return nil
+	case "no-new-privileges":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("no-new-privileges must be a boolean")
+		}
+		return nil
+	case "systempaths":
+		if value != "unconfined" {
+			return fmt.Errorf("systempaths must be unconfined")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown security option %q", name)
+}
+
+// validateScriptsURL checks the URL uses one of the schemes the scripts can
+// be downloaded from.
+func validateScriptsURL(scriptsURL string) error {
+	u, err := url.Parse(scriptsURL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "file", "image":
+		return nil
+	}
+	return fmt.Errorf("unsupported scheme %q, must be one of http, https, file or image", u.Scheme)
+}
+
 // validateDockerNetworkMode checks wether the network mode conforms to the docker remote API specification (v1.19)
 // Supported values are: bridge, host, container:<name|id>, and netns:/proc/<pid>/ns/net
 func validateDockerNetworkMode(mode api.DockerNetworkMode) bool {
@@ -57,11 +352,29 @@ func validateDockerNetworkMode(mode api.DockerNetworkMode) bool {
 	return false
 }
 
-func validateDockerReference(ref string) error {
+// ValidateDockerReference checks that ref is a valid image reference.
+func ValidateDockerReference(ref string) error {
 	_, err := reference.Parse(ref)
 	return err
 }
 
+// IsTagTemplate returns true if tag holds template actions, such as
+// "myrepo/app:{{.Ref}}-{{.ShortCommit}}", which are expanded once the source
+// is downloaded.
+func IsTagTemplate(tag string) bool {
+	return strings.Contains(tag, "{{")
+}
+
+// validateTag checks that tag is a valid image reference, or a valid template
+// of one. The references expanded from a template are validated later.
+func validateTag(tag string) error {
+	if IsTagTemplate(tag) {
+		_, err := template.New("tag").Parse(tag)
+		return err
+	}
+	return ValidateDockerReference(tag)
+}
+
 // NewFieldRequired returns a *ValidationError indicating "value required"
 func NewFieldRequired(field string) Error {
 	return Error{Type: ErrorTypeRequired, Field: field}
@@ -30,7 +30,7 @@ func TestValidation(t *testing.T) {
 				DockerNetworkMode: "foobar",
 				BuilderPullPolicy: api.DefaultBuilderPullPolicy,
 			},
-			[]Error{{Type: ErrorInvalidValue, Field: "dockerNetworkMode"}},
+			[]Error{{Type: ErrorInvalidValue, Field: "dockerNetworkMode", Value: api.DockerNetworkMode("foobar")}},
 		},
 		{
 			&api.Config{
@@ -90,7 +90,7 @@ func TestValidation(t *testing.T) {
 				BuilderPullPolicy: api.DefaultBuilderPullPolicy,
 				Labels:            map[string]string{"some": "thing", "": "emptykey"},
 			},
-			[]Error{{Type: ErrorInvalidValue, Field: "labels"}},
+			[]Error{{Type: ErrorInvalidValue, Field: "labels", Reason: "contains empty label"}},
 		},
 	}
 	for _, test := range testCases {
@@ -100,3 +100,284 @@ func TestValidation(t *testing.T) {
 		}
 	}
 }
+
+func TestValidationFields(t *testing.T) {
+	valid := func() *api.Config {
+		return &api.Config{
+			BuilderImage:      "openshift/builder",
+			DockerConfig:      &api.DockerConfig{Endpoint: "/var/run/docker.socket"},
+			BuilderPullPolicy: api.DefaultBuilderPullPolicy,
+		}
+	}
+	testCases := []struct {
+		name     string
+		modify   func(*api.Config)
+		expected []string
+	}{
+		{
+			name: "valid",
+			modify: func(c *api.Config) {
+				c.Injections = api.VolumeList{{Source: "/secrets", Destination: "/etc/secrets"}}
+				c.RuntimeArtifacts = api.VolumeList{{Source: "/opt/app/app.jar", Destination: "."}}
+				c.CGroupLimits = &api.CGroupLimits{MemoryLimitBytes: 1024, MemorySwap: 2048, CPUPeriod: 100000, CPUQuota: -1}
+				c.DropCapabilities = []string{"KILL", "cap_mknod", "ALL"}
+				c.AddHost = []string{"registry:10.0.0.1", "ipv6:::1", "gateway:host-gateway"}
+				c.SecurityOpt = []string{"no-new-privileges", "label=disable", "label:type:svirt_t", "seccomp=unconfined", "no-new-privileges:true"}
+				c.ExcludeRegExp = `(^|/)\.git(/|$)`
+				c.ScriptsURL = "image:///usr/libexec/s2i"
+			},
+		},
+		{
+			name: "volumes",
+			modify: func(c *api.Config) {
+				c.Injections = api.VolumeList{{Destination: "/etc/secrets"}, {Source: "/sec;rets"}}
+				c.RuntimeArtifacts = api.VolumeList{{Source: "app.jar"}, {Source: "/app.jar", Destination: "/opt"}, {Source: "/app.jar", Destination: "../opt"}}
+			},
+			expected: []string{"injections[0].source", "injections[1].source", "runtimeArtifacts[0].source", "runtimeArtifacts[1].destination", "runtimeArtifacts[2].destination"},
+		},
+		{
+			name: "cgroup limits",
+			modify: func(c *api.Config) {
+				c.CGroupLimits = &api.CGroupLimits{MemoryLimitBytes: 2048, MemorySwap: 1024, CPUShares: -1, CPUPeriod: 10, CPUQuota: 10}
+			},
+			expected: []string{"cGroupLimits.cpuShares", "cGroupLimits.cpuPeriod", "cGroupLimits.cpuQuota", "cGroupLimits.memorySwap"},
+		},
+		{
+			name: "memory swap without memory limit",
+			modify: func(c *api.Config) {
+				c.CGroupLimits = &api.CGroupLimits{MemorySwap: 1024}
+			},
+			expected: []string{"cGroupLimits.memorySwap"},
+		},
+		{
+			name: "container options",
+			modify: func(c *api.Config) {
+				c.DropCapabilities = []string{"KILL", "SYS_FOO"}
+				c.AddHost = []string{"registry", "registry:10.0.0", ":10.0.0.1"}
+				c.SecurityOpt = []string{"label=foo", "no-new-privileges=yes", "selinux=on", "apparmor"}
+			},
+			expected: []string{"dropCapabilities[1]", "addHost[0]", "addHost[1]", "addHost[2]", "securityOpt[0]", "securityOpt[1]", "securityOpt[2]", "securityOpt[3]"},
+		},
+		{
+			name: "exclude and scripts",
+			modify: func(c *api.Config) {
+				c.ExcludeRegExp = "(unclosed"
+				c.ScriptsURL = "ftp://example.com/scripts"
+			},
+			expected: []string{"excludeRegExp", "scriptsURL"},
+		},
+		{
+			name: "incremental with runtime image",
+			modify: func(c *api.Config) {
+				c.Incremental = true
+				c.RuntimeImage = "openshift/runtime"
+			},
+			expected: []string{"incremental"},
+		},
+		{
+			name: "negative build deadline",
+			modify: func(c *api.Config) {
+				c.BuildDeadlineSeconds = -1
+			},
+			expected: []string{"buildDeadlineSeconds"},
+		},
+		{
+			name: "negative metrics grace period",
+			modify: func(c *api.Config) {
+				c.MetricsAddress = ":9090"
+				c.MetricsGracePeriodSeconds = -1
+			},
+			expected: []string{"metricsGracePeriodSeconds"},
+		},
+		{
+			name: "metrics grace period without address",
+			modify: func(c *api.Config) {
+				c.MetricsGracePeriodSeconds = 30
+			},
+			expected: []string{"metricsGracePeriodSeconds"},
+		},
+		{
+			name: "additional tags",
+			modify: func(c *api.Config) {
+				c.Tag = "foo/app:v1"
+				c.AdditionalTags = []string{"foo/app:latest", "registry.example.com:5000/foo/app:v1", "foo/app:Not Valid"}
+			},
+			expected: []string{"additionalTags[2]"},
+		},
+		{
+			name: "tag templates",
+			modify: func(c *api.Config) {
+				c.Tag = "foo/app:{{.Ref}}-{{.ShortCommit}}"
+				c.AdditionalTags = []string{"foo/app:{{.Date}}", "foo/app:{{.Ref"}
+			},
+			expected: []string{"additionalTags[1]"},
+		},
+		{
+			name: "additional tags without a tag",
+			modify: func(c *api.Config) {
+				c.Tag = ""
+				c.AdditionalTags = []string{"foo/app:latest"}
+			},
+			expected: []string{"additionalTags"},
+		},
+		{
+			name: "unknown log format",
+			modify: func(c *api.Config) {
+				c.LogFormat = "xml"
+			},
+			expected: []string{"logFormat"},
+		},
+		{
+			name: "json log format",
+			modify: func(c *api.Config) {
+				c.LogFormat = "json"
+			},
+		},
+		{
+			name: "OCI assembly written to a layout",
+			modify: func(c *api.Config) {
+				c.OCIAssemble = true
+				c.RuntimeImage = "openshift/runtime"
+				c.OCILayoutPath = "/tmp/layout"
+			},
+		},
+		{
+			name: "OCI assembly without runtime image nor output",
+			modify: func(c *api.Config) {
+				c.OCIAssemble = true
+			},
+			expected: []string{"ociAssemble", "ociAssemble"},
+		},
+		{
+			name: "OCI assembly of a Dockerfile build without builder output",
+			modify: func(c *api.Config) {
+				c.OCIAssemble = true
+				c.RuntimeImage = "openshift/runtime"
+				c.Export = true
+				c.Tag = "foo/app"
+				c.AsDockerfile = "/tmp/Dockerfile"
+			},
+			expected: []string{"ociArtifactsDir"},
+		},
+		{
+			name: "builder output without OCI assembly",
+			modify: func(c *api.Config) {
+				c.OCIArtifactsDir = "/tmp/artifacts"
+			},
+			expected: []string{"ociArtifactsDir"},
+		},
+		{
+			name: "runtime image archive of a Dockerfile build",
+			modify: func(c *api.Config) {
+				c.AsDockerfile = "/tmp/Dockerfile"
+				c.BuilderImage = "archive:/tmp/builder.tar"
+				c.RuntimeImage = "archive:/tmp/runtime.tar"
+			},
+			expected: []string{"builderImage", "runtimeImage"},
+		},
+		{
+			name: "compressed OCI archive",
+			modify: func(c *api.Config) {
+				c.ExportPath = "/tmp/app.tar.gz"
+				c.ExportFormat = api.OCIArchiveFormat
+				c.ExportCompress = true
+			},
+		},
+		{
+			name: "unknown export format",
+			modify: func(c *api.Config) {
+				c.ExportPath = "/tmp/app.tar"
+				c.ExportFormat = "zip"
+			},
+			expected: []string{"exportFormat"},
+		},
+		{
+			name: "export checksum without archive",
+			modify: func(c *api.Config) {
+				c.ExportChecksum = true
+			},
+			expected: []string{"exportPath"},
+		},
+		{
+			name: "registry mirrors with retries",
+			modify: func(c *api.Config) {
+				c.RegistryMirrors = api.RegistryMirrors{"docker.io": {"mirror.example.com"}}
+				c.PullRetryDelaySeconds = 2
+				c.PullRetryBackoff = 2
+			},
+		},
+		{
+			name: "empty registry mirror",
+			modify: func(c *api.Config) {
+				c.RegistryMirrors = api.RegistryMirrors{"docker.io": {""}}
+			},
+			expected: []string{"registryMirrors"},
+		},
+		{
+			name: "invalid pull retries",
+			modify: func(c *api.Config) {
+				c.PullRetryDelaySeconds = -1
+				c.PullRetryBackoff = 0.5
+			},
+			expected: []string{"pullRetryDelaySeconds", "pullRetryBackoff"},
+		},
+		{
+			name: "shallow sparse clone",
+			modify: func(c *api.Config) {
+				c.CloneDepth = 1
+				c.CloneSingleBranch = true
+				c.ClonePartial = true
+				c.CloneSparse = true
+				c.ContextDir = "app"
+			},
+		},
+		{
+			name: "negative clone depth",
+			modify: func(c *api.Config) {
+				c.CloneDepth = -1
+			},
+			expected: []string{"cloneDepth"},
+		},
+		{
+			name: "pull request merge",
+			modify: func(c *api.Config) {
+				c.SourceRefspec = "refs/pull/42/head"
+				c.MergeInto = "main"
+			},
+		},
+		{
+			name: "merge without refspec",
+			modify: func(c *api.Config) {
+				c.MergeInto = "main"
+			},
+			expected: []string{"mergeInto"},
+		},
+		{
+			name: "git token",
+			modify: func(c *api.Config) {
+				c.GitAuthentication = api.GitAuthConfig{Token: "token"}
+			},
+		},
+		{
+			name: "git password without username",
+			modify: func(c *api.Config) {
+				c.GitAuthentication = api.GitAuthConfig{Password: "secret"}
+			},
+			expected: []string{"gitAuthentication.username"},
+		},
+	}
+	for _, test := range testCases {
+		config := valid()
+		test.modify(config)
+		fields := []string{}
+		for _, err := range ValidateConfig(config) {
+			fields = append(fields, err.Field)
+		}
+		if len(test.expected) == 0 {
+			test.expected = []string{}
+		}
+		if !reflect.DeepEqual(fields, test.expected) {
+			t.Errorf("%s: got errors for %v, expected %v", test.name, fields, test.expected)
+		}
+	}
+}
@@ -11,7 +11,8 @@ import (
 )
 
 // GenerateConfigFromLabels generates the S2I Config struct from the Docker
-// image labels.
+// image labels. The source of config is kept when the labels do not record
+// it.
 func GenerateConfigFromLabels(config *api.Config, metadata *docker.PullResult) error {
 	if config == nil {
 		return errors.New("config must be provided to GenerateConfigFromLabels")
@@ -48,7 +49,7 @@ func GenerateConfigFromLabels(config *api.Config, metadata *docker.PullResult) e
 			return fmt.Errorf("couldn't parse label %q value %s: %v", constants.BuildSourceLocationLabelLog, repo, err)
 		}
 		config.Source = source
-	} else {
+	} else if config.Source == nil {
 		return fmt.Errorf("required label %q not found in image", constants.BuildSourceLocationLabelLog)
 	}
 
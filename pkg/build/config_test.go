@@ -0,0 +1,76 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/api/constants"
+	"github.com/kubesphere/s2irun/pkg/docker"
+	"github.com/kubesphere/s2irun/pkg/scm/git"
+)
+
+func TestGenerateConfigFromLabels(t *testing.T) {
+	given, err := git.Parse("https://github.com/kubesphere/given.git", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name           string
+		labels         map[string]string
+		source         *git.URL
+		expectedSource string
+		expectError    bool
+	}{
+		{
+			name: "source from the labels",
+			labels: map[string]string{
+				constants.BuildImageLabel:          "builder/image",
+				constants.BuildSourceLocationLabel: "https://github.com/kubesphere/labeled.git",
+				constants.BuildCommitRefLabel:      "v1",
+			},
+			source:         given,
+			expectedSource: "https://github.com/kubesphere/labeled.git#v1",
+		},
+		{
+			name: "source from the config",
+			labels: map[string]string{
+				constants.BuildImageLabel:     "builder/image",
+				constants.BuildCommitRefLabel: "v1",
+			},
+			source:         given,
+			expectedSource: "https://github.com/kubesphere/given.git#v1",
+		},
+		{
+			name:        "no source",
+			labels:      map[string]string{constants.BuildImageLabel: "builder/image"},
+			expectError: true,
+		},
+		{
+			name:        "no builder image",
+			labels:      map[string]string{constants.BuildSourceLocationLabel: "https://github.com/kubesphere/labeled.git"},
+			expectError: true,
+		},
+	}
+	for _, tc := range tests {
+		config := &api.Config{}
+		if tc.source != nil {
+			source := *tc.source
+			config.Source = &source
+		}
+		image := &api.Image{Config: &api.ContainerConfig{Labels: tc.labels}}
+		err := GenerateConfigFromLabels(config, &docker.PullResult{Image: image})
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if config.BuilderImage != "builder/image" || config.Source.String() != tc.expectedSource {
+			t.Errorf("%s: unexpected builder image %q and source %q", tc.name, config.BuilderImage, config.Source.String())
+		}
+	}
+}
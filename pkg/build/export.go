@@ -0,0 +1,115 @@
+package build
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/api/constants"
+	"github.com/kubesphere/s2irun/pkg/docker"
+	"github.com/kubesphere/s2irun/pkg/oci"
+	"github.com/kubesphere/s2irun/pkg/utils/fs"
+	utilglog "github.com/kubesphere/s2irun/pkg/utils/glog"
+	utilstatus "github.com/kubesphere/s2irun/pkg/utils/status"
+)
+
+// SaveFunc writes the archive of the built image to w, in the ExportFormat of
+// the config.
+type SaveFunc func(ctx context.Context, w io.Writer) error
+
+// ExportImage saves the image built with config with save to the archive at
+// ExportPath, compressed with gzip when ExportCompress is set, and records the
+// archive, its checksum, the stage and the failure reason in result. The
+// archive is written next to its path and renamed once complete.
+func ExportImage(ctx context.Context, config *api.Config, result *api.Result, fs fs.FileSystem, save SaveFunc) error {
+	utilglog.SetStage(string(api.StageExportImage))
+	startTime := time.Now()
+	defer func() {
+		result.BuildInfo.Stages = api.RecordStageAndStepInfo(result.BuildInfo.Stages, api.StageExportImage, api.StepExportImage, startTime, time.Now())
+	}()
+
+	exportPath := config.ExportPath
+	checksum, err := writeExportArchive(ctx, config, fs, exportPath+".tmp", save)
+	if err == nil {
+		err = fs.Rename(exportPath+".tmp", exportPath)
+	}
+	if err == nil && config.ExportChecksum {
+		err = fs.WriteFile(exportPath+".sha256", []byte(fmt.Sprintf("%s  %s\n", checksum, filepath.Base(exportPath))))
+	}
+	if err != nil {
+		result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
+			utilstatus.ReasonExportImageFailed,
+			utilstatus.ReasonMessageExportImageFailed,
+		)
+		return fmt.Errorf("unable to export the image to %s: %v", exportPath, err)
+	}
+	glog.V(0).Infof("Exported image to %s, sha256 %s", exportPath, checksum)
+	result.ResultInfo.ExportPath = exportPath
+	result.ResultInfo.ExportChecksum = "sha256:" + checksum
+	return nil
+}
+
+// writeExportArchive writes the archive of the image to file and returns the
+// hex encoded SHA-256 checksum of the file.
+func writeExportArchive(ctx context.Context, config *api.Config, fs fs.FileSystem, file string, save SaveFunc) (string, error) {
+	f, err := fs.Create(file)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	var w io.Writer = io.MultiWriter(f, hash)
+	var gz *gzip.Writer
+	if config.ExportCompress {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	err = save(ctx, w)
+	if gz != nil && err == nil {
+		err = gz.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file)
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// SaveDockerImage writes the image name of the Docker engine to w in the
+// ExportFormat of config. The image is converted through an OCI layout in the
+// working directory for the oci-archive format.
+func SaveDockerImage(ctx context.Context, d docker.Docker, config *api.Config, name string, w io.Writer) error {
+	if len(name) == 0 {
+		return errors.New("the image has neither a tag nor an ID")
+	}
+	if config.ExportFormat != api.OCIArchiveFormat {
+		return d.SaveImage(ctx, name, w)
+	}
+	layout, err := oci.NewLayout(filepath.Join(config.WorkingDir, constants.OCILayoutDir))
+	if err != nil {
+		return err
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(d.SaveImage(ctx, name, writer))
+	}()
+	images, err := oci.ImportDockerArchive(layout, reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+	if len(images) != 1 {
+		return fmt.Errorf("expected the archive of %s to hold one image, got %d", name, len(images))
+	}
+	return oci.WriteOCIArchive(w, layout, images[0], config.Tag)
+}
@@ -1,6 +1,8 @@
 package build
 
 import (
+	"context"
+
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/scm/git"
 )
@@ -8,8 +10,9 @@ import (
 // Builder is the interface that provides basic methods all implementation
 // should have.
 // Build method executes the build based on Request and returns the Result.
+// The build is aborted when the context is done.
 type Builder interface {
-	Build(*api.Config) (*api.Result, error)
+	Build(context.Context, *api.Config) (*api.Result, error)
 }
 
 // Preparer provides the Prepare method for builders that need to prepare source
@@ -41,7 +44,7 @@ type ScriptsHandler interface {
 
 // Downloader provides methods for downloading the application source code
 type Downloader interface {
-	Download(*api.Config) (*git.SourceInfo, error)
+	Download(context.Context, *api.Config) (*git.SourceInfo, error)
 }
 
 // Ignorer provides ignore file processing on source tree
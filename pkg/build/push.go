@@ -0,0 +1,65 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/docker"
+	utilstatus "github.com/kubesphere/s2irun/pkg/utils/status"
+)
+
+// PushFunc pushes the built image to tag with auth, and returns the digest of
+// the pushed manifest.
+type PushFunc func(ctx context.Context, tag string, auth api.AuthConfig) (string, error)
+
+// PushTags pushes the image built with config to its tag, then to each of its
+// additional tags with the authentication of their registry, or
+// PushAuthentication when they have none. The additional tags are all pushed
+// even when some of them fail. The outcome of every push, the digest of the
+// image and the failure reason are recorded in result.
+func PushTags(ctx context.Context, config *api.Config, result *api.Result, push PushFunc) error {
+	digest, err := push(ctx, config.Tag, config.PushAuthentication)
+	recordPush(result, config.Tag, digest, err)
+	if err != nil {
+		result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
+			utilstatus.ReasonPushImageFailed,
+			utilstatus.ReasonMessagePushImageFailed,
+		)
+		return err
+	}
+	result.ResultInfo.ImageDigest = digest
+
+	failed := []string{}
+	auths := &docker.AuthConfigurations{Configs: config.RegistryAuthentications}
+	for _, tag := range config.AdditionalTags {
+		auth := docker.GetImageRegistryAuth(auths, tag)
+		if auth == (api.AuthConfig{}) {
+			auth = config.PushAuthentication
+		}
+		digest, err := push(ctx, tag, auth)
+		recordPush(result, tag, digest, err)
+		if err != nil {
+			glog.Errorf("Pushing %s failed: %v", tag, err)
+			failed = append(failed, tag)
+		}
+	}
+	if len(failed) > 0 {
+		result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
+			utilstatus.ReasonPushAdditionalTagsFailed,
+			utilstatus.ReasonMessagePushAdditionalTagsFailed,
+		)
+		return fmt.Errorf("pushed %s but failed to push %d of %d additional tags: %s", config.Tag, len(failed), len(config.AdditionalTags), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// recordPush records the outcome of the push of the image to tag in result.
+func recordPush(result *api.Result, tag, digest string, err error) {
+	push := api.PushInfo{Tag: tag, Success: err == nil, Digest: digest}
+	if err != nil {
+		push.Error = err.Error()
+	}
+	result.ResultInfo.Pushes = append(result.ResultInfo.Pushes, push)
+}
@@ -0,0 +1,33 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	utilstatus "github.com/kubesphere/s2irun/pkg/utils/status"
+)
+
+func TestPushTagsFailure(t *testing.T) {
+	config := &api.Config{Tag: "foo/app:v1", AdditionalTags: []string{"foo/app:latest"}}
+	result := &api.Result{}
+	pushed := []string{}
+	err := PushTags(context.Background(), config, result, func(ctx context.Context, tag string, auth api.AuthConfig) (string, error) {
+		pushed = append(pushed, tag)
+		return "", errors.New("denied")
+	})
+	if err == nil {
+		t.Fatalf("expected the push to fail")
+	}
+	if !reflect.DeepEqual(pushed, []string{"foo/app:v1"}) {
+		t.Errorf("expected the additional tags not to be pushed, got %v", pushed)
+	}
+	if expected := []api.PushInfo{{Tag: "foo/app:v1", Error: "denied"}}; !reflect.DeepEqual(result.ResultInfo.Pushes, expected) {
+		t.Errorf("expected pushes %+v, got %+v", expected, result.ResultInfo.Pushes)
+	}
+	if reason := result.BuildInfo.FailureReason.Reason; reason != utilstatus.ReasonPushImageFailed {
+		t.Errorf("unexpected failure reason %q", reason)
+	}
+}
@@ -0,0 +1,33 @@
+package build
+
+import (
+	dockertypes "github.com/docker/docker/api/types"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/docker"
+	"github.com/kubesphere/s2irun/pkg/outputresult"
+)
+
+// OutputResult completes result with the image built for config and with its
+// source when the result is written to BuildResultPath or added to the
+// annotations of the pod. The image is inspected as name with d, unless d is
+// nil.
+func OutputResult(config *api.Config, d docker.Docker, name string, result *api.Result) {
+	if !config.OutputBuildResult && len(config.BuildResultPath) == 0 {
+		return
+	}
+	var inspect *dockertypes.ImageInspect
+	if d != nil {
+		var err error
+		if inspect, err = d.InspectImage(name); err != nil {
+			glog.V(1).Info("Inspect image failed.")
+		}
+	}
+	glog.V(0).Info("Start output build info.")
+	outputresult.OutputResult(config, inspect, result)
+	if config.OutputBuildResult {
+		if err := outputresult.AddBuildResultToAnnotation(result); err != nil {
+			glog.V(1).Infof("Output build result failed, reason: %s.", err)
+		}
+	}
+}
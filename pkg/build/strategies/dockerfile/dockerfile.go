@@ -2,20 +2,26 @@ package dockerfile
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/api/constants"
 	"github.com/kubesphere/s2irun/pkg/build"
+	dockerpkg "github.com/kubesphere/s2irun/pkg/docker"
 	s2ierr "github.com/kubesphere/s2irun/pkg/errors"
 	"github.com/kubesphere/s2irun/pkg/ignore"
+	"github.com/kubesphere/s2irun/pkg/oci"
 	"github.com/kubesphere/s2irun/pkg/scm"
 	"github.com/kubesphere/s2irun/pkg/scm/downloaders/file"
+	gitdownloader "github.com/kubesphere/s2irun/pkg/scm/downloaders/git"
 	"github.com/kubesphere/s2irun/pkg/scm/git"
 	"github.com/kubesphere/s2irun/pkg/scripts"
 	"github.com/kubesphere/s2irun/pkg/utils"
@@ -46,6 +52,7 @@ var (
 // Building the dockerfile w/ the right context will result in
 // an application image being produced.
 type Dockerfile struct {
+	ctx              context.Context
 	fs               fs.FileSystem
 	uploadScriptsDir string
 	uploadSrcDir     string
@@ -57,7 +64,8 @@ type Dockerfile struct {
 // New creates a Dockerfile builder.
 func New(config *api.Config, fs fs.FileSystem) (*Dockerfile, error) {
 	return &Dockerfile{
-		fs: fs,
+		ctx: context.Background(),
+		fs:  fs,
 		// where we will get the assemble/run scripts from on the host machine,
 		// if any are provided.
 		uploadScriptsDir: constants.UploadScripts,
@@ -69,7 +77,13 @@ func New(config *api.Config, fs fs.FileSystem) (*Dockerfile, error) {
 
 // Build produces a Dockerfile that when run with the correct filesystem
 // context, will produce the application image.
-func (builder *Dockerfile) Build(config *api.Config) (*api.Result, error) {
+func (builder *Dockerfile) Build(ctx context.Context, config *api.Config) (*api.Result, error) {
+	builder.ctx = ctx
+	defer func() {
+		if reason, ok := utilstatus.NewContextFailureReason(ctx); ok && !builder.result.Success {
+			builder.result.BuildInfo.FailureReason = reason
+		}
+	}()
 
 	// Handle defaulting of the configuration that is unique to the dockerfile strategy
 	if strings.HasSuffix(config.AsDockerfile, string(os.PathSeparator)) {
@@ -99,11 +113,21 @@ func (builder *Dockerfile) Build(config *api.Config) (*api.Result, error) {
 		return builder.result, err
 	}
 
-	if err := builder.CreateDockerfile(config); err != nil {
+	utilglog.SetStage(string(api.StageBuild))
+	startTime := time.Now()
+	err := builder.CreateDockerfile(config)
+	builder.recordStep(api.StageBuild, api.StepCreateDockerfile, startTime)
+	if err != nil {
 		builder.setFailureReason(utilstatus.ReasonDockerfileCreateFailed, utilstatus.ReasonMessageDockerfileCreateFailed)
 		return builder.result, err
 	}
 
+	if config.OCIAssemble {
+		if err = builder.assembleOCIImage(config); err != nil {
+			return builder.result, err
+		}
+	}
+
 	builder.result.Success = true
 
 	return builder.result, nil
@@ -288,6 +312,104 @@ func (builder *Dockerfile) CreateDockerfile(config *api.Config) error {
 	return nil
 }
 
+// assembleOCIImage assembles the image from the runtime image and the builder
+// output found in config.OCIArtifactsDir as OCI layers, without a container
+// engine. The image is written to the OCI layout and pushed to its tags when
+// config.Export is set.
+func (builder *Dockerfile) assembleOCIImage(config *api.Config) error {
+	layoutPath := utils.FirstNonEmpty(config.OCILayoutPath, filepath.Join(config.WorkingDir, constants.OCILayoutDir))
+	layout, err := oci.NewLayout(layoutPath)
+	if err != nil {
+		builder.setFailureReason(utilstatus.ReasonFSOperationFailed, utilstatus.ReasonMessageFSOperationFailed)
+		return err
+	}
+
+	utilglog.SetStage(string(api.StagePullImages))
+	startTime := time.Now()
+	var base *oci.Image
+	if path, ok := dockerpkg.ArchivePath(config.RuntimeImage); ok {
+		glog.V(1).Infof("Importing runtime image archive %s into the OCI layout %s", path, layoutPath)
+		base, err = oci.ImportArchive(layout, path)
+	} else {
+		glog.V(1).Infof("Pulling runtime image %s into the OCI layout %s", config.RuntimeImage, layoutPath)
+		base, err = dockerpkg.PullOCIImage(builder.ctx, config, layout, config.RuntimeImage, config.RuntimeAuthentication)
+	}
+	builder.recordStep(api.StagePullImages, api.StepPullRuntimeImage, startTime)
+	if err != nil {
+		builder.setFailureReason(utilstatus.ReasonPullRuntimeImageFailed, utilstatus.ReasonMessagePullRuntimeImageFailed)
+		return err
+	}
+
+	workDir := base.Config.Config.WorkingDir
+	if len(workDir) == 0 {
+		workDir = "/"
+	}
+	labels := map[string]string{}
+	for _, m := range []map[string]string{base.Config.Config.Labels, utils.GenerateOutputImageLabels(builder.sourceInfo, config), config.Labels} {
+		for k, v := range m {
+			labels[k] = v
+		}
+	}
+	s2iEnv, err := scripts.GetEnvironment(filepath.Join(config.WorkingDir, constants.Source))
+	if err != nil {
+		glog.V(3).Infof("No user environment provided (%v)", err)
+	}
+	opts := oci.AssembleOptions{
+		Dir:         config.OCIArtifactsDir,
+		Destination: workDir,
+		Env:         scripts.ConvertEnvironmentList(append(s2iEnv, config.Environment...)),
+		Labels:      labels,
+		CreatedBy:   "s2irun assemble " + config.OCIArtifactsDir,
+	}
+	// The run script provided with the source is added to the image, like the
+	// artifacts, otherwise the one of the runtime image is used.
+	runScript := filepath.Join(config.WorkingDir, builder.uploadScriptsDir, constants.Run)
+	if builder.fs.Exists(runScript) {
+		destination := path.Join(workDir, "scripts", constants.Run)
+		opts.Files = map[string]string{destination: runScript}
+		opts.Cmd = []string{destination}
+	} else if scriptsURL := base.Config.Config.Labels[constants.ScriptsURLLabel]; strings.HasPrefix(scriptsURL, "image://") {
+		opts.Cmd = []string{path.Join(strings.TrimPrefix(scriptsURL, "image://"), constants.Run)}
+	} else {
+		imageScriptsDir, _ := getImageScriptsDir(config)
+		opts.Cmd = []string{path.Join(imageScriptsDir, constants.Run)}
+	}
+
+	utilglog.SetStage(string(api.StageCommit))
+	startTime = time.Now()
+	image, err := oci.Assemble(layout, base, opts)
+	if err == nil && len(config.Tag) > 0 {
+		for _, tag := range append([]string{config.Tag}, config.AdditionalTags...) {
+			if err = layout.AddManifest(image.Descriptor, tag); err != nil {
+				break
+			}
+		}
+	}
+	builder.recordStep(api.StageCommit, api.StepAssembleOCIImage, startTime)
+	if err != nil {
+		builder.setFailureReason(utilstatus.ReasonAssembleOCIImageFailed, utilstatus.ReasonMessageAssembleOCIImageFailed)
+		return err
+	}
+	glog.V(1).Infof("Assembled image %s in the OCI layout %s", image.Descriptor.Digest, layoutPath)
+	builder.result.ResultInfo.ImageID = image.Manifest.Config.Digest.String()
+
+	if config.Export {
+		return builder.pushOCIImage(config, layout, image)
+	}
+	return nil
+}
+
+// pushOCIImage pushes the assembled image to its tag, then to each of its
+// additional tags with the authentication of their registry.
+func (builder *Dockerfile) pushOCIImage(config *api.Config, layout *oci.Layout, image *oci.Image) error {
+	utilglog.SetStage(string(api.StagePushImage))
+	startTime := time.Now()
+	defer builder.recordStep(api.StagePushImage, api.StepPushImage, startTime)
+	return build.PushTags(builder.ctx, config, builder.result, func(ctx context.Context, tag string, auth api.AuthConfig) (string, error) {
+		return oci.NewRegistry(auth, config.InsecureRegistries...).Push(ctx, image, layout, tag)
+	})
+}
+
 // Prepare prepares the source code and tar for build.
 // NOTE: this func serves both the sti and onbuild strategies, as the OnBuild
 // struct Build func leverages the STI struct Prepare func directly below.
@@ -314,18 +436,27 @@ func (builder *Dockerfile) Prepare(config *api.Config) error {
 	// Default - install scripts specified by image metadata.
 	// Typically this will point to an image:// URL, and no scripts are downloaded.
 	// However, this is not guaranteed.
+	utilglog.SetStage(string(api.StageInstallScripts))
+	startTime := time.Now()
 	builder.installScripts(config.ImageScriptsURL, config)
+	builder.recordStep(api.StageInstallScripts, api.StepInstallScripts, startTime)
 
 	// Fetch sources, since their .s2i/bin might contain s2i scripts which override defaults.
 	if config.Source != nil {
-		downloader, err := scm.DownloaderForSource(builder.fs, config.Source, config.ForceCopy)
+		downloader, err := scm.DownloaderForSource(builder.fs, config.Source, config.ForceCopy, config.GitAuthentication)
 		if err != nil {
 			builder.setFailureReason(utilstatus.ReasonFetchSourceFailed, utilstatus.ReasonMessageFetchSourceFailed)
 			return err
 		}
-		if builder.sourceInfo, err = downloader.Download(config); err != nil {
+		utilglog.SetStage(string(api.StageFetchSource))
+		startTime = time.Now()
+		builder.sourceInfo, err = downloader.Download(builder.ctx, config)
+		builder.recordStep(api.StageFetchSource, api.StepDownloadSource, startTime)
+		if err != nil {
 			builder.setFailureReason(utilstatus.ReasonFetchSourceFailed, utilstatus.ReasonMessageFetchSourceFailed)
 			switch err.(type) {
+			case gitdownloader.LFSPullError:
+				builder.setFailureReason(utilstatus.ReasonFetchSourceFailed, utilstatus.ReasonMessageFetchLFSObjectsFailed)
 			case file.RecursiveCopyError:
 				return fmt.Errorf("input source directory contains the target directory for the build, check that your Dockerfile output path does not reside within your input source path: %v", err)
 			}
@@ -334,11 +465,17 @@ func (builder *Dockerfile) Prepare(config *api.Config) error {
 		if config.SourceInfo != nil {
 			builder.sourceInfo = config.SourceInfo
 		}
+		if builder.sourceInfo != nil {
+			builder.result.BuildInfo.SourceCache = builder.sourceInfo.Cache
+		}
 	}
 
 	// Install scripts provided by user, overriding all others.
 	// This _could_ be an image:// URL, which would override any scripts above.
+	utilglog.SetStage(string(api.StageInstallScripts))
+	startTime = time.Now()
 	builder.installScripts(config.ScriptsURL, config)
+	builder.recordStep(api.StageInstallScripts, api.StepInstallScripts, startTime)
 
 	// Stage any injection(secrets) content into the working dir so the dockerfile can reference it.
 	for i, injection := range config.Injections {
@@ -356,7 +493,10 @@ func (builder *Dockerfile) Prepare(config *api.Config) error {
 
 	// see if there is a .s2iignore file, and if so, read in the patterns and then
 	// search and delete on them.
+	utilglog.SetStage(string(api.StageFetchSource))
+	startTime = time.Now()
 	err = builder.ignorer.Ignore(config)
+	builder.recordStep(api.StageFetchSource, api.StepApplyIgnoreRules, startTime)
 	if err != nil {
 		builder.setFailureReason(utilstatus.ReasonGenericS2IBuildFailed, utilstatus.ReasonMessageGenericS2iBuildFailed)
 		return err
@@ -367,6 +507,7 @@ func (builder *Dockerfile) Prepare(config *api.Config) error {
 // installScripts installs scripts at the provided URL to the Dockerfile context
 func (builder *Dockerfile) installScripts(scriptsURL string, config *api.Config) []api.InstallResult {
 	scriptInstaller := scripts.NewInstaller(
+		builder.ctx,
 		"",
 		scriptsURL,
 		config.ScriptDownloadProxyConfig,
@@ -377,7 +518,7 @@ func (builder *Dockerfile) installScripts(scriptsURL string, config *api.Config)
 
 	// all scripts are optional, we trust the image contains scripts if we don't find them
 	// in the source repo.
-	return scriptInstaller.InstallOptional(append(scripts.RequiredScripts, scripts.OptionalScripts...), config.WorkingDir)
+	return scriptInstaller.InstallOptional(builder.ctx, append(scripts.RequiredScripts, scripts.OptionalScripts...), config.WorkingDir)
 }
 
 // setFailureReason sets the builder's failure reason with the given reason and message.
@@ -385,6 +526,12 @@ func (builder *Dockerfile) setFailureReason(reason api.StepFailureReason, messag
 	builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(reason, message)
 }
 
+// recordStep records the step of the given stage which started at startTime
+// and ends now.
+func (builder *Dockerfile) recordStep(stage api.StageName, step api.StepName, startTime time.Time) {
+	builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(builder.result.BuildInfo.Stages, stage, step, startTime, time.Now())
+}
+
 // getDestination returns the destination directory from the config.
 func getDestination(config *api.Config) string {
 	destination := config.Destination
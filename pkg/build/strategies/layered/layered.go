@@ -2,6 +2,7 @@ package layered
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -48,7 +49,7 @@ func New(client docker.Client, config *api.Config, fs fs.FileSystem, scripts bui
 		return nil, err
 	}
 
-	d := docker.New(client, config.PullAuthentication, config.PushAuthentication)
+	d := docker.NewForConfig(client, config)
 	tarHandler := tar.New(fs)
 	tarHandler.SetExclusionPattern(excludePattern)
 
@@ -130,8 +131,13 @@ func (builder *Layered) CreateDockerfile(config *api.Config) error {
 
 // Build handles the `docker build` equivalent execution, returning the
 // success/failure details.
-func (builder *Layered) Build(config *api.Config) (*api.Result, error) {
+func (builder *Layered) Build(ctx context.Context, config *api.Config) (*api.Result, error) {
 	buildResult := &api.Result{}
+	defer func() {
+		if reason, ok := utilstatus.NewContextFailureReason(ctx); ok && !buildResult.Success {
+			buildResult.BuildInfo.FailureReason = reason
+		}
+	}()
 
 	if config.HasOnBuild && config.BlockOnBuild {
 		buildResult.BuildInfo.FailureReason = utilstatus.NewFailureReason(
@@ -173,8 +179,9 @@ func (builder *Layered) Build(config *api.Config) (*api.Result, error) {
 	docker.StreamContainerIO(outReader, nil, func(s string) { glog.V(2).Info(s) })
 
 	glog.V(2).Infof("Building new image %s with scripts and sources already inside", newBuilderImage)
+	utilglog.SetStage(string(api.StageBuild))
 	startTime := time.Now()
-	err := builder.docker.BuildImage(opts)
+	err := builder.docker.BuildImage(ctx, opts)
 	buildResult.BuildInfo.Stages = api.RecordStageAndStepInfo(buildResult.BuildInfo.Stages, api.StageBuild, api.StepBuildDockerImage, startTime, time.Now())
 	if err != nil {
 		buildResult.BuildInfo.FailureReason = utilstatus.NewFailureReason(
@@ -195,7 +202,7 @@ func (builder *Layered) Build(config *api.Config) (*api.Result, error) {
 		builder.config.ScriptsURL = "image://" + path.Join(getDestination(config), "scripts")
 	} else {
 		var err error
-		builder.config.ScriptsURL, err = builder.docker.GetScriptsURL(newBuilderImage)
+		builder.config.ScriptsURL, err = builder.docker.GetScriptsURL(ctx, newBuilderImage)
 		if err != nil {
 			buildResult.BuildInfo.FailureReason = utilstatus.NewFailureReason(
 				utilstatus.ReasonGenericS2IBuildFailed,
@@ -206,6 +213,7 @@ func (builder *Layered) Build(config *api.Config) (*api.Result, error) {
 	}
 
 	glog.V(2).Infof("Building %s using sti-enabled image", builder.config.Tag)
+	utilglog.SetStage(string(api.StageAssemble))
 	startTime = time.Now()
 	err = builder.scripts.Execute(constants.Assemble, config.AssembleUser, builder.config)
 	buildResult.BuildInfo.Stages = api.RecordStageAndStepInfo(buildResult.BuildInfo.Stages, api.StageAssemble, api.StepAssembleBuildScripts, startTime, time.Now())
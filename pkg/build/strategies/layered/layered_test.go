@@ -1,6 +1,7 @@
 package layered
 
 import (
+	"context"
 	"errors"
 	"io/ioutil"
 	"os"
@@ -57,7 +58,7 @@ func TestBuildOK(t *testing.T) {
 	defer os.RemoveAll(workDir)
 	l := newFakeLayeredWithScripts(workDir)
 	l.config.BuilderImage = "test/image"
-	_, err = l.Build(l.config)
+	_, err = l.Build(context.Background(), l.config)
 	if err != nil {
 		t.Errorf("Unexpected error returned: %v", err)
 	}
@@ -90,7 +91,7 @@ func TestBuildOKWithImageRef(t *testing.T) {
 	defer os.RemoveAll(workDir)
 	l := newFakeLayeredWithScripts(workDir)
 	l.config.BuilderImage = "docker.io/uptoknow/ruby-20-centos7@sha256:d6f5718b85126954d98931e654483ee794ac357e0a98f4a680c1e848d78863a1"
-	_, err = l.Build(l.config)
+	_, err = l.Build(context.Background(), l.config)
 	if err != nil {
 		t.Errorf("Unexpected error returned: %v", err)
 	}
@@ -101,7 +102,7 @@ func TestBuildOKWithImageRef(t *testing.T) {
 		t.Errorf("Expected BuilderImage to start with s2i-layered-temp-image-, but got %s", l.config.BuilderImage)
 	}
 	l.config.BuilderImage = "uptoknow/ruby-20-centos7@sha256:d6f5718b85126954d98931e654483ee794ac357e0a98f4a680c1e848d78863a1"
-	_, err = l.Build(l.config)
+	_, err = l.Build(context.Background(), l.config)
 	if err != nil {
 		t.Errorf("Unexpected error returned: %v", err)
 	}
@@ -112,7 +113,7 @@ func TestBuildOKWithImageRef(t *testing.T) {
 		t.Errorf("Expected BuilderImage to start with s2i-layered-temp-image-, but got %s", l.config.BuilderImage)
 	}
 	l.config.BuilderImage = "ruby-20-centos7@sha256:d6f5718b85126954d98931e654483ee794ac357e0a98f4a680c1e848d78863a1"
-	_, err = l.Build(l.config)
+	_, err = l.Build(context.Background(), l.config)
 	if err != nil {
 		t.Errorf("Unexpected error returned: %v", err)
 	}
@@ -127,7 +128,7 @@ func TestBuildOKWithImageRef(t *testing.T) {
 func TestBuildNoScriptsProvided(t *testing.T) {
 	l := newFakeLayered()
 	l.config.BuilderImage = "test/image"
-	_, err := l.Build(l.config)
+	_, err := l.Build(context.Background(), l.config)
 	if err != nil {
 		t.Errorf("Unexpected error returned: %v", err)
 	}
@@ -146,7 +147,7 @@ func TestBuildErrorWriteDockerfile(t *testing.T) {
 	l := newFakeLayered()
 	l.config.BuilderImage = "test/image"
 	l.fs.(*testfs.FakeFileSystem).WriteFileError = errors.New("WriteDockerfileError")
-	_, err := l.Build(l.config)
+	_, err := l.Build(context.Background(), l.config)
 	if err == nil || err.Error() != "WriteDockerfileError" {
 		t.Errorf("An error was expected for WriteDockerfile, but got different: %v", err)
 	}
@@ -156,7 +157,7 @@ func TestBuildErrorCreateTarFile(t *testing.T) {
 	l := newFakeLayered()
 	l.config.BuilderImage = "test/image"
 	l.tar.(*test.FakeTar).CreateTarError = errors.New("CreateTarError")
-	_, err := l.Build(l.config)
+	_, err := l.Build(context.Background(), l.config)
 	if err == nil || err.Error() != "CreateTarError" {
 		t.Errorf("An error was expected for CreateTar, but got different: %v", err)
 	}
@@ -166,7 +167,7 @@ func TestBuildErrorBuildImage(t *testing.T) {
 	l := newFakeLayered()
 	l.config.BuilderImage = "test/image"
 	l.docker.(*docker.FakeDocker).BuildImageError = errors.New("BuildImageError")
-	_, err := l.Build(l.config)
+	_, err := l.Build(context.Background(), l.config)
 	if err == nil || err.Error() != "BuildImageError" {
 		t.Errorf("An error was expected for BuildImage, but got different: %v", err)
 	}
@@ -174,7 +175,7 @@ func TestBuildErrorBuildImage(t *testing.T) {
 
 func TestBuildErrorBadImageName(t *testing.T) {
 	l := newFakeLayered()
-	_, err := l.Build(l.config)
+	_, err := l.Build(context.Background(), l.config)
 	if err == nil || !strings.Contains(err.Error(), "builder image name cannot be empty") {
 		t.Errorf("A builder image name cannot be empty error was expected, but got different: %v", err)
 	}
@@ -184,7 +185,7 @@ func TestBuildErrorOnBuildBlocked(t *testing.T) {
 	l := newFakeLayered()
 	l.config.BlockOnBuild = true
 	l.config.HasOnBuild = true
-	_, err := l.Build(l.config)
+	_, err := l.Build(context.Background(), l.config)
 	if err == nil || !strings.Contains(err.Error(), "builder image uses ONBUILD instructions but ONBUILD is not allowed") {
 		t.Errorf("expected error from onbuild due to blocked ONBUILD, got: %v", err)
 	}
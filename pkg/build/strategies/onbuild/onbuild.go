@@ -2,10 +2,12 @@ package onbuild
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/api/constants"
@@ -17,8 +19,10 @@ import (
 	"github.com/kubesphere/s2irun/pkg/scm/git"
 	"github.com/kubesphere/s2irun/pkg/scripts"
 	"github.com/kubesphere/s2irun/pkg/tar"
+	"github.com/kubesphere/s2irun/pkg/utils"
 	"github.com/kubesphere/s2irun/pkg/utils/cmd"
 	"github.com/kubesphere/s2irun/pkg/utils/fs"
+	utilglog "github.com/kubesphere/s2irun/pkg/utils/glog"
 	utilstatus "github.com/kubesphere/s2irun/pkg/utils/status"
 )
 
@@ -31,6 +35,9 @@ type OnBuild struct {
 	tar     tar.Tar
 	source  build.SourceHandler
 	garbage build.Cleaner
+	// stiBuilder prepares the sources on behalf of source, it is given the
+	// context of the build.
+	stiBuilder *sti.STI
 }
 
 type onBuildSourceHandler struct {
@@ -40,8 +47,8 @@ type onBuildSourceHandler struct {
 }
 
 // New returns a new instance of OnBuild builder
-func New(client docker.Client, config *api.Config, fs fs.FileSystem, overrides build.Overrides) (*OnBuild, error) {
-	dockerHandler := docker.New(client, config.PullAuthentication, config.PushAuthentication)
+func New(ctx context.Context, client docker.Client, config *api.Config, fs fs.FileSystem, overrides build.Overrides) (*OnBuild, error) {
+	dockerHandler := docker.NewForConfig(client, config)
 	builder := &OnBuild{
 		docker: dockerHandler,
 		git:    git.New(fs, cmd.NewCommandRunner()),
@@ -49,15 +56,16 @@ func New(client docker.Client, config *api.Config, fs fs.FileSystem, overrides b
 		tar:    tar.New(fs),
 	}
 	// Use STI Prepare() and download the 'run' script optionally.
-	s, err := sti.New(client, config, fs, overrides)
+	s, err := sti.New(ctx, client, config, fs, overrides)
 	if err != nil {
 		return nil, err
 	}
 	s.SetScripts([]string{}, []string{constants.Assemble, constants.Run})
+	builder.stiBuilder = s
 
 	downloader := overrides.Downloader
 	if downloader == nil {
-		downloader, err = scm.DownloaderForSource(builder.fs, config.Source, config.ForceCopy)
+		downloader, err = scm.DownloaderForSource(builder.fs, config.Source, config.ForceCopy, config.GitAuthentication)
 		if err != nil {
 			return nil, err
 		}
@@ -74,8 +82,16 @@ func New(client docker.Client, config *api.Config, fs fs.FileSystem, overrides b
 }
 
 // Build executes the ONBUILD kind of build
-func (builder *OnBuild) Build(config *api.Config) (*api.Result, error) {
+func (builder *OnBuild) Build(ctx context.Context, config *api.Config) (*api.Result, error) {
 	buildResult := &api.Result{}
+	defer func() {
+		if reason, ok := utilstatus.NewContextFailureReason(ctx); ok && !buildResult.Success {
+			buildResult.BuildInfo.FailureReason = reason
+		}
+	}()
+	if builder.stiBuilder != nil {
+		builder.stiBuilder.SetContext(ctx)
+	}
 
 	if config.BlockOnBuild {
 		buildResult.BuildInfo.FailureReason = utilstatus.NewFailureReason(
@@ -87,7 +103,11 @@ func (builder *OnBuild) Build(config *api.Config) (*api.Result, error) {
 	glog.V(2).Info("Preparing the source code for build")
 	// Change the installation directory for this config to store scripts inside
 	// the application root directory.
-	if err := builder.source.Prepare(config); err != nil {
+	err := builder.source.Prepare(config)
+	if builder.stiBuilder != nil {
+		buildResult.BuildInfo = builder.stiBuilder.BuildInfo()
+	}
+	if err != nil {
 		return buildResult, err
 	}
 
@@ -118,7 +138,11 @@ func (builder *OnBuild) Build(config *api.Config) (*api.Result, error) {
 	}
 
 	glog.V(2).Info("Building the application source")
-	if err := builder.docker.BuildImage(opts); err != nil {
+	utilglog.SetStage(string(api.StageBuild))
+	startTime := time.Now()
+	err = builder.docker.BuildImage(ctx, opts)
+	buildResult.BuildInfo.Stages = api.RecordStageAndStepInfo(buildResult.BuildInfo.Stages, api.StageBuild, api.StepBuildDockerImage, startTime, time.Now())
+	if err != nil {
 		buildResult.BuildInfo.FailureReason = utilstatus.NewFailureReason(
 			utilstatus.ReasonDockerImageBuildFailed,
 			utilstatus.ReasonMessageDockerImageBuildFailed,
@@ -130,7 +154,6 @@ func (builder *OnBuild) Build(config *api.Config) (*api.Result, error) {
 	builder.garbage.Cleanup(config)
 
 	var imageID string
-	var err error
 	if len(opts.Name) > 0 {
 		if imageID, err = builder.docker.GetImageID(opts.Name); err != nil {
 			buildResult.BuildInfo.FailureReason = utilstatus.NewFailureReason(
@@ -141,11 +164,21 @@ func (builder *OnBuild) Build(config *api.Config) (*api.Result, error) {
 		}
 	}
 
-	return &api.Result{
-		Success:    true,
-		WorkingDir: config.WorkingDir,
-		ResultInfo: api.OutputResultInfo{ImageID: imageID},
-	}, nil
+	buildResult.WorkingDir = config.WorkingDir
+	buildResult.ResultInfo = api.OutputResultInfo{ImageID: imageID}
+	if len(config.ExportPath) > 0 {
+		name := utils.FirstNonEmpty(config.Tag, imageID)
+		err = build.ExportImage(ctx, config, buildResult, builder.fs, func(ctx context.Context, w io.Writer) error {
+			return build.SaveDockerImage(ctx, builder.docker, config, name, w)
+		})
+		if err != nil {
+			return buildResult, err
+		}
+	}
+
+	buildResult.Success = true
+	build.OutputResult(config, builder.docker, utils.FirstNonEmpty(config.Tag, imageID), buildResult)
+	return buildResult, nil
 }
 
 // CreateDockerfile creates the ONBUILD Dockerfile
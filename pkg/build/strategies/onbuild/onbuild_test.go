@@ -2,11 +2,13 @@ package onbuild
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	dockertypes "github.com/docker/docker/api/types"
 	"github.com/docker/docker/builder/dockerfile/parser"
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/docker"
@@ -26,7 +28,7 @@ func (*fakeSourceHandler) Ignore(r *api.Config) error {
 	return nil
 }
 
-func (*fakeSourceHandler) Download(r *api.Config) (*git.SourceInfo, error) {
+func (*fakeSourceHandler) Download(ctx context.Context, r *api.Config) (*git.SourceInfo, error) {
 	return &git.SourceInfo{}, nil
 }
 
@@ -125,7 +127,7 @@ func TestBuild(t *testing.T) {
 		},
 	}
 	b.fs = fakeFs
-	result, err := b.Build(fakeRequest)
+	result, err := b.Build(context.Background(), fakeRequest)
 	if err != nil {
 		t.Errorf("%v", err)
 	}
@@ -151,8 +153,68 @@ func TestBuildOnBuildBlocked(t *testing.T) {
 		},
 	}
 	b.fs = fakeFs
-	_, err := b.Build(fakeRequest)
+	_, err := b.Build(context.Background(), fakeRequest)
 	if err == nil || !strings.Contains(err.Error(), "builder image uses ONBUILD instructions but ONBUILD is not allowed") {
 		t.Errorf("expected error from onbuild due to blocked ONBUILD, got: %v", err)
 	}
 }
+
+func TestBuildExport(t *testing.T) {
+	fakeRequest := &api.Config{
+		BuilderImage: "fake:onbuild",
+		Tag:          "fakeapp",
+		ExportPath:   "fakeapp.tar",
+	}
+	b := newFakeOnBuild()
+	fakeDocker := &docker.FakeDocker{SaveImageContent: []byte("archive")}
+	b.docker = fakeDocker
+	fakeFs := &testfs.FakeFileSystem{
+		Files: []os.FileInfo{
+			&fs.FileInfo{FileName: "run", FileMode: 0777},
+		},
+	}
+	b.fs = fakeFs
+	result, err := b.Build(context.Background(), fakeRequest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Success || result.ResultInfo.ExportPath != "fakeapp.tar" || len(result.ResultInfo.ExportChecksum) == 0 {
+		t.Errorf("expected the image exported, got %+v", result.ResultInfo)
+	}
+	if fakeDocker.SaveImageName != "fakeapp" || fakeFs.CreateContent.String() != "archive" {
+		t.Errorf("expected the image saved by its tag, got %q with %q", fakeDocker.SaveImageName, fakeFs.CreateContent.String())
+	}
+	if fakeFs.RenameFrom != "fakeapp.tar.tmp" || fakeFs.RenameTo != "fakeapp.tar" {
+		t.Errorf("expected the archive renamed once complete, got %q to %q", fakeFs.RenameFrom, fakeFs.RenameTo)
+	}
+}
+
+func TestBuildResult(t *testing.T) {
+	fakeRequest := &api.Config{
+		BuilderImage:    "fake:onbuild",
+		Tag:             "fakeapp",
+		BuildResultPath: "result.json",
+		SourceInfo:      &git.SourceInfo{CommitID: "1bf4f04"},
+	}
+	b := newFakeOnBuild()
+	b.docker = &docker.FakeDocker{
+		GetImageIDResult: "sha256:1234",
+		GetInspectImage:  &dockertypes.ImageInspect{ID: "sha256:1234", RepoTags: []string{"fakeapp:latest"}, Size: 42},
+	}
+	b.fs = &testfs.FakeFileSystem{
+		Files: []os.FileInfo{
+			&fs.FileInfo{FileName: "run", FileMode: 0777},
+		},
+	}
+	result, err := b.Build(context.Background(), fakeRequest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info := result.ResultInfo
+	if info.ImageID != "sha256:1234" || info.ImageName != "fakeapp" || len(info.ImageRepoTags) != 1 || info.ImageSize != 42 {
+		t.Errorf("expected the result to describe the built image, got %+v", info)
+	}
+	if result.SourceInfo.CommitID != "1bf4f04" {
+		t.Errorf("expected the result to describe the source, got %+v", result.SourceInfo)
+	}
+}
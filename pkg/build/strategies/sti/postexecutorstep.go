@@ -2,6 +2,7 @@ package sti
 
 import (
 	"archive/tar"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,9 +17,11 @@ import (
 	"github.com/kubesphere/s2irun/pkg/api/constants"
 	dockerpkg "github.com/kubesphere/s2irun/pkg/docker"
 	s2ierr "github.com/kubesphere/s2irun/pkg/errors"
+	"github.com/kubesphere/s2irun/pkg/oci"
 	s2itar "github.com/kubesphere/s2irun/pkg/tar"
 	"github.com/kubesphere/s2irun/pkg/utils"
 	"github.com/kubesphere/s2irun/pkg/utils/fs"
+	utilglog "github.com/kubesphere/s2irun/pkg/utils/glog"
 	utilstatus "github.com/kubesphere/s2irun/pkg/utils/status"
 )
 
@@ -144,8 +147,10 @@ func (step *commitImageStep) execute(ctx *postExecutorStepContext) error {
 	if entrypoint == nil {
 		entrypoint = []string{}
 	}
+	utilglog.SetStage(string(api.StageCommit))
 	startTime := time.Now()
 	ctx.imageID, err = commitContainer(
+		step.builder.ctx,
 		step.docker,
 		ctx.containerID,
 		cmd,
@@ -186,6 +191,12 @@ func (step *downloadFilesFromBuilderImageStep) execute(ctx *postExecutorStepCont
 		return fmt.Errorf("could not create directory %q: %v", artifactsDir, err)
 	}
 
+	utilglog.SetStage(string(api.StageRetrieve))
+	startTime := time.Now()
+	defer func() {
+		step.builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(step.builder.result.BuildInfo.Stages, api.StageRetrieve, api.StepRetrieveRuntimeArtifacts, startTime, time.Now())
+	}()
+
 	for _, artifact := range step.builder.config.RuntimeArtifacts {
 		if err := step.downloadAndExtractFile(artifact.Source, artifactsDir, ctx.containerID); err != nil {
 			step.builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
@@ -226,7 +237,7 @@ func (step *downloadFilesFromBuilderImageStep) execute(ctx *postExecutorStepCont
 }
 
 func (step *downloadFilesFromBuilderImageStep) downloadAndExtractFile(artifactPath, artifactsDir, containerID string) error {
-	if res, err := downloadAndExtractFileFromContainer(step.docker, step.tar, artifactPath, artifactsDir, containerID); err != nil {
+	if res, err := downloadAndExtractFileFromContainer(step.builder.ctx, step.docker, step.tar, artifactPath, artifactsDir, containerID); err != nil {
 		step.builder.result.BuildInfo.FailureReason = res
 		return err
 	}
@@ -267,7 +278,7 @@ func (step *startRuntimeImageAndUploadFilesStep) execute(ctx *postExecutorStepCo
 	for _, script := range []string{constants.AssembleRuntime, constants.Run} {
 		// scripts must be inside of "scripts" subdir, see createCommandForExecutingRunScript()
 		destinationDir := filepath.Join(artifactsDir, "scripts")
-		err = step.copyScriptIfNeeded(script, destinationDir)
+		err = copyScriptIfNeeded(step.builder, step.fs, script, destinationDir)
 		if err != nil {
 			step.builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
 				utilstatus.ReasonGenericS2IBuildFailed,
@@ -292,7 +303,7 @@ func (step *startRuntimeImageAndUploadFilesStep) execute(ctx *postExecutorStepCo
 	if !useExternalAssembleScript {
 		// script already inside of the image
 		var scriptsURL string
-		scriptsURL, err = step.docker.GetScriptsURL(image)
+		scriptsURL, err = step.docker.GetScriptsURL(step.builder.ctx, image)
 		if err != nil {
 			step.builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
 				utilstatus.ReasonGenericS2IBuildFailed,
@@ -336,13 +347,13 @@ func (step *startRuntimeImageAndUploadFilesStep) execute(ctx *postExecutorStepCo
 		}
 
 		glog.V(5).Infof("Uploading directory %q -> %q", artifactsDir, workDir)
-		onStartErr := step.docker.UploadToContainerWithTarWriter(step.fs, artifactsDir, workDir, containerID, setStandardPerms)
+		onStartErr := step.docker.UploadToContainerWithTarWriter(step.builder.ctx, step.fs, artifactsDir, workDir, containerID, setStandardPerms)
 		if onStartErr != nil {
 			return fmt.Errorf("could not upload directory (%q -> %q) into container %s: %v", artifactsDir, workDir, containerID, err)
 		}
 
 		glog.V(5).Infof("Uploading file %q -> %q", lastFilePath, lastFileDstPath)
-		onStartErr = step.docker.UploadToContainerWithTarWriter(step.fs, lastFilePath, lastFileDstPath, containerID, setStandardPerms)
+		onStartErr = step.docker.UploadToContainerWithTarWriter(step.builder.ctx, step.fs, lastFilePath, lastFileDstPath, containerID, setStandardPerms)
 		if onStartErr != nil {
 			return fmt.Errorf("could not upload file (%q -> %q) into container %s: %v", lastFilePath, lastFileDstPath, containerID, err)
 		}
@@ -358,7 +369,10 @@ func (step *startRuntimeImageAndUploadFilesStep) execute(ctx *postExecutorStepCo
 	// switch to the next stage of post executors steps
 	step.builder.postExecutorStage++
 
-	err = step.docker.RunContainer(opts)
+	utilglog.SetStage(string(api.StageAssemble))
+	startTime := time.Now()
+	err = step.docker.RunContainer(step.builder.ctx, opts)
+	step.builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(step.builder.result.BuildInfo.Stages, api.StageAssemble, api.StepAssembleRuntimeScripts, startTime, time.Now())
 	if e, ok := err.(s2ierr.ContainerError); ok {
 		// Must wait for StreamContainerIO goroutine above to exit before reading errOutput.
 		<-c
@@ -368,16 +382,111 @@ func (step *startRuntimeImageAndUploadFilesStep) execute(ctx *postExecutorStepCo
 	return err
 }
 
-func (step *startRuntimeImageAndUploadFilesStep) copyScriptIfNeeded(script, destinationDir string) error {
-	useExternalScript := step.builder.externalScripts[script]
+// assembleOCIImageStep assembles the image from the runtime image and the
+// runtime artifacts as OCI layers, in place of starting the runtime image and
+// committing its container. The assemble-runtime script cannot be run this
+// way.
+type assembleOCIImageStep struct {
+	builder *STI
+	docker  dockerpkg.Docker
+	fs      fs.FileSystem
+	tar     s2itar.Tar
+}
+
+func (step *assembleOCIImageStep) execute(ctx *postExecutorStepContext) error {
+	glog.V(3).Info("Executing step: assemble OCI image")
+
+	builder := step.builder
+	// The scripts of the runtime image are not installed, the script provided
+	// with the source or the scripts would be ignored.
+	if script, ok := providedScript(builder, step.fs, constants.AssembleRuntime); ok {
+		builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
+			utilstatus.ReasonAssembleOCIImageFailed,
+			utilstatus.ReasonMessageAssembleOCIImageFailed,
+		)
+		return fmt.Errorf("the %s script %s cannot be run when assembling the image as OCI layers", constants.AssembleRuntime, script)
+	}
+
+	artifactsDir := filepath.Join(builder.config.WorkingDir, constants.RuntimeArtifactsDir)
+	if err := copyScriptIfNeeded(builder, step.fs, constants.Run, filepath.Join(artifactsDir, "scripts")); err != nil {
+		builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
+			utilstatus.ReasonGenericS2IBuildFailed,
+			utilstatus.ReasonMessageGenericS2iBuildFailed,
+		)
+		return err
+	}
+
+	// The labels written by the assemble script are read from the builder
+	// container, which is still there.
+	if err := checkAndGetNewLabels(builder, step.docker, step.tar, ctx.containerID); err != nil {
+		return fmt.Errorf("could not check for new labels for %q image: %v", builder.config.RuntimeImage, err)
+	}
+	base := builder.ociBase
+	ctx.labels = mergeLabels(base.Config.Config.Labels, utils.GenerateOutputImageLabels(builder.sourceInfo, builder.config), builder.config.Labels, builder.newLabels)
+	if err := checkLabelSize(ctx.labels); err != nil {
+		return fmt.Errorf("label validation failed for %q image: %v", builder.config.RuntimeImage, err)
+	}
+
+	workDir := base.Config.Config.WorkingDir
+	if len(workDir) == 0 {
+		workDir = "/"
+	}
+	utilglog.SetStage(string(api.StageCommit))
+	startTime := time.Now()
+	image, err := oci.Assemble(builder.ociLayout, base, oci.AssembleOptions{
+		Dir:         artifactsDir,
+		Destination: workDir,
+		Cmd:         []string{createCommandForExecutingRunScript(builder.scriptsURL, workDir)},
+		Env:         builder.env,
+		Labels:      ctx.labels,
+		CreatedBy:   "s2irun assemble " + builder.config.BuilderImage,
+	})
+	if err == nil && len(builder.config.Tag) > 0 {
+		for _, tag := range append([]string{builder.config.Tag}, builder.config.AdditionalTags...) {
+			if err = builder.ociLayout.AddManifest(image.Descriptor, tag); err != nil {
+				break
+			}
+		}
+	}
+	builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(builder.result.BuildInfo.Stages, api.StageCommit, api.StepAssembleOCIImage, startTime, time.Now())
+	if err != nil {
+		builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
+			utilstatus.ReasonAssembleOCIImageFailed,
+			utilstatus.ReasonMessageAssembleOCIImageFailed,
+		)
+		return err
+	}
+	glog.V(1).Infof("Assembled image %s in the OCI layout %s", image.Descriptor.Digest, builder.ociLayout.Path)
+
+	builder.ociImage = image
+	ctx.imageID = image.Manifest.Config.Digest.String()
+	return nil
+}
+
+// providedScript returns the path of the script when it was provided with the
+// source or the scripts, whether or not it was installed.
+func providedScript(builder *STI, fs fs.FileSystem, script string) (string, bool) {
+	for _, dir := range []string{constants.UploadScripts, constants.SourceScripts} {
+		path := filepath.Join(builder.config.WorkingDir, dir, script)
+		if fs.Exists(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// copyScriptIfNeeded copies the script to destinationDir when it was provided
+// outside of the image.
+func copyScriptIfNeeded(builder *STI, fs fs.FileSystem, script, destinationDir string) error {
+	useExternalScript := builder.externalScripts[script]
 	if useExternalScript {
-		src := filepath.Join(step.builder.config.WorkingDir, constants.UploadScripts, script)
+		src := filepath.Join(builder.config.WorkingDir, constants.UploadScripts, script)
 		dst := filepath.Join(destinationDir, script)
 		glog.V(5).Infof("Copying file %q -> %q", src, dst)
-		if err := step.fs.MkdirAll(destinationDir); err != nil {
+		if err := fs.MkdirAll(destinationDir); err != nil {
 			return fmt.Errorf("could not create directory %q: %v", destinationDir, err)
 		}
-		if err := step.fs.Copy(src, dst); err != nil {
+		if err := fs.Copy(src, dst); err != nil {
 			return fmt.Errorf("could not copy file (%q -> %q): %v", src, dst, err)
 		}
 	}
@@ -400,7 +509,7 @@ func (step *reportSuccessStep) execute(ctx *postExecutorStepContext) error {
 
 // shared methods
 
-func commitContainer(docker dockerpkg.Docker, containerID, cmd, user, tag string, env, entrypoint []string, labels map[string]string) (string, error) {
+func commitContainer(ctx context.Context, docker dockerpkg.Docker, containerID, cmd, user, tag string, env, entrypoint []string, labels map[string]string) (string, error) {
 	opts := dockerpkg.CommitContainerOptions{
 		Command:     []string{cmd},
 		Env:         env,
@@ -411,7 +520,7 @@ func commitContainer(docker dockerpkg.Docker, containerID, cmd, user, tag string
 		Labels:      labels,
 	}
 
-	imageID, err := docker.CommitContainer(opts)
+	imageID, err := docker.CommitContainer(ctx, opts)
 	if err != nil {
 		return "", s2ierr.NewCommitError(tag, err)
 	}
@@ -459,7 +568,7 @@ func createCommandForExecutingRunScript(scriptsURL map[string]string, location s
 	return cmd
 }
 
-func downloadAndExtractFileFromContainer(docker dockerpkg.Docker, tar s2itar.Tar, sourcePath, destinationPath, containerID string) (api.FailureReason, error) {
+func downloadAndExtractFileFromContainer(ctx context.Context, docker dockerpkg.Docker, tar s2itar.Tar, sourcePath, destinationPath, containerID string) (api.FailureReason, error) {
 	glog.V(5).Infof("Downloading file %q", sourcePath)
 
 	fd, err := ioutil.TempFile(destinationPath, "s2i-runtime-artifact")
@@ -475,7 +584,7 @@ func downloadAndExtractFileFromContainer(docker dockerpkg.Docker, tar s2itar.Tar
 		os.Remove(fd.Name())
 	}()
 
-	if err := docker.DownloadFromContainer(sourcePath, fd, containerID); err != nil {
+	if err := docker.DownloadFromContainer(ctx, sourcePath, fd, containerID); err != nil {
 		res := utilstatus.NewFailureReason(
 			utilstatus.ReasonGenericS2IBuildFailed,
 			utilstatus.ReasonMessageGenericS2iBuildFailed,
@@ -533,7 +642,7 @@ func checkAndGetNewLabels(builder *STI, docker dockerpkg.Docker, tar s2itar.Tar,
 	}
 
 	// download & extract the file from container
-	if _, err := downloadAndExtractFileFromContainer(docker, tar, sourceFilepath, downloadPath, containerID); err != nil {
+	if _, err := downloadAndExtractFileFromContainer(builder.ctx, docker, tar, sourceFilepath, downloadPath, containerID); err != nil {
 		glog.V(3).Infof("unable to download and extract '%s' ... continuing", metadataFilename)
 		return nil
 	}
@@ -2,10 +2,20 @@ package sti
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/kubesphere/s2irun/pkg/api/constants"
 	"github.com/kubesphere/s2irun/pkg/docker"
+	"github.com/kubesphere/s2irun/pkg/oci"
+	"github.com/kubesphere/s2irun/pkg/utils/fs"
+	utilstatus "github.com/kubesphere/s2irun/pkg/utils/status"
 )
 
 func TestStorePreviousImageStep(t *testing.T) {
@@ -231,3 +241,66 @@ func TestReportSuccessStep(t *testing.T) {
 	}
 
 }
+
+func TestAssembleOCIImageStep(t *testing.T) {
+	testCases := []struct {
+		name          string
+		sourceScripts []string
+		expectError   bool
+	}{
+		{name: "assemble"},
+		{name: "run script provided with the source", sourceScripts: []string{constants.Run}},
+		{name: "assemble-runtime script provided with the source", sourceScripts: []string{constants.AssembleRuntime}, expectError: true},
+	}
+
+	for _, testCase := range testCases {
+		workingDir, err := ioutil.TempDir("", "s2i-oci-assemble")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(workingDir)
+		artifactsDir := filepath.Join(workingDir, constants.RuntimeArtifactsDir)
+		os.MkdirAll(artifactsDir, 0755)
+		ioutil.WriteFile(filepath.Join(artifactsDir, "app.jar"), []byte("app"), 0644)
+		for _, script := range testCase.sourceScripts {
+			os.MkdirAll(filepath.Join(workingDir, constants.SourceScripts), 0755)
+			ioutil.WriteFile(filepath.Join(workingDir, constants.SourceScripts, script), []byte("#!/bin/sh"), 0755)
+		}
+
+		builder := newFakeBaseSTI()
+		builder.fs = fs.NewFileSystem()
+		builder.config.WorkingDir = workingDir
+		builder.config.BuilderImage = "builder"
+		builder.config.RuntimeImage = "runtime"
+		builder.config.OCIAssemble = true
+		builder.config.Tag = "app:v1"
+		builder.scriptsURL = map[string]string{constants.Run: "image:///usr/libexec/s2i/run"}
+		if builder.ociLayout, err = oci.NewLayout(filepath.Join(workingDir, constants.OCILayoutDir)); err != nil {
+			t.Fatal(err)
+		}
+		builder.ociBase = &oci.Image{Config: v1.Image{Config: v1.ImageConfig{WorkingDir: "/deployments"}}}
+
+		step := &assembleOCIImageStep{builder: builder, docker: builder.docker, fs: builder.fs, tar: builder.tar}
+		ctx := &postExecutorStepContext{containerID: "builder-container"}
+		err = step.execute(ctx)
+		if testCase.expectError {
+			if err == nil || builder.result.BuildInfo.FailureReason.Reason != utilstatus.ReasonAssembleOCIImageFailed {
+				t.Errorf("%s: expected the step to fail with %s, got %v (%+v)", testCase.name, utilstatus.ReasonAssembleOCIImageFailed, err, builder.result.BuildInfo.FailureReason)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: should exit without error, but it returned %v", testCase.name, err)
+		}
+		image, err := builder.ociLayout.Image("app:v1")
+		if err != nil {
+			t.Fatalf("%s: expected the image tagged in the layout: %v", testCase.name, err)
+		}
+		if ctx.imageID != image.Manifest.Config.Digest.String() || len(image.Manifest.Layers) != 1 {
+			t.Errorf("%s: unexpected image %s with %d layers", testCase.name, ctx.imageID, len(image.Manifest.Layers))
+		}
+		if cmd := image.Config.Config.Cmd; len(cmd) != 1 || !strings.HasSuffix(cmd[0], "/run") {
+			t.Errorf("%s: expected the run script as the command, got %v", testCase.name, cmd)
+		}
+	}
+}
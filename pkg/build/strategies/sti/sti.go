@@ -1,6 +1,7 @@
 package sti
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -19,8 +20,9 @@ import (
 	dockerpkg "github.com/kubesphere/s2irun/pkg/docker"
 	s2ierr "github.com/kubesphere/s2irun/pkg/errors"
 	"github.com/kubesphere/s2irun/pkg/ignore"
-	"github.com/kubesphere/s2irun/pkg/outputresult"
+	"github.com/kubesphere/s2irun/pkg/oci"
 	"github.com/kubesphere/s2irun/pkg/scm"
+	gitdownloader "github.com/kubesphere/s2irun/pkg/scm/downloaders/git"
 	"github.com/kubesphere/s2irun/pkg/scm/git"
 	"github.com/kubesphere/s2irun/pkg/scripts"
 	"github.com/kubesphere/s2irun/pkg/tar"
@@ -53,18 +55,22 @@ var (
 // STI strategy executes the S2I build.
 // For more details about S2I, visit https://github.com/s2iservice
 type STI struct {
-	config                 *api.Config
-	result                 *api.Result
-	postExecutor           dockerpkg.PostExecutor
-	installer              scripts.Installer
-	runtimeInstaller       scripts.Installer
-	git                    git.Git
-	fs                     fs.FileSystem
-	tar                    tar.Tar
-	docker                 dockerpkg.Docker
-	incrementalDocker      dockerpkg.Docker
-	runtimeDocker          dockerpkg.Docker
-	pushDocker             dockerpkg.Docker
+	ctx               context.Context
+	config            *api.Config
+	result            *api.Result
+	postExecutor      dockerpkg.PostExecutor
+	installer         scripts.Installer
+	runtimeInstaller  scripts.Installer
+	git               git.Git
+	fs                fs.FileSystem
+	tar               tar.Tar
+	docker            dockerpkg.Docker
+	incrementalDocker dockerpkg.Docker
+	runtimeDocker     dockerpkg.Docker
+	pushDocker        dockerpkg.Docker
+	// newTagDocker returns the Docker pushing the tags with the given
+	// authentication, which may only be resolved once the tags are expanded.
+	newTagDocker           func(auth api.AuthConfig) dockerpkg.Docker
 	callbackInvoker        utils.CallbackInvoker
 	requiredScripts        []string
 	optionalScripts        []string
@@ -91,25 +97,35 @@ type STI struct {
 	postExecutorFirstStageSteps  []postExecutorStep
 	postExecutorSecondStageSteps []postExecutorStep
 	postExecutorStepsContext     *postExecutorStepContext
+
+	// the OCI layout the image is assembled in with OCIAssemble, from the
+	// runtime image ociBase into ociImage.
+	ociLayout *oci.Layout
+	ociBase   *oci.Image
+	ociImage  *oci.Image
 }
 
 // New returns the instance of STI builder strategy for the given config.
 // If the layeredBuilder parameter is specified, then the builder provided will
 // be used for the case that the base Docker image does not have 'tar' or 'bash'
-// installed.
-func New(client dockerpkg.Client, config *api.Config, fs fs.FileSystem, overrides build.Overrides) (*STI, error) {
+// installed. The images pulled to inspect them are no longer pulled once ctx
+// is done.
+func New(ctx context.Context, client dockerpkg.Client, config *api.Config, fs fs.FileSystem, overrides build.Overrides) (*STI, error) {
 	excludePattern, err := regexp.Compile(config.ExcludeRegExp)
 	if err != nil {
 		return nil, err
 	}
 
-	docker := dockerpkg.New(client, config.PullAuthentication, config.PushAuthentication)
+	// The builder, runtime and previous images are each pulled with their own
+	// authentication.
+	docker := dockerpkg.NewForConfig(client, config)
 	var incrementalDocker dockerpkg.Docker
 	if config.Incremental {
-		incrementalDocker = dockerpkg.New(client, config.IncrementalAuthentication, config.PushAuthentication)
+		incrementalDocker = docker
 	}
 
 	inst := scripts.NewInstaller(
+		ctx,
 		config.BuilderImage,
 		config.ScriptsURL,
 		config.ScriptDownloadProxyConfig,
@@ -121,6 +137,7 @@ func New(client dockerpkg.Client, config *api.Config, fs fs.FileSystem, override
 	tarHandler.SetExclusionPattern(excludePattern)
 
 	builder := &STI{
+		ctx:                    ctx,
 		installer:              inst,
 		config:                 config,
 		docker:                 docker,
@@ -138,10 +155,17 @@ func New(client dockerpkg.Client, config *api.Config, fs fs.FileSystem, override
 		newLabels:              map[string]string{},
 	}
 
-	if len(config.RuntimeImage) > 0 {
-		builder.runtimeDocker = dockerpkg.New(client, config.RuntimeAuthentication, config.PushAuthentication)
+	builder.newTagDocker = func(auth api.AuthConfig) dockerpkg.Docker {
+		return dockerpkg.New(client, config.PullAuthentication, auth)
+	}
+
+	// The runtime image is not run when assembling the image as OCI layers,
+	// so its scripts are not installed.
+	if len(config.RuntimeImage) > 0 && !config.OCIAssemble {
+		builder.runtimeDocker = docker
 
 		builder.runtimeInstaller = scripts.NewInstaller(
+			ctx,
 			config.RuntimeImage,
 			config.ScriptsURL,
 			config.ScriptDownloadProxyConfig,
@@ -157,7 +181,7 @@ func New(client dockerpkg.Client, config *api.Config, fs fs.FileSystem, override
 	// which would lead to replacing this quick short circuit (so this change is tactical)
 	builder.source = overrides.Downloader
 	if builder.source == nil && !config.Usage {
-		downloader, err := scm.DownloaderForSource(builder.fs, config.Source, config.ForceCopy)
+		downloader, err := scm.DownloaderForSource(builder.fs, config.Source, config.ForceCopy, config.GitAuthentication)
 		if err != nil {
 			return nil, err
 		}
@@ -186,9 +210,16 @@ func New(client dockerpkg.Client, config *api.Config, fs fs.FileSystem, override
 // Build processes a Request and returns a *api.Result and an error.
 // An error represents a failure performing the build rather than a failure
 // of the build itself.  Callers should check the Success field of the result
-// to determine whether a build succeeded or not.
-func (builder *STI) Build(config *api.Config) (*api.Result, error) {
+// to determine whether a build succeeded or not. The containers run by the
+// build are killed and removed when ctx is done.
+func (builder *STI) Build(ctx context.Context, config *api.Config) (*api.Result, error) {
+	builder.ctx = ctx
 	builder.result = &api.Result{}
+	defer func() {
+		if reason, ok := utilstatus.NewContextFailureReason(ctx); ok && !builder.result.Success {
+			builder.result.BuildInfo.FailureReason = reason
+		}
+	}()
 
 	if len(builder.config.CallbackURL) > 0 {
 		defer func() {
@@ -214,7 +245,9 @@ func (builder *STI) Build(config *api.Config) (*api.Result, error) {
 		glog.V(1).Info("Clean build will be performed")
 	}
 
-	glog.V(9).Infof("Performing source build from %s", config.Source)
+	if config.Source != nil {
+		glog.V(9).Infof("Performing source build from %s", config.Source.StringNoCredentials())
+	}
 	if builder.incremental {
 		if err := builder.artifacts.Save(config); err != nil {
 			glog.Warning("Clean build will be performed because of error saving previous build artifacts")
@@ -227,11 +260,12 @@ func (builder *STI) Build(config *api.Config) (*api.Result, error) {
 	} else {
 		glog.V(1).Infof("Running %q in %q", constants.Assemble, config.Tag)
 	}
+	utilglog.SetStage(string(api.StageAssemble))
 	startTime := time.Now()
 	if err := builder.scripts.Execute(constants.Assemble, config.AssembleUser, config); err != nil {
 		if err == errMissingRequirements {
 			glog.V(1).Info("Image is missing basic requirements (sh or tar), layered build will be performed")
-			return builder.layered.Build(config)
+			return builder.buildLayered(ctx, config)
 		}
 		if e, ok := err.(s2ierr.ContainerError); ok {
 			if !isMissingRequirements(e.Output) {
@@ -242,39 +276,112 @@ func (builder *STI) Build(config *api.Config) (*api.Result, error) {
 				return builder.result, err
 			}
 			glog.V(1).Info("Image is missing basic requirements (sh or tar), layered build will be performed")
-			buildResult, err := builder.layered.Build(config)
-			return buildResult, err
+			return builder.buildLayered(ctx, config)
 		}
 
 		return builder.result, err
 	}
-	if builder.config.Export {
-		err := builder.docker.PushImage(builder.config.Tag)
-		if err != nil {
+	builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(builder.result.BuildInfo.Stages, api.StageAssemble, api.StepAssembleBuildScripts, startTime, time.Now())
+	for _, tag := range builder.config.AdditionalTags {
+		// The assembled OCI image is referenced by all its tags already.
+		if builder.ociImage != nil {
+			break
+		}
+		if err := builder.docker.TagImage(builder.config.Tag, tag); err != nil {
 			builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
-				utilstatus.ReasonPushImageFailed,
-				utilstatus.ReasonMessagePushImageFailed,
+				utilstatus.ReasonGenericS2IBuildFailed,
+				utilstatus.ReasonMessageGenericS2iBuildFailed,
 			)
+			return builder.result, fmt.Errorf("unable to tag %s as %s: %v", builder.config.Tag, tag, err)
+		}
+	}
+	if len(builder.config.ExportPath) > 0 {
+		if err := builder.export(ctx); err != nil {
+			return builder.result, err
+		}
+	}
+	if builder.config.Export {
+		if err := builder.push(ctx); err != nil {
 			return builder.result, err
 		}
 	}
-	builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(builder.result.BuildInfo.Stages, api.StageAssemble, api.StepAssembleBuildScripts, startTime, time.Now())
 	builder.result.Success = true
 
-	if builder.config.OutputBuildResult == true {
-		dockerInspect, err := builder.docker.InspectImage(builder.config.Tag)
-		if err != nil {
-			glog.V(1).Info("Inspect image failed.")
+	if builder.ociImage != nil {
+		builder.result.ResultInfo.ImageID = builder.ociImage.Manifest.Config.Digest.String()
+		builder.result.ResultInfo.ImageSize = builder.ociImage.Size()
+		build.OutputResult(builder.config, nil, "", builder.result)
+	} else {
+		build.OutputResult(builder.config, builder.docker, builder.config.Tag, builder.result)
+	}
+
+	return builder.result, nil
+}
+
+// push pushes the image to its tag and its additional tags, recording the
+// outcome of every push in the result.
+func (builder *STI) push(ctx context.Context) error {
+	utilglog.SetStage(string(api.StagePushImage))
+	startTime := time.Now()
+	defer func() {
+		builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(builder.result.BuildInfo.Stages, api.StagePushImage, api.StepPushImage, startTime, time.Now())
+	}()
+	return build.PushTags(ctx, builder.config, builder.result, builder.pushTag)
+}
+
+// pushTag pushes the image to tag with auth: the assembled OCI image from its
+// layout, the image of the Docker engine otherwise.
+func (builder *STI) pushTag(ctx context.Context, tag string, auth api.AuthConfig) (string, error) {
+	if builder.ociImage != nil {
+		return oci.NewRegistry(auth, builder.config.InsecureRegistries...).Push(ctx, builder.ociImage, builder.ociLayout, tag)
+	}
+	return builder.newTagDocker(auth).PushImage(ctx, tag)
+}
+
+// export saves the image to the archive at ExportPath, recording the archive
+// and its checksum in the result.
+func (builder *STI) export(ctx context.Context) error {
+	return build.ExportImage(ctx, builder.config, builder.result, builder.fs, builder.saveImage)
+}
+
+// saveImage writes the image to w in ExportFormat. The assembled OCI image is
+// archived from its layout. The image of the Docker engine is saved by its
+// tag, or by its ID when it has no tag.
+func (builder *STI) saveImage(ctx context.Context, w io.Writer) error {
+	tag := builder.config.Tag
+	if builder.ociImage != nil {
+		if builder.config.ExportFormat == api.OCIArchiveFormat {
+			return oci.WriteOCIArchive(w, builder.ociLayout, builder.ociImage, tag)
 		}
-		glog.V(0).Info("Start output build info.")
-		buildResult := outputresult.OutputResult(builder.config, dockerInspect, builder.result)
-		err = outputresult.AddBuildResultToAnnotation(buildResult)
-		if err != nil {
-			glog.V(1).Info("Output build result failed, reason: %s.", err)
+		tags := []string{}
+		if len(tag) > 0 {
+			tags = append(tags, tag)
 		}
+		return oci.WriteDockerArchive(w, builder.ociLayout, builder.ociImage, tags)
 	}
 
-	return builder.result, nil
+	return build.SaveDockerImage(ctx, builder.docker, builder.config, utils.FirstNonEmpty(tag, builder.postExecutorStepsContext.imageID), w)
+}
+
+// buildLayered performs the layered build, keeping the stages of the build
+// recorded so far, exports the image it assembled when ExportPath is set and
+// completes the result with it.
+func (builder *STI) buildLayered(ctx context.Context, config *api.Config) (*api.Result, error) {
+	buildResult, err := builder.layered.Build(ctx, config)
+	if buildResult != nil {
+		buildResult.BuildInfo.Stages = api.MergeStageInfo(builder.result.BuildInfo.Stages, buildResult.BuildInfo.Stages)
+	}
+	if err != nil {
+		return buildResult, err
+	}
+	if len(builder.config.ExportPath) > 0 {
+		if err = build.ExportImage(ctx, builder.config, buildResult, builder.fs, builder.saveImage); err != nil {
+			buildResult.Success = false
+			return buildResult, err
+		}
+	}
+	build.OutputResult(builder.config, builder.docker, builder.config.Tag, buildResult)
+	return buildResult, nil
 }
 
 // Prepare prepares the source code and tar for build.
@@ -299,8 +406,13 @@ func (builder *STI) Prepare(config *api.Config) error {
 	builder.result.WorkingDir = config.WorkingDir
 
 	if len(config.RuntimeImage) > 0 {
+		utilglog.SetStage(string(api.StagePullImages))
 		startTime := time.Now()
-		dockerpkg.GetRuntimeImage(builder.runtimeDocker, config)
+		if config.OCIAssemble {
+			err = builder.pullOCIRuntimeImage(config)
+		} else {
+			dockerpkg.GetRuntimeImage(builder.ctx, builder.runtimeDocker, config)
+		}
 		builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(builder.result.BuildInfo.Stages, api.StagePullImages, api.StepPullRuntimeImage, startTime, time.Now())
 
 		if err != nil {
@@ -315,7 +427,11 @@ func (builder *STI) Prepare(config *api.Config) error {
 		// user didn't specify mapping, let's take it from the runtime image then
 		if len(builder.config.RuntimeArtifacts) == 0 {
 			var mapping string
-			mapping, err = builder.docker.GetAssembleInputFiles(config.RuntimeImage)
+			if builder.ociBase != nil {
+				mapping = builder.ociBase.Config.Config.Labels[constants.AssembleInputFilesLabel]
+			} else {
+				mapping, err = builder.docker.GetAssembleInputFiles(builder.ctx, config.RuntimeImage)
+			}
 			if err != nil {
 				builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
 					utilstatus.ReasonInvalidArtifactsMapping,
@@ -379,35 +495,58 @@ func (builder *STI) Prepare(config *api.Config) error {
 
 	// fetch sources, for their .s2i/bin might contain s2i scripts
 	if config.Source != nil {
-		if builder.sourceInfo, err = builder.source.Download(config); err != nil {
+		utilglog.SetStage(string(api.StageFetchSource))
+		startTime := time.Now()
+		builder.sourceInfo, err = builder.source.Download(builder.ctx, config)
+		builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(builder.result.BuildInfo.Stages, api.StageFetchSource, api.StepDownloadSource, startTime, time.Now())
+		if err != nil {
+			message := utilstatus.ReasonMessageFetchSourceFailed
+			if _, ok := err.(gitdownloader.LFSPullError); ok {
+				message = utilstatus.ReasonMessageFetchLFSObjectsFailed
+			}
 			builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
 				utilstatus.ReasonFetchSourceFailed,
-				utilstatus.ReasonMessageFetchSourceFailed,
+				message,
 			)
 			return err
 		}
 		if builder.sourceInfo != nil {
 			config.SourceInfo = builder.sourceInfo
+			builder.result.BuildInfo.SourceCache = builder.sourceInfo.Cache
 		}
 	}
+	if err = build.ExpandTags(config); err != nil {
+		builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
+			utilstatus.ReasonInvalidTag,
+			utilstatus.ReasonMessageInvalidTag,
+		)
+		return err
+	}
+	if keychain, ok := dockerpkg.KeychainFromContext(builder.ctx); ok {
+		dockerpkg.ResolvePushAuthentications(config, keychain)
+	}
 
 	// get the scripts
-	required, err := builder.installer.InstallRequired(builder.requiredScripts, config.WorkingDir)
+	utilglog.SetStage(string(api.StageInstallScripts))
+	startTime := time.Now()
+	required, err := builder.installer.InstallRequired(builder.ctx, builder.requiredScripts, config.WorkingDir)
 	if err != nil {
+		builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(builder.result.BuildInfo.Stages, api.StageInstallScripts, api.StepInstallScripts, startTime, time.Now())
 		builder.result.BuildInfo.FailureReason = utilstatus.NewFailureReason(
 			utilstatus.ReasonInstallScriptsFailed,
 			utilstatus.ReasonMessageInstallScriptsFailed,
 		)
 		return err
 	}
-	optional := builder.installer.InstallOptional(builder.optionalScripts, config.WorkingDir)
+	optional := builder.installer.InstallOptional(builder.ctx, builder.optionalScripts, config.WorkingDir)
 
 	requiredAndOptional := append(required, optional...)
 
 	if len(config.RuntimeImage) > 0 && builder.runtimeInstaller != nil {
-		optionalRuntime := builder.runtimeInstaller.InstallOptional(builder.optionalRuntimeScripts, config.WorkingDir)
+		optionalRuntime := builder.runtimeInstaller.InstallOptional(builder.ctx, builder.optionalRuntimeScripts, config.WorkingDir)
 		requiredAndOptional = append(requiredAndOptional, optionalRuntime...)
 	}
+	builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(builder.result.BuildInfo.Stages, api.StageInstallScripts, api.StepInstallScripts, startTime, time.Now())
 
 	// If a ScriptsURL was specified, but no scripts were downloaded from it, throw an error
 	if len(config.ScriptsURL) > 0 {
@@ -439,7 +578,48 @@ func (builder *STI) Prepare(config *api.Config) error {
 
 	// see if there is a .s2iignore file, and if so, read in the patterns an then
 	// search and delete on
-	return builder.ignorer.Ignore(config)
+	utilglog.SetStage(string(api.StageFetchSource))
+	startTime = time.Now()
+	err = builder.ignorer.Ignore(config)
+	builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(builder.result.BuildInfo.Stages, api.StageFetchSource, api.StepApplyIgnoreRules, startTime, time.Now())
+	return err
+}
+
+// BuildInfo returns the information recorded so far about the build, for the
+// strategies calling Prepare directly rather than Build.
+func (builder *STI) BuildInfo() api.BuildInfo {
+	if builder.result == nil {
+		return api.BuildInfo{}
+	}
+	return builder.result.BuildInfo
+}
+
+// pullOCIRuntimeImage pulls the runtime image into the OCI layout the image
+// is assembled in, rather than into the Docker engine, or imports it from its
+// archive.
+func (builder *STI) pullOCIRuntimeImage(config *api.Config) error {
+	layoutPath := config.OCILayoutPath
+	if len(layoutPath) == 0 {
+		layoutPath = filepath.Join(config.WorkingDir, constants.OCILayoutDir)
+	}
+	var err error
+	if builder.ociLayout, err = oci.NewLayout(layoutPath); err != nil {
+		return err
+	}
+	if path, ok := dockerpkg.ArchivePath(config.RuntimeImage); ok {
+		glog.V(1).Infof("Importing runtime image archive %s into the OCI layout %s", path, layoutPath)
+		builder.ociBase, err = oci.ImportArchive(builder.ociLayout, path)
+		return err
+	}
+	glog.V(1).Infof("Pulling runtime image %s into the OCI layout %s", config.RuntimeImage, layoutPath)
+	builder.ociBase, err = dockerpkg.PullOCIImage(builder.ctx, config, builder.ociLayout, config.RuntimeImage, config.RuntimeAuthentication)
+	return err
+}
+
+// SetContext sets the context aborting the steps of the build when it is
+// done, for the strategies calling Prepare directly rather than Build.
+func (builder *STI) SetContext(ctx context.Context) {
+	builder.ctx = ctx
 }
 
 // SetScripts allows to override default required and optional scripts
@@ -495,8 +675,9 @@ func (builder *STI) Exists(config *api.Config) bool {
 
 	tag := utils.FirstNonEmpty(config.IncrementalFromTag, config.Tag)
 
+	utilglog.SetStage(string(api.StagePullImages))
 	startTime := time.Now()
-	result, err := dockerpkg.PullImage(tag, builder.incrementalDocker, policy)
+	result, err := dockerpkg.PullImage(builder.ctx, tag, builder.incrementalDocker, policy)
 	builder.result.BuildInfo.Stages = api.RecordStageAndStepInfo(builder.result.BuildInfo.Stages, api.StagePullImages, api.StepPullPreviousImage, startTime, time.Now())
 
 	if err != nil {
@@ -533,6 +714,7 @@ func (builder *STI) Save(config *api.Config) (err error) {
 	errReader, errWriter := io.Pipe()
 	glog.V(1).Infof("Saving build artifacts from image %s to path %s", image, artifactTmpDir)
 	extractFunc := func(string) error {
+		utilglog.SetStage(string(api.StageRetrieve))
 		startTime := time.Now()
 		extractErr := builder.tar.ExtractTarStream(artifactTmpDir, outReader)
 		io.Copy(ioutil.Discard, outReader) // must ensure reader from container is drained
@@ -575,7 +757,7 @@ func (builder *STI) Save(config *api.Config) (err error) {
 	}
 
 	dockerpkg.StreamContainerIO(errReader, nil, func(s string) { glog.Info(s) })
-	err = builder.docker.RunContainer(opts)
+	err = builder.docker.RunContainer(builder.ctx, opts)
 	if e, ok := err.(s2ierr.ContainerError); ok {
 		err = s2ierr.NewSaveArtifactsError(image, e.Output, err)
 	}
@@ -596,7 +778,7 @@ func (builder *STI) Execute(command string, user string, config *api.Config) err
 	// this should be a quick inspect of the existing image. However, if
 	// the image has been deleted since the strategy was created, this will ensure
 	// it exists before executing a script on it.
-	builder.docker.CheckAndPullImage(config.BuilderImage)
+	builder.docker.CheckAndPullImage(builder.ctx, config.BuilderImage)
 
 	// we can't invoke this method before (for example in New() method)
 	// because of later initialization of config.WorkingDir
@@ -721,7 +903,7 @@ func (builder *STI) Execute(command string, user string, config *api.Config) err
 
 	c := dockerpkg.StreamContainerIO(errReader, &errOutput, func(s string) { glog.Info(s) })
 
-	err := builder.docker.RunContainer(opts)
+	err := builder.docker.RunContainer(builder.ctx, opts)
 	if err != nil {
 		// Must wait for StreamContainerIO goroutine above to exit before reading errOutput.
 		<-c
@@ -741,11 +923,11 @@ func (builder *STI) Execute(command string, user string, config *api.Config) err
 func (builder *STI) uploadInjections(config *api.Config, rmScript, containerID string) error {
 	glog.V(2).Info("starting the injections uploading ...")
 	for _, s := range config.Injections {
-		if err := builder.docker.UploadToContainer(builder.fs, s.Source, s.Destination, containerID); err != nil {
+		if err := builder.docker.UploadToContainer(builder.ctx, builder.fs, s.Source, s.Destination, containerID); err != nil {
 			return utils.HandleInjectionError(s, err)
 		}
 	}
-	if err := builder.docker.UploadToContainer(builder.fs, rmScript, rmInjectionsScript, containerID); err != nil {
+	if err := builder.docker.UploadToContainer(builder.ctx, builder.fs, rmScript, rmInjectionsScript, containerID); err != nil {
 		return utils.HandleInjectionError(api.VolumeSpec{Source: rmScript, Destination: rmInjectionsScript}, err)
 	}
 	return nil
@@ -774,6 +956,24 @@ func (builder *STI) initPostExecutorSteps() {
 				docker:  builder.docker,
 			},
 		}
+	} else if builder.config.OCIAssemble {
+		builder.postExecutorFirstStageSteps = []postExecutorStep{
+			&downloadFilesFromBuilderImageStep{
+				builder: builder,
+				docker:  builder.docker,
+				fs:      builder.fs,
+				tar:     builder.tar,
+			},
+			&assembleOCIImageStep{
+				builder: builder,
+				docker:  builder.docker,
+				fs:      builder.fs,
+				tar:     builder.tar,
+			},
+			&reportSuccessStep{
+				builder: builder,
+			},
+		}
 	} else {
 		builder.postExecutorFirstStageSteps = []postExecutorStep{
 			&downloadFilesFromBuilderImageStep{
@@ -813,7 +1013,7 @@ func (builder *STI) uploadInjectionResult(startErr error, containerID string) er
 	if err != nil {
 		return err
 	}
-	err = builder.docker.UploadToContainer(builder.fs, resultFile, injectionResultFile, containerID)
+	err = builder.docker.UploadToContainer(builder.ctx, builder.fs, resultFile, injectionResultFile, containerID)
 	if err != nil {
 		return utils.HandleInjectionError(api.VolumeSpec{Source: resultFile, Destination: injectionResultFile}, err)
 	}
@@ -1,15 +1,23 @@
 package sti
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
 	"regexp/syntax"
 	"strings"
 	"testing"
 
+	dockertypes "github.com/docker/docker/api/types"
+
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/api/constants"
 	"github.com/kubesphere/s2irun/pkg/build"
@@ -23,6 +31,7 @@ import (
 	"github.com/kubesphere/s2irun/pkg/test"
 	testfs "github.com/kubesphere/s2irun/pkg/test/fs"
 	"github.com/kubesphere/s2irun/pkg/utils/fs"
+	utilstatus "github.com/kubesphere/s2irun/pkg/utils/status"
 )
 
 type FakeSTI struct {
@@ -53,6 +62,7 @@ type FakeSTI struct {
 
 func newFakeBaseSTI() *STI {
 	return &STI{
+		ctx:       context.Background(),
 		config:    &api.Config{},
 		result:    &api.Result{},
 		docker:    &docker.FakeDocker{},
@@ -65,6 +75,7 @@ func newFakeBaseSTI() *STI {
 
 func newFakeSTI(f *FakeSTI) *STI {
 	s := &STI{
+		ctx:           context.Background(),
 		config:        &api.Config{},
 		result:        &api.Result{},
 		docker:        &docker.FakeDocker{},
@@ -117,7 +128,7 @@ func (f *FakeSTI) fetchSource() error {
 	return f.FetchSourceError
 }
 
-func (f *FakeSTI) Download(*api.Config) (*git.SourceInfo, error) {
+func (f *FakeSTI) Download(context.Context, *api.Config) (*git.SourceInfo, error) {
 	return nil, f.DownloadError
 }
 
@@ -141,7 +152,7 @@ type FakeDockerBuild struct {
 	*FakeSTI
 }
 
-func (f *FakeDockerBuild) Build(*api.Config) (*api.Result, error) {
+func (f *FakeDockerBuild) Build(context.Context, *api.Config) (*api.Result, error) {
 	f.LayeredBuildCalled = true
 	return &api.Result{}, f.LayeredBuildError
 }
@@ -155,7 +166,7 @@ func TestDefaultSource(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	sti, err := New(client, config, fs.NewFileSystem(), build.Overrides{})
+	sti, err := New(context.Background(), client, config, fs.NewFileSystem(), build.Overrides{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -176,7 +187,7 @@ func TestEmptySource(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	sti, err := New(client, config, fs.NewFileSystem(), build.Overrides{})
+	sti, err := New(context.Background(), client, config, fs.NewFileSystem(), build.Overrides{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -194,7 +205,7 @@ func TestOverrides(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	sti, err := New(client,
+	sti, err := New(context.Background(), client,
 		&api.Config{
 			DockerConfig: &api.DockerConfig{Endpoint: "unix:///var/run/docker.sock"},
 		},
@@ -220,7 +231,7 @@ func TestBuild(t *testing.T) {
 		}
 
 		builder := newFakeSTI(fh)
-		builder.Build(&api.Config{Incremental: incremental})
+		builder.Build(context.Background(), &api.Config{Incremental: incremental})
 
 		// Verify the right scripts were configed
 		if !reflect.DeepEqual(fh.SetupRequired, []string{constants.Assemble, constants.Run}) {
@@ -261,13 +272,67 @@ func TestLayeredBuild(t *testing.T) {
 		ExpectedError: true,
 	}
 	builder := newFakeSTI(fh)
-	builder.Build(&api.Config{BuilderImage: "testimage"})
+	builder.Build(context.Background(), &api.Config{BuilderImage: "testimage"})
 	// Verify layered build
 	if !fh.LayeredBuildCalled {
 		t.Errorf("Layered build was not called.")
 	}
 }
 
+func TestLayeredBuildExport(t *testing.T) {
+	fh := &FakeSTI{
+		BuildRequest:  &api.Config{BuilderImage: "testimage"},
+		BuildResult:   &api.Result{},
+		ExecuteError:  errMissingRequirements,
+		ExpectedError: true,
+	}
+	builder := newFakeSTI(fh)
+	fakeDocker := &docker.FakeDocker{SaveImageContent: []byte("archive")}
+	builder.docker = fakeDocker
+	builder.postExecutorStepsContext = &postExecutorStepContext{}
+	builder.config = &api.Config{BuilderImage: "testimage", Tag: "foo/app", ExportPath: "app.tar"}
+	result, err := builder.Build(context.Background(), builder.config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !fh.LayeredBuildCalled {
+		t.Errorf("Layered build was not called.")
+	}
+	if fakeDocker.SaveImageName != "foo/app" || result.ResultInfo.ExportPath != "app.tar" {
+		t.Errorf("expected the image of the layered build exported, got %q and %+v", fakeDocker.SaveImageName, result.ResultInfo)
+	}
+}
+
+func TestLayeredBuildResult(t *testing.T) {
+	fh := &FakeSTI{
+		BuildRequest:  &api.Config{BuilderImage: "testimage"},
+		BuildResult:   &api.Result{},
+		ExecuteError:  errMissingRequirements,
+		ExpectedError: true,
+	}
+	builder := newFakeSTI(fh)
+	builder.docker = &docker.FakeDocker{
+		GetInspectImage: &dockertypes.ImageInspect{ID: "sha256:1234", RepoTags: []string{"foo/app:latest"}},
+	}
+	builder.config = &api.Config{
+		BuilderImage:    "testimage",
+		Tag:             "foo/app",
+		BuildResultPath: "result.json",
+		SourceInfo:      &git.SourceInfo{CommitID: "1bf4f04"},
+	}
+	result, err := builder.Build(context.Background(), builder.config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info := result.ResultInfo
+	if info.ImageID != "sha256:1234" || info.ImageName != "foo/app" || len(info.ImageRepoTags) != 1 {
+		t.Errorf("expected the result to describe the image of the layered build, got %+v", info)
+	}
+	if result.SourceInfo.CommitID != "1bf4f04" {
+		t.Errorf("expected the result to describe the source, got %+v", result.SourceInfo)
+	}
+}
+
 func TestBuildErrorExecute(t *testing.T) {
 	fh := &FakeSTI{
 		BuildRequest: &api.Config{
@@ -278,7 +343,7 @@ func TestBuildErrorExecute(t *testing.T) {
 		ExpectedError: false,
 	}
 	builder := newFakeSTI(fh)
-	_, err := builder.Build(&api.Config{BuilderImage: "testimage"})
+	_, err := builder.Build(context.Background(), &api.Config{BuilderImage: "testimage"})
 	if err == nil || err.Error() != "ExecuteError" {
 		t.Errorf("An error was expected, but got different %v", err)
 	}
@@ -319,6 +384,7 @@ func TestWasExpectedError(t *testing.T) {
 
 func testBuildHandler() *STI {
 	s := &STI{
+		ctx:               context.Background(),
 		docker:            &docker.FakeDocker{},
 		incrementalDocker: &docker.FakeDocker{},
 		installer:         &test.FakeInstaller{},
@@ -594,7 +660,7 @@ func TestFetchSource(t *testing.T) {
 		}
 
 		expectedTargetDir := "/working-dir/upload/src"
-		_, e := bh.source.Download(bh.config)
+		_, e := bh.source.Download(context.Background(), bh.config)
 		if e != nil {
 			t.Errorf("Unexpected error %v [%d]", e, testNum)
 		}
@@ -810,6 +876,31 @@ func TestPrepareDownloadAssembleRuntime(t *testing.T) {
 	}
 }
 
+func TestPrepareRecordsStages(t *testing.T) {
+	builder := newFakeSTI(&FakeSTI{})
+	builder.source = &FakeSTI{}
+	config := builder.config
+	config.Source = git.MustParse("http://github.com/openshift/source")
+
+	if err := builder.Prepare(config); err != nil {
+		t.Fatalf("Prepare() unexpectedly failed with error: %v", err)
+	}
+
+	steps := map[api.StageName][]api.StepName{}
+	for _, stage := range builder.BuildInfo().Stages {
+		for _, step := range stage.Steps {
+			steps[stage.Name] = append(steps[stage.Name], step.Name)
+		}
+	}
+	expected := map[api.StageName][]api.StepName{
+		api.StageFetchSource:    {api.StepDownloadSource, api.StepApplyIgnoreRules},
+		api.StageInstallScripts: {api.StepInstallScripts},
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Prepare() recorded %v, expected %v", steps, expected)
+	}
+}
+
 func TestExecuteOK(t *testing.T) {
 	rh := newFakeBaseSTI()
 	pe := &FakeSTI{}
@@ -926,7 +1017,7 @@ func TestCleanup(t *testing.T) {
 }
 
 func TestNewWithInvalidExcludeRegExp(t *testing.T) {
-	_, err := New(nil, &api.Config{
+	_, err := New(context.Background(), nil, &api.Config{
 		DockerConfig:  docker.GetDefaultDockerConfig(),
 		ExcludeRegExp: "(",
 	}, nil, build.Overrides{})
@@ -934,3 +1025,143 @@ func TestNewWithInvalidExcludeRegExp(t *testing.T) {
 		t.Errorf("expected regexp compilation error, got %v", err)
 	}
 }
+
+func TestPushAdditionalTags(t *testing.T) {
+	mirrorAuth := api.AuthConfig{Username: "mirror", Password: "secret"}
+	pushAuth := api.AuthConfig{Username: "push", Password: "secret"}
+	builder := newFakeBaseSTI()
+	builder.config = &api.Config{
+		Tag:                "foo/app:v1",
+		AdditionalTags:     []string{"foo/app:latest", "mirror.example.com/foo/app:v1"},
+		PushAuthentication: pushAuth,
+		RegistryAuthentications: map[string]api.AuthConfig{
+			"mirror.example.com": mirrorAuth,
+		},
+	}
+	auths := []api.AuthConfig{}
+	digests := []string{"sha256:aaa", "sha256:bbb"}
+	builder.newTagDocker = func(auth api.AuthConfig) docker.Docker {
+		auths = append(auths, auth)
+		if auth == mirrorAuth {
+			return &docker.FakeDocker{PushError: errors.New("unauthorized")}
+		}
+		return &docker.FakeDocker{PushResult: true, PushDigest: digests[len(auths)-1]}
+	}
+
+	err := builder.push(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "mirror.example.com/foo/app:v1") {
+		t.Fatalf("expected the failed tag to be reported, got %v", err)
+	}
+	if !reflect.DeepEqual(auths, []api.AuthConfig{pushAuth, pushAuth, mirrorAuth}) {
+		t.Errorf("unexpected push authentications %v", auths)
+	}
+	expected := []api.PushInfo{
+		{Tag: "foo/app:v1", Success: true, Digest: "sha256:aaa"},
+		{Tag: "foo/app:latest", Success: true, Digest: "sha256:bbb"},
+		{Tag: "mirror.example.com/foo/app:v1", Error: "unauthorized"},
+	}
+	if !reflect.DeepEqual(builder.result.ResultInfo.Pushes, expected) {
+		t.Errorf("expected pushes %+v, got %+v", expected, builder.result.ResultInfo.Pushes)
+	}
+	if builder.result.ResultInfo.ImageDigest != "sha256:aaa" {
+		t.Errorf("unexpected image digest %q", builder.result.ResultInfo.ImageDigest)
+	}
+	if reason := builder.result.BuildInfo.FailureReason.Reason; reason != utilstatus.ReasonPushAdditionalTagsFailed {
+		t.Errorf("unexpected failure reason %q", reason)
+	}
+}
+
+func TestPushTemplatedTag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s2i-push")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := `{"auths": {"registry.example.com": {"username": "user", "password": "pass"}}}`
+	if err = ioutil.WriteFile(filepath.Join(dir, docker.DockerConfigFile), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keychain, err := docker.LoadKeychain([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("S2I_TEST_REGISTRY", "registry.example.com")
+	defer os.Unsetenv("S2I_TEST_REGISTRY")
+
+	builder := newFakeSTI(&FakeSTI{})
+	builder.ctx = docker.WithKeychain(context.Background(), keychain)
+	builder.config.Tag = "{{.Env.S2I_TEST_REGISTRY}}/foo/app:v1"
+	if err = builder.Prepare(builder.config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	auths := []api.AuthConfig{}
+	builder.newTagDocker = func(auth api.AuthConfig) docker.Docker {
+		auths = append(auths, auth)
+		return &docker.FakeDocker{PushResult: true}
+	}
+	if err = builder.push(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(auths) != 1 || auths[0].Username != "user" || auths[0].Password != "pass" {
+		t.Errorf("expected the expanded tag pushed with the resolved authentication, got %+v", auths)
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s2i-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fakeDocker := &docker.FakeDocker{SaveImageContent: []byte("archive")}
+	builder := newFakeBaseSTI()
+	builder.fs = fs.NewFileSystem()
+	builder.docker = fakeDocker
+	builder.postExecutorStepsContext = &postExecutorStepContext{imageID: "sha256:1234"}
+	builder.config = &api.Config{
+		ExportPath:     filepath.Join(dir, "app.tar.gz"),
+		ExportCompress: true,
+		ExportChecksum: true,
+	}
+	if err = builder.export(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fakeDocker.SaveImageName != "sha256:1234" {
+		t.Errorf("expected the image without tag saved by its ID, got %q", fakeDocker.SaveImageName)
+	}
+	data, err := ioutil.ReadFile(builder.config.ExportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("expected a compressed archive: %v", err)
+	}
+	if content, _ := ioutil.ReadAll(gz); string(content) != "archive" {
+		t.Errorf("unexpected archive content %q", content)
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+	checksum, _ := ioutil.ReadFile(builder.config.ExportPath + ".sha256")
+	if string(checksum) != sum+"  app.tar.gz\n" {
+		t.Errorf("unexpected checksum file %q", checksum)
+	}
+	if info := builder.result.ResultInfo; info.ExportPath != builder.config.ExportPath || info.ExportChecksum != "sha256:"+sum {
+		t.Errorf("unexpected result %+v", info)
+	}
+
+	fakeDocker.SaveImageError = errors.New("no such image")
+	builder.config.Tag = "foo/app"
+	if err = builder.export(context.Background()); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if fakeDocker.SaveImageName != "foo/app" {
+		t.Errorf("expected the image saved by its tag, got %q", fakeDocker.SaveImageName)
+	}
+	if reason := builder.result.BuildInfo.FailureReason.Reason; reason != utilstatus.ReasonExportImageFailed {
+		t.Errorf("unexpected failure reason %q", reason)
+	}
+	if _, err = os.Stat(builder.config.ExportPath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected the incomplete archive removed")
+	}
+}
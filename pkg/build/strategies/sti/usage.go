@@ -1,6 +1,8 @@
 package sti
 
 import (
+	"context"
+
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/api/constants"
 	"github.com/kubesphere/s2irun/pkg/build"
@@ -22,9 +24,10 @@ type Usage struct {
 	config  *api.Config
 }
 
-// NewUsage creates a new instance of the default Usage implementation
-func NewUsage(client docker.Client, config *api.Config) (*Usage, error) {
-	b, err := New(client, config, fs.NewFileSystem(), build.Overrides{})
+// NewUsage creates a new instance of the default Usage implementation. The
+// builder container is killed and removed when ctx is done.
+func NewUsage(ctx context.Context, client docker.Client, config *api.Config) (*Usage, error) {
+	b, err := New(ctx, client, config, fs.NewFileSystem(), build.Overrides{})
 	if err != nil {
 		return nil, err
 	}
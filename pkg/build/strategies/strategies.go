@@ -1,6 +1,7 @@
 package strategies
 
 import (
+	"context"
 	"time"
 
 	"github.com/kubesphere/s2irun/pkg/api"
@@ -10,24 +11,27 @@ import (
 	"github.com/kubesphere/s2irun/pkg/build/strategies/sti"
 	"github.com/kubesphere/s2irun/pkg/docker"
 	"github.com/kubesphere/s2irun/pkg/utils/fs"
+	utilglog "github.com/kubesphere/s2irun/pkg/utils/glog"
 	utilstatus "github.com/kubesphere/s2irun/pkg/utils/status"
 )
 
 // GetStrategy decides what build strategy will be used for the STI build.
 // TODO: deprecated, use Strategy() instead
-func GetStrategy(client docker.Client, config *api.Config) (build.Builder, api.BuildInfo, error) {
-	return Strategy(client, config, build.Overrides{})
+func GetStrategy(ctx context.Context, client docker.Client, config *api.Config) (build.Builder, api.BuildInfo, error) {
+	return Strategy(ctx, client, config, build.Overrides{})
 }
 
 // Strategy creates the appropriate build strategy for the provided config, using
-// the overrides provided. Not all strategies support all overrides.
-func Strategy(client docker.Client, config *api.Config, overrides build.Overrides) (build.Builder, api.BuildInfo, error) {
+// the overrides provided. Not all strategies support all overrides. Pulling
+// the builder image is aborted when ctx is done.
+func Strategy(ctx context.Context, client docker.Client, config *api.Config, overrides build.Overrides) (build.Builder, api.BuildInfo, error) {
 	var builder build.Builder
 	var buildInfo api.BuildInfo
 	var err error
 
 	fileSystem := fs.NewFileSystem()
 
+	utilglog.SetStage(string(api.StagePullImages))
 	startTime := time.Now()
 
 	if len(config.AsDockerfile) != 0 {
@@ -42,18 +46,37 @@ func Strategy(client docker.Client, config *api.Config, overrides build.Override
 		return builder, buildInfo, nil
 	}
 
-	dkr := docker.New(client, config.PullAuthentication, config.PushAuthentication)
-	image, err := docker.GetBuilderImage(dkr, config)
+	dkr := docker.NewForConfig(client, config)
+	image, err := docker.GetBuilderImage(ctx, dkr, config)
 	buildInfo.Stages = api.RecordStageAndStepInfo(buildInfo.Stages, api.StagePullImages, api.StepPullBuilderImage, startTime, time.Now())
 	if err != nil {
 		buildInfo.FailureReason = utilstatus.NewFailureReason(
 			utilstatus.ReasonPullBuilderImageFailed,
 			utilstatus.ReasonMessagePullBuilderImageFailed,
 		)
+		if reason, ok := utilstatus.NewContextFailureReason(ctx); ok {
+			buildInfo.FailureReason = reason
+		}
 		return nil, buildInfo, err
 	}
 	config.HasOnBuild = image.OnBuild
 
+	// The runtime image of an archive is loaded before the builders reference
+	// it by the name it is loaded as. Assembled as OCI layers, it is imported
+	// from the archive by the builder instead.
+	if _, ok := docker.ArchivePath(config.RuntimeImage); ok && !config.OCIAssemble {
+		startTime = time.Now()
+		err = docker.GetRuntimeImage(ctx, dkr, config)
+		buildInfo.Stages = api.RecordStageAndStepInfo(buildInfo.Stages, api.StagePullImages, api.StepPullRuntimeImage, startTime, time.Now())
+		if err != nil {
+			buildInfo.FailureReason = utilstatus.NewFailureReason(
+				utilstatus.ReasonPullRuntimeImageFailed,
+				utilstatus.ReasonMessagePullRuntimeImageFailed,
+			)
+			return nil, buildInfo, err
+		}
+	}
+
 	if config.AssembleUser, err = docker.GetAssembleUser(dkr, config); err != nil {
 		buildInfo.FailureReason = utilstatus.NewFailureReason(
 			utilstatus.ReasonPullBuilderImageFailed,
@@ -65,7 +88,7 @@ func Strategy(client docker.Client, config *api.Config, overrides build.Override
 	// if we're blocking onbuild, just do a normal s2i build flow
 	// which won't do a docker build and invoke the onbuild commands
 	if image.OnBuild && !config.BlockOnBuild {
-		builder, err = onbuild.New(client, config, fileSystem, overrides)
+		builder, err = onbuild.New(ctx, client, config, fileSystem, overrides)
 		if err != nil {
 			buildInfo.FailureReason = utilstatus.NewFailureReason(
 				utilstatus.ReasonGenericS2IBuildFailed,
@@ -76,7 +99,7 @@ func Strategy(client docker.Client, config *api.Config, overrides build.Override
 		return builder, buildInfo, nil
 	}
 
-	builder, err = sti.New(client, config, fileSystem, overrides)
+	builder, err = sti.New(ctx, client, config, fileSystem, overrides)
 	if err != nil {
 		buildInfo.FailureReason = utilstatus.NewFailureReason(
 			utilstatus.ReasonGenericS2IBuildFailed,
@@ -0,0 +1,188 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/api/validation"
+)
+
+// shortCommitLength is the length of the abbreviated commit ID of the tag
+// templates.
+const shortCommitLength = 7
+
+// gitDateLayout is the layout of the commit date reported by git.
+const gitDateLayout = "Mon Jan 2 15:04:05 2006 -0700"
+
+// invalidTagCharacters matches the characters which are not allowed in the tag
+// of an image.
+var invalidTagCharacters = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// TagData holds the variables of the tag templates, such as
+// "myrepo/app:{{.Ref}}-{{.ShortCommit}}". The values are made valid in a tag,
+// the characters not allowed being replaced with "-", except the environment
+// variables used in the name of the image, such as the registry of
+// "{{.Env.REGISTRY}}/app:{{.ShortCommit}}", which are kept as they are.
+type TagData struct {
+	// Ref is the branch, tag or commit the source was fetched from.
+	Ref string
+	// CommitID is the ID of the commit of the source.
+	CommitID string
+	// ShortCommit is the first 7 characters of CommitID.
+	ShortCommit string
+	// Date is the date of the commit, as YYYYMMDD.
+	Date string
+	// BuilderImageVersion is the version of the builder image.
+	BuilderImageVersion string
+	// Env holds the environment variables of s2irun.
+	Env map[string]string
+
+	// rawEnv holds the environment variables of s2irun as they are.
+	rawEnv map[string]string
+}
+
+// NewTagData returns the variables of the tag templates of config, from the
+// information about its source and builder image.
+func NewTagData(config *api.Config) *TagData {
+	data := &TagData{
+		BuilderImageVersion: sanitizeTag(config.BuilderImageVersion),
+		Env:                 map[string]string{},
+		rawEnv:              map[string]string{},
+	}
+	if info := config.SourceInfo; info != nil {
+		data.Ref = sanitizeTag(info.Ref)
+		data.CommitID = sanitizeTag(info.CommitID)
+		data.ShortCommit = data.CommitID
+		if len(data.ShortCommit) > shortCommitLength {
+			data.ShortCommit = data.ShortCommit[:shortCommitLength]
+		}
+		if date, err := time.Parse(gitDateLayout, info.Date); err == nil {
+			data.Date = date.UTC().Format("20060102")
+		} else {
+			data.Date = sanitizeTag(info.Date)
+		}
+	}
+	for _, env := range os.Environ() {
+		if kv := strings.SplitN(env, "=", 2); len(kv) == 2 {
+			data.Env[kv[0]] = sanitizeTag(kv[1])
+			data.rawEnv[kv[0]] = kv[1]
+		}
+	}
+	return data
+}
+
+// sanitizeTag replaces the characters of value which are not allowed in the tag
+// of an image.
+func sanitizeTag(value string) string {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "refs/heads/")
+	value = strings.TrimPrefix(value, "refs/tags/")
+	return invalidTagCharacters.ReplaceAllString(value, "-")
+}
+
+// ExpandTags expands the templates of the tag and the additional tags of config
+// with the information about its source, which is only known once it is
+// downloaded. The expanded tags are normalized and validated like the tags
+// given without templates.
+func ExpandTags(config *api.Config) error {
+	if !validation.IsTagTemplate(config.Tag) && !hasTagTemplate(config.AdditionalTags) {
+		return nil
+	}
+	data := NewTagData(config)
+	tag, err := expandTag(config.Tag, data)
+	if err != nil {
+		return err
+	}
+	if tag != config.Tag {
+		if tag, err = api.Parse(tag, config.PushAuthentication.ServerAddress); err != nil {
+			return err
+		}
+		config.Tag = tag
+	}
+	for i, additionalTag := range config.AdditionalTags {
+		if config.AdditionalTags[i], err = expandTag(additionalTag, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasTagTemplate(tags []string) bool {
+	for _, tag := range tags {
+		if validation.IsTagTemplate(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandTag expands the template of tag with data. A tag without template is
+// returned as it is. The environment variables are sanitized only in the tag
+// component of the image, the part after the last ":" following the last "/".
+func expandTag(tag string, data *TagData) (string, error) {
+	if !validation.IsTagTemplate(tag) {
+		return tag, nil
+	}
+	name, component := splitTagTemplate(tag)
+	raw := *data
+	raw.Env = data.rawEnv
+	expandedName, err := executeTagTemplate(tag, name, &raw)
+	if err != nil {
+		return "", err
+	}
+	expandedComponent, err := executeTagTemplate(tag, component, data)
+	if err != nil {
+		return "", err
+	}
+	expanded := expandedName + expandedComponent
+	if err = validation.ValidateDockerReference(expanded); err != nil {
+		return "", fmt.Errorf("tag template %q expands to the invalid tag %q: %v", tag, expanded, err)
+	}
+	glog.V(1).Infof("Expanded tag template %q to %q", tag, expanded)
+	return expanded, nil
+}
+
+// splitTagTemplate splits the template of tag into the template of the name of
+// the image and that of its tag component, which starts with the last ":"
+// following the last "/" outside of the actions of the template. The tag
+// component is empty when the template has none.
+func splitTagTemplate(tag string) (string, string) {
+	depth, slash, colon := 0, -1, -1
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case strings.HasPrefix(tag[i:], "{{"):
+			depth++
+			i++
+		case strings.HasPrefix(tag[i:], "}}") && depth > 0:
+			depth--
+			i++
+		case depth > 0:
+		case tag[i] == '/':
+			slash = i
+		case tag[i] == ':':
+			colon = i
+		}
+	}
+	if colon == -1 || colon < slash {
+		return tag, ""
+	}
+	return tag[:colon], tag[colon:]
+}
+
+// executeTagTemplate expands text, a part of the template of tag, with data.
+func executeTagTemplate(tag, text string, data *TagData) (string, error) {
+	tmpl, err := template.New("tag").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid tag template %q: %v", tag, err)
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("unable to expand tag template %q: %v", tag, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,101 @@
+package build
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/scm/git"
+)
+
+func TestExpandTags(t *testing.T) {
+	os.Setenv("S2I_TEST_BUILD_NUMBER", "42")
+	defer os.Unsetenv("S2I_TEST_BUILD_NUMBER")
+	os.Setenv("S2I_TEST_REGISTRY", "registry.example.com:5000")
+	defer os.Unsetenv("S2I_TEST_REGISTRY")
+	os.Setenv("S2I_TEST_BRANCH", "feature/login")
+	defer os.Unsetenv("S2I_TEST_BRANCH")
+	sourceInfo := &git.SourceInfo{
+		Ref:      "refs/heads/feature/login",
+		CommitID: "0123456789abcdef0123456789abcdef01234567",
+		Date:     "Tue Mar 3 10:20:30 2020 +0800",
+	}
+
+	tests := []struct {
+		name           string
+		tag            string
+		additionalTags []string
+		expected       string
+		expectedTags   []string
+		expectError    bool
+	}{
+		{
+			name:     "static tag",
+			tag:      "docker.io/foo/app:v1",
+			expected: "docker.io/foo/app:v1",
+		},
+		{
+			name:     "ref and short commit",
+			tag:      "foo/app:{{.Ref}}-{{.ShortCommit}}",
+			expected: "docker.io/foo/app:feature-login-0123456",
+		},
+		{
+			name:           "date, builder version and environment",
+			tag:            "registry.example.com/app:{{.Date}}-{{.BuilderImageVersion}}",
+			additionalTags: []string{"foo/app:{{.CommitID}}", "foo/app:build-{{.Env.S2I_TEST_BUILD_NUMBER}}", "foo/app:latest"},
+			expected:       "registry.example.com/app:20200303-1.2",
+			expectedTags:   []string{"foo/app:0123456789abcdef0123456789abcdef01234567", "foo/app:build-42", "foo/app:latest"},
+		},
+		{
+			name:     "registry from the environment",
+			tag:      "{{.Env.S2I_TEST_REGISTRY}}/app:{{.ShortCommit}}",
+			expected: "registry.example.com:5000/app:0123456",
+		},
+		{
+			name:     "environment in the tag component",
+			tag:      "{{.Env.S2I_TEST_REGISTRY}}/app:{{.Env.S2I_TEST_BRANCH}}",
+			expected: "registry.example.com:5000/app:feature-login",
+		},
+		{
+			name:     "registry without tag component",
+			tag:      "{{.Env.S2I_TEST_REGISTRY}}/app",
+			expected: "registry.example.com:5000/app:latest",
+		},
+		{
+			name:        "missing environment variable",
+			tag:         "foo/app:{{.Env.S2I_TEST_MISSING}}",
+			expectError: true,
+		},
+		{
+			name:        "invalid expanded tag",
+			tag:         "foo/app:-{{.Ref}}",
+			expectError: true,
+		},
+	}
+	for _, tc := range tests {
+		config := &api.Config{
+			Tag:                 tc.tag,
+			AdditionalTags:      tc.additionalTags,
+			BuilderImageVersion: "1.2",
+			SourceInfo:          sourceInfo,
+		}
+		err := ExpandTags(config)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error, got tag %q", tc.name, config.Tag)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if config.Tag != tc.expected {
+			t.Errorf("%s: expected tag %q, got %q", tc.name, tc.expected, config.Tag)
+		}
+		if !reflect.DeepEqual(config.AdditionalTags, tc.expectedTags) {
+			t.Errorf("%s: expected additional tags %v, got %v", tc.name, tc.expectedTags, config.AdditionalTags)
+		}
+	}
+}
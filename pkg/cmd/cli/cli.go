@@ -0,0 +1,61 @@
+// Package cli implements the s2irun command line interface.
+package cli
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kubesphere/s2irun/pkg/cmd/cli/cmd"
+	"github.com/kubesphere/s2irun/pkg/cmd/cli/util"
+)
+
+// NewCmdCLI returns the s2irun root command. Running it without a subcommand
+// builds from the configuration file, like the build subcommand does.
+func NewCmdCLI() *cobra.Command {
+	var configPath string
+	buildCmd := cmd.NewCmdBuild(&configPath)
+	s2irunCmd := &cobra.Command{
+		Use:   "s2irun",
+		Short: "s2irun builds reproducible container images from source code",
+		Long: "s2irun produces ready-to-run images by injecting source code into a builder image\n" +
+			"and assembling a new image. The build is described by the configuration file\n" +
+			"pointed to by the S2I_CONFIG_PATH environment variable or the --config flag,\n" +
+			"and by the flags of the subcommands.",
+		SilenceUsage: true,
+		RunE:         buildCmd.RunE,
+	}
+	util.AddConfigFlag(s2irunCmd, &configPath)
+
+	// Expose the glog flags, such as -v and -logtostderr.
+	s2irunCmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
+	flag.CommandLine.Parse([]string{})
+
+	s2irunCmd.AddCommand(buildCmd)
+	s2irunCmd.AddCommand(cmd.NewCmdRebuild(&configPath))
+	s2irunCmd.AddCommand(cmd.NewCmdUsage(&configPath))
+	s2irunCmd.AddCommand(cmd.NewCmdGenerate(&configPath))
+	s2irunCmd.AddCommand(cmd.NewCmdDescribe(&configPath))
+	s2irunCmd.AddCommand(cmd.NewCmdSchema())
+	s2irunCmd.AddCommand(cmd.NewCmdVersion())
+	return s2irunCmd
+}
+
+// NormalizeArgs rewrites the single dash long glog flags, as in
+// "-logtostderr=true", to their double dash form so the invocations written
+// for the former flag based command line keep working.
+func NormalizeArgs(args []string) []string {
+	normalized := make([]string, len(args))
+	for i, arg := range args {
+		normalized[i] = arg
+		if !strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "--") {
+			continue
+		}
+		name := strings.SplitN(arg[1:], "=", 2)[0]
+		if len(name) > 1 && flag.CommandLine.Lookup(name) != nil {
+			normalized[i] = "-" + arg
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/cmd/cli/util"
+	"github.com/kubesphere/s2irun/pkg/run"
+)
+
+// NewCmdBuild implements the s2irun build command.
+func NewCmdBuild(configPath *string) *cobra.Command {
+	cfg := &api.Config{}
+	buildCmd := &cobra.Command{
+		Use:   "build",
+		Short: "Build a new image",
+		Long: "Build a new image from the application source and the builder image described\n" +
+			"by the configuration file, with the flags overriding the values of the file.",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			config, err := util.LoadConfig(c, *configPath, cfg)
+			if err != nil {
+				return err
+			}
+			return run.S2I(config)
+		},
+	}
+	util.AddCommonFlags(buildCmd, cfg)
+	buildCmd.Flags().StringVar(&cfg.AsDockerfile, "as-dockerfile", "", "Generate a Dockerfile at the given path instead of building an image")
+	util.BindFlag(buildCmd.Flags(), "as-dockerfile", "asDockerfile")
+	return buildCmd
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/cmd/cli/util"
+	"github.com/kubesphere/s2irun/pkg/run"
+)
+
+// NewCmdDescribe implements the s2irun describe command.
+func NewCmdDescribe(configPath *string) *cobra.Command {
+	cfg := &api.Config{}
+	describeCmd := &cobra.Command{
+		Use:   "describe",
+		Short: "Describe the build configuration",
+		Long:  "Print the build configuration, with the flags applied, in a human readable format.",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			config, err := util.LoadConfig(c, *configPath, cfg)
+			if err != nil {
+				return err
+			}
+			description, err := run.Describe(config)
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(c.OutOrStdout(), description)
+			return nil
+		},
+	}
+	util.AddCommonFlags(describeCmd, cfg)
+	return describeCmd
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/cmd/cli/util"
+	"github.com/kubesphere/s2irun/pkg/run"
+)
+
+// NewCmdGenerate implements the s2irun generate command.
+func NewCmdGenerate(configPath *string) *cobra.Command {
+	cfg := &api.Config{}
+	generateCmd := &cobra.Command{
+		Use:   "generate [<dockerfile>]",
+		Short: "Generate a Dockerfile",
+		Long: "Generate a Dockerfile which builds the application source with the builder image,\n" +
+			"instead of building the image. The Dockerfile is written to the given path, or to\n" +
+			"the asDockerfile path of the configuration file.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			config, err := util.LoadConfig(c, *configPath, cfg)
+			if err != nil {
+				return err
+			}
+			if len(args) > 0 {
+				config.AsDockerfile = args[0]
+			}
+			if len(config.AsDockerfile) == 0 {
+				return errors.New("the path of the Dockerfile to generate must be provided")
+			}
+			return run.S2I(config)
+		},
+	}
+	util.AddCommonFlags(generateCmd, cfg)
+	return generateCmd
+}
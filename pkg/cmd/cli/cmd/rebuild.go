@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/cmd/cli/util"
+	"github.com/kubesphere/s2irun/pkg/run"
+)
+
+// NewCmdRebuild implements the s2irun rebuild command.
+func NewCmdRebuild(configPath *string) *cobra.Command {
+	cfg := &api.Config{}
+	rebuildCmd := &cobra.Command{
+		Use:   "rebuild <image> [<new-tag>]",
+		Short: "Rebuild an existing image",
+		Long: "Rebuild an image built previously, from the builder image, source and commit\n" +
+			"recorded in its labels. The new image is tagged with the given tag, the tag of\n" +
+			"the configuration, or the rebuilt image. The source of the configuration is\n" +
+			"used when the labels do not record it.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			config, err := util.LoadConfig(c, *configPath, cfg)
+			if err != nil {
+				return err
+			}
+			if len(args) > 1 {
+				config.Tag = args[1]
+			}
+			return run.Rebuild(config, args[0])
+		},
+	}
+	util.AddCommonFlags(rebuildCmd, cfg)
+	return rebuildCmd
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kubesphere/s2irun/pkg/api/schema"
+)
+
+// NewCmdSchema implements the s2irun schema command.
+func NewCmdSchema() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the configuration file",
+		Long: "Print the JSON Schema of the configuration file, which editors and other tools\n" +
+			"can use to validate configurations before running a build.",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			out, err := json.MarshalIndent(schema.ForConfig(), "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(c.OutOrStdout(), string(out))
+			return nil
+		},
+	}
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/cmd/cli/util"
+	"github.com/kubesphere/s2irun/pkg/run"
+)
+
+// NewCmdUsage implements the s2irun usage command.
+func NewCmdUsage(configPath *string) *cobra.Command {
+	cfg := &api.Config{}
+	usageCmd := &cobra.Command{
+		Use:   "usage [<builder-image>]",
+		Short: "Print the usage of a builder image",
+		Long: "Run the usage script of the builder image, which describes how to use it.\n" +
+			"The builder image is the given one, or the one of the configuration.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			config, err := util.LoadConfig(c, *configPath, cfg)
+			if err != nil {
+				return err
+			}
+			if len(args) > 0 {
+				config.BuilderImage = args[0]
+			}
+			return run.Usage(config)
+		},
+	}
+	util.AddCommonFlags(usageCmd, cfg)
+	return usageCmd
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kubesphere/s2irun/pkg/version"
+)
+
+// NewCmdVersion implements the s2irun version command.
+func NewCmdVersion() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Display version",
+		Long:  "Display version",
+		Args:  cobra.NoArgs,
+		Run: func(c *cobra.Command, args []string) {
+			info := version.Get()
+			out := c.OutOrStdout()
+			fmt.Fprintf(out, "s2irun %v\n", info)
+			fmt.Fprintf(out, "Git commit: %s\n", info.GitCommit)
+			fmt.Fprintf(out, "Build date: %s\n", info.BuildDate)
+			fmt.Fprintf(out, "Go version: %s\n", info.GoVersion)
+			fmt.Fprintf(out, "Platform: %s\n", info.Platform)
+		},
+	}
+}
@@ -0,0 +1,283 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/docker"
+	"github.com/kubesphere/s2irun/pkg/run"
+)
+
+// configFieldAnnotation is the flag annotation holding the JSON path of the
+// api.Config field the flag is bound to.
+const configFieldAnnotation = "s2irun/config-field"
+
+// AddConfigFlag adds the flag pointing at the build configuration file. It
+// defaults to the value of the S2I_CONFIG_PATH environment variable.
+func AddConfigFlag(c *cobra.Command, path *string) {
+	c.PersistentFlags().StringVarP(path, "config", "c", os.Getenv(run.ConfigEnvVariable), "Path to the build configuration file, in JSON or YAML format, or \"-\" to read it from the standard input")
+}
+
+// AddCommonFlags adds the flags shared by the commands which operate on a
+// build configuration. Every flag is bound to the api.Config field it sets.
+func AddCommonFlags(c *cobra.Command, cfg *api.Config) {
+	if cfg.DockerConfig == nil {
+		cfg.DockerConfig = docker.GetDefaultDockerConfig()
+	}
+	f := c.Flags()
+
+	f.StringVar(&cfg.BuilderImage, "builder-image", "", "Image used to build the application, or archive:PATH of its archive")
+	BindFlag(f, "builder-image", "builderImage")
+	f.StringVarP(&cfg.Tag, "tag", "t", "", "Name of the output image")
+	BindFlag(f, "tag", "tag")
+	f.StringVar(&cfg.SourceURL, "source-url", "", "Location of the application source, either a git repository or a binary URL")
+	BindFlag(f, "source-url", "sourceURL")
+	f.BoolVar(&cfg.IsBinaryURL, "is-binary-url", false, "Treat the source URL as a binary to download instead of a git repository")
+	BindFlag(f, "is-binary-url", "isBinaryURL")
+	f.StringVarP(&cfg.RevisionId, "revision-id", "r", "", "Git branch, tag or commit to build")
+	BindFlag(f, "revision-id", "revisionId")
+	f.StringVar(&cfg.GitAuthentication.Username, "git-username", "", "Username of the HTTPS git source, along with the password or token of the config file")
+	BindFlag(f, "git-username", "gitAuthentication.username")
+	f.StringVar(&cfg.GitAuthentication.SSHKeyPath, "git-ssh-key", "", "Private key of the SSH git source")
+	BindFlag(f, "git-ssh-key", "gitAuthentication.sshKeyPath")
+	f.StringVar(&cfg.GitAuthentication.KnownHostsPath, "git-known-hosts", "", "known_hosts file the host key of the SSH git source is checked against")
+	BindFlag(f, "git-known-hosts", "gitAuthentication.knownHostsPath")
+	f.StringVar(&cfg.SourceRefspec, "source-refspec", "", "Git ref to fetch and build instead of the revision, such as refs/pull/42/head")
+	BindFlag(f, "source-refspec", "sourceRefspec")
+	f.StringVar(&cfg.MergeInto, "merge-into", "", "Build the merge of the source refspec into this branch")
+	BindFlag(f, "merge-into", "mergeInto")
+	f.StringVar(&cfg.ContextDir, "context-dir", "", "Sub-directory of the source repository to build")
+	BindFlag(f, "context-dir", "contextDir")
+	f.StringVar(&cfg.DisplayName, "display-name", "", "Human friendly name of the application")
+	BindFlag(f, "display-name", "displayName")
+	f.StringVar(&cfg.Description, "description", "", "Description of the application")
+	BindFlag(f, "description", "description")
+
+	f.Var(&cfg.BuilderPullPolicy, "builder-pull-policy", "When to pull the builder image (always, never or if-not-present)")
+	BindFlag(f, "builder-pull-policy", "builderPullPolicy")
+	f.Var(&cfg.PreviousImagePullPolicy, "previous-image-pull-policy", "When to pull the previous image for incremental builds (always, never or if-not-present)")
+	BindFlag(f, "previous-image-pull-policy", "previousImagePullPolicy")
+	f.StringVar(&cfg.RuntimeImage, "runtime-image", "", "Image used to run the application artifacts, or archive:PATH of its archive")
+	BindFlag(f, "runtime-image", "runtimeImage")
+	f.Var(&cfg.RuntimeImagePullPolicy, "runtime-image-pull-policy", "When to pull the runtime image (always, never or if-not-present)")
+	BindFlag(f, "runtime-image-pull-policy", "runtimeImagePullPolicy")
+	f.VarP(&cfg.RuntimeArtifacts, "runtime-artifact", "a", "Artifact to copy into the runtime image, as \"source:destination\"")
+	BindFlag(f, "runtime-artifact", "runtimeArtifacts")
+	f.BoolVar(&cfg.OCIAssemble, "oci-assemble", false, "Assemble the image from the runtime image as OCI layers, without running or committing a container")
+	BindFlag(f, "oci-assemble", "ociAssemble")
+	f.StringVar(&cfg.OCILayoutPath, "oci-layout", "", "Directory of the OCI image layout the assembled image is written to")
+	BindFlag(f, "oci-layout", "ociLayoutPath")
+	f.StringVar(&cfg.OCIArtifactsDir, "oci-artifacts-dir", "", "Local directory holding the builder output to assemble with the runtime image when generating a Dockerfile")
+	BindFlag(f, "oci-artifacts-dir", "ociArtifactsDir")
+
+	f.BoolVar(&cfg.Incremental, "incremental", false, "Reuse the artifacts of the previous image")
+	BindFlag(f, "incremental", "incremental")
+	f.StringVar(&cfg.IncrementalFromTag, "incremental-from-tag", "", "Image to take the previous artifacts from, instead of the output image")
+	BindFlag(f, "incremental-from-tag", "incrementalFromTag")
+	f.BoolVar(&cfg.RemovePreviousImage, "remove-previous-image", false, "Remove the previous image after an incremental build")
+	BindFlag(f, "remove-previous-image", "removePreviousImage")
+
+	f.VarP(&cfg.Environment, "env", "e", "Environment variable to pass to the build, as \"NAME=value\"")
+	BindFlag(f, "env", "environment")
+	f.StringToStringVar(&cfg.Labels, "labels", nil, "Labels to set on the output image, as \"name=value\"")
+	BindFlag(f, "labels", "labels")
+	f.VarP(&cfg.Injections, "inject", "i", "Directory to inject into the assemble container, as \"source:destination\"")
+	BindFlag(f, "inject", "injections")
+	f.StringVarP(&cfg.ScriptsURL, "scripts-url", "s", "", "URL of the S2I scripts, overriding the builder image ones")
+	BindFlag(f, "scripts-url", "scriptsURL")
+	f.StringVar(&cfg.CallbackURL, "callback-url", "", "URL to notify with the build result")
+	BindFlag(f, "callback-url", "callbackURL")
+	f.StringVarP(&cfg.Destination, "destination", "d", "", "Location in the builder image to place the scripts and sources")
+	BindFlag(f, "destination", "destination")
+	f.StringVar(&cfg.AssembleUser, "assemble-user", "", "User to run the assemble script as")
+	BindFlag(f, "assemble-user", "assembleUser")
+	f.VarP(&cfg.AllowedUIDs, "allowed-uids", "u", "User ID ranges the builder image is allowed to run as, such as \"1-\" or \"5-10,20-\"")
+	BindFlag(f, "allowed-uids", "allowedUIDs")
+	f.StringVar(&cfg.ExcludeRegExp, "exclude", "", "Regular expression of the files excluded from the source")
+	BindFlag(f, "exclude", "excludeRegExp")
+
+	f.StringVar((*string)(&cfg.DockerNetworkMode), "network", "", "Network mode of the build containers")
+	BindFlag(f, "network", "dockerNetworkMode")
+	f.StringSliceVar(&cfg.DropCapabilities, "cap-drop", nil, "Linux capabilities to drop from the build containers")
+	BindFlag(f, "cap-drop", "dropCapabilities")
+	f.StringSliceVar(&cfg.SecurityOpt, "security-opt", nil, "Security options of the build containers")
+	BindFlag(f, "security-opt", "securityOpt")
+	f.StringSliceVar(&cfg.AddHost, "add-host", nil, "Custom host-to-IP mappings, as \"host:ip\"")
+	BindFlag(f, "add-host", "addHost")
+	f.StringArrayVar(&cfg.BuildVolumes, "build-volume", nil, "Volume to bind mount into the build containers, as \"source:destination\"")
+	BindFlag(f, "build-volume", "buildVolumes")
+
+	f.BoolVarP(&cfg.Quiet, "quiet", "q", false, "Suppress the output of the assemble script")
+	BindFlag(f, "quiet", "quiet")
+	f.BoolVar(&cfg.ForceCopy, "force-copy", false, "Copy the source instead of cloning a local git repository")
+	BindFlag(f, "force-copy", "forceCopy")
+	f.BoolVar(&cfg.IgnoreSubmodules, "ignore-submodules", false, "Do not fetch the git submodules")
+	BindFlag(f, "ignore-submodules", "ignoreSubmodules")
+	f.IntVar(&cfg.CloneDepth, "clone-depth", 0, "Clone this number of commits of the source history, 0 for the whole history")
+	BindFlag(f, "clone-depth", "cloneDepth")
+	f.BoolVar(&cfg.CloneSingleBranch, "clone-single-branch", false, "Clone the history of the branch or tag of the revision only")
+	BindFlag(f, "clone-single-branch", "cloneSingleBranch")
+	f.BoolVar(&cfg.ClonePartial, "clone-partial", false, "Clone the source without the content of the files, fetched when checked out")
+	BindFlag(f, "clone-partial", "clonePartial")
+	f.BoolVar(&cfg.CloneSparse, "clone-sparse", false, "Check out the context directory of the source only")
+	BindFlag(f, "clone-sparse", "cloneSparse")
+	f.BoolVar(&cfg.DisableGitLFS, "disable-git-lfs", false, "Do not pull the files of the source stored in Git LFS")
+	BindFlag(f, "disable-git-lfs", "disableGitLFS")
+	f.StringVar(&cfg.GitCacheDir, "git-cache-dir", "", "Directory of the mirrors of the git sources shared by the builds")
+	BindFlag(f, "git-cache-dir", "gitCacheDir")
+	f.BoolVar(&cfg.KeepSymlinks, "keep-symlinks", false, "Copy symlinks as symlinks when the source is a local directory")
+	BindFlag(f, "keep-symlinks", "keepSymlinks")
+	f.BoolVar(&cfg.BlockOnBuild, "block-on-build", false, "Fail the build if the builder image has ONBUILD instructions")
+	BindFlag(f, "block-on-build", "blockOnBuild")
+	f.BoolVar(&cfg.PreserveWorkingDir, "preserve-working-dir", false, "Do not remove the temporary working directory")
+	BindFlag(f, "preserve-working-dir", "preserveWorkingDir")
+	f.BoolVar(&cfg.Export, "export", false, "Push the output image after the build")
+	BindFlag(f, "export", "export")
+	f.StringVar(&cfg.ExportPath, "export-path", "", "Save the output image to this archive file")
+	BindFlag(f, "export-path", "exportPath")
+	f.StringVar((*string)(&cfg.ExportFormat), "export-format", "", "Format of the archive the output image is saved to (docker-archive or oci-archive)")
+	BindFlag(f, "export-format", "exportFormat")
+	f.BoolVar(&cfg.ExportCompress, "export-compress", false, "Compress the archive the output image is saved to with gzip")
+	BindFlag(f, "export-compress", "exportCompress")
+	f.BoolVar(&cfg.ExportChecksum, "export-checksum", false, "Write the SHA-256 checksum of the archive to a .sha256 file next to it")
+	BindFlag(f, "export-checksum", "exportChecksum")
+	f.BoolVar(&cfg.OutputBuildResult, "output-build-result", false, "Record the build result on the annotations of the running pod")
+	BindFlag(f, "output-build-result", "outputBuildResult")
+	f.BoolVar(&cfg.PullByDigest, "pull-by-digest", false, "Reference the pushed image by its digest in the pull command of the build result")
+	BindFlag(f, "pull-by-digest", "pullByDigest")
+	f.StringSliceVar(&cfg.AdditionalTags, "additional-tag", nil, "Additional tags of the output image, also pushed with --export")
+	BindFlag(f, "additional-tag", "additionalTags")
+	f.StringSliceVar(&cfg.DockerConfigPaths, "docker-config", nil, "Docker config files or directories to resolve the registry credentials from, ~/.docker/config.json by default")
+	BindFlag(f, "docker-config", "dockerConfigPaths")
+	f.Var(&cfg.RegistryMirrors, "registry-mirror", "Pull the images of a registry from a mirror first, as REGISTRY=MIRROR such as docker.io=mirror.example.com, falling back to the registry")
+	BindFlag(f, "registry-mirror", "registryMirrors")
+	f.StringSliceVar(&cfg.InsecureRegistries, "insecure-registry", nil, "Registries served over plain HTTP to the OCI image assembly")
+	BindFlag(f, "insecure-registry", "insecureRegistries")
+	f.IntVar(&cfg.PullRetryCount, "pull-retry-count", 0, "Number of times a failed pull is retried, 6 when 0 and none when negative")
+	BindFlag(f, "pull-retry-count", "pullRetryCount")
+	f.Int64Var(&cfg.PullRetryDelaySeconds, "pull-retry-delay-seconds", 0, "Delay before the first retry of a failed pull, 5 seconds when 0")
+	BindFlag(f, "pull-retry-delay-seconds", "pullRetryDelaySeconds")
+	f.Float64Var(&cfg.PullRetryBackoff, "pull-retry-backoff", 0, "Multiply the delay between the retries of a failed pull by this factor after each retry")
+	BindFlag(f, "pull-retry-backoff", "pullRetryBackoff")
+	f.StringSliceVar(&cfg.PullRetriableErrors, "pull-retriable-error", nil, "Retry the pulls failing with an error containing this text, in addition to the network errors")
+	BindFlag(f, "pull-retriable-error", "pullRetriableErrors")
+	f.Int64Var(&cfg.BuildDeadlineSeconds, "build-deadline-seconds", 0, "Abort the build and remove its containers after this many seconds, 0 for no deadline")
+	BindFlag(f, "build-deadline-seconds", "buildDeadlineSeconds")
+	f.StringVar(&cfg.BuildResultPath, "build-result-path", "", "Write the build result as JSON to this file, - for the standard output")
+	BindFlag(f, "build-result-path", "buildResultPath")
+	f.StringVar(&cfg.MetricsAddress, "metrics-address", "", "Serve the Prometheus metrics of the build on this address at /metrics")
+	BindFlag(f, "metrics-address", "metricsAddress")
+	f.Int64Var(&cfg.MetricsGracePeriodSeconds, "metrics-grace-period-seconds", 0, "Keep serving the metrics for this many seconds once the build completes")
+	BindFlag(f, "metrics-grace-period-seconds", "metricsGracePeriodSeconds")
+	f.StringVar(&cfg.MetricsTextfilePath, "metrics-textfile-path", "", "Write the Prometheus metrics of the build to this file once it completes")
+	BindFlag(f, "metrics-textfile-path", "metricsTextfilePath")
+	f.StringVar(&cfg.TracingEndpoint, "tracing-endpoint", "", "Export the trace spans of the build to this OTLP/HTTP endpoint")
+	BindFlag(f, "tracing-endpoint", "tracingEndpoint")
+	f.StringVar(&cfg.TracingFilePath, "tracing-file-path", "", "Write the trace spans of the build to this file in the OTLP JSON encoding")
+	BindFlag(f, "tracing-file-path", "tracingFilePath")
+	f.StringVar(&cfg.LogFormat, "log-format", "", "Format of the log records, text or json")
+	BindFlag(f, "log-format", "logFormat")
+
+	f.StringVarP(&cfg.DockerConfig.Endpoint, "url", "U", cfg.DockerConfig.Endpoint, "Docker daemon endpoint")
+	BindFlag(f, "url", "dockerConfig.endpoint")
+	f.StringVar((*string)(&cfg.DockerConfig.Engine), "engine", string(cfg.DockerConfig.Engine), "Container engine serving the endpoint (docker or podman)")
+	BindFlag(f, "engine", "dockerConfig.engine")
+	f.StringVar(&cfg.DockerConfig.CertFile, "cert", cfg.DockerConfig.CertFile, "Certificate file for the Docker daemon TLS connection")
+	BindFlag(f, "cert", "dockerConfig.certFile")
+	f.StringVar(&cfg.DockerConfig.KeyFile, "key", cfg.DockerConfig.KeyFile, "Key file for the Docker daemon TLS connection")
+	BindFlag(f, "key", "dockerConfig.keyFile")
+	f.StringVar(&cfg.DockerConfig.CAFile, "ca", cfg.DockerConfig.CAFile, "Certificate authority file for the Docker daemon TLS connection")
+	BindFlag(f, "ca", "dockerConfig.caFile")
+	f.BoolVar(&cfg.DockerConfig.UseTLS, "tls", cfg.DockerConfig.UseTLS, "Use TLS to connect to the Docker daemon")
+	BindFlag(f, "tls", "dockerConfig.useTLS")
+	f.BoolVar(&cfg.DockerConfig.TLSVerify, "tlsverify", cfg.DockerConfig.TLSVerify, "Use TLS and verify the Docker daemon certificate")
+	BindFlag(f, "tlsverify", "dockerConfig.tlsVerify")
+}
+
+// BindFlag records the JSON path of the api.Config field the flag is bound to.
+func BindFlag(f *pflag.FlagSet, name, field string) {
+	if err := f.SetAnnotation(name, configFieldAnnotation, []string{field}); err != nil {
+		panic(err)
+	}
+}
+
+// LoadConfig returns the build configuration of the command. It is read from
+// the configuration file at path, if any, then overridden by the S2I_*
+// environment variables and by the flags which were explicitly set on the
+// command line, whose values are stored in flagCfg. The Docker connection
+// which is not configured is the default one, as with the flags.
+func LoadConfig(c *cobra.Command, path string, flagCfg *api.Config) (*api.Config, error) {
+	cfg := &api.Config{}
+	var err error
+	if len(path) > 0 {
+		cfg, err = run.LoadConfig(path)
+	} else {
+		err = run.ApplyEnvironment(cfg, os.Environ())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = ApplyFlags(c.Flags(), flagCfg, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.DockerConfig == nil {
+		cfg.DockerConfig = docker.GetDefaultDockerConfig()
+	}
+	return cfg, run.CompleteConfig(cfg)
+}
+
+// ApplyFlags copies the value of every config flag which was explicitly set
+// from src into dst.
+func ApplyFlags(flags *pflag.FlagSet, src, dst *api.Config) error {
+	var err error
+	flags.Visit(func(flag *pflag.Flag) {
+		fields := flag.Annotations[configFieldAnnotation]
+		if err != nil || len(fields) == 0 {
+			return
+		}
+		err = copyField(reflect.ValueOf(src).Elem(), reflect.ValueOf(dst).Elem(), strings.Split(fields[0], "."))
+	})
+	return err
+}
+
+// copyField copies the field at the given JSON path from src to dst, which
+// must be structs of the same type. Nil struct pointers on the path in dst
+// are replaced by a copy of the src value.
+func copyField(src, dst reflect.Value, path []string) error {
+	for _, name := range path {
+		if src.Kind() == reflect.Ptr {
+			if src.IsNil() {
+				return nil
+			}
+			if dst.IsNil() {
+				dst.Set(reflect.New(src.Type().Elem()))
+				dst.Elem().Set(src.Elem())
+			}
+			src, dst = src.Elem(), dst.Elem()
+		}
+		i := fieldIndex(src.Type(), name)
+		if i < 0 {
+			return fmt.Errorf("%s has no field %q", src.Type(), name)
+		}
+		src, dst = src.Field(i), dst.Field(i)
+	}
+	dst.Set(src)
+	return nil
+}
+
+// fieldIndex returns the index of the field of t whose JSON name is name, or
+// -1 if there is none.
+func fieldIndex(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == name {
+			return i
+		}
+	}
+	return -1
+}
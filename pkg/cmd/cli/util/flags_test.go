@@ -0,0 +1,101 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+)
+
+func TestLoadConfigFlagsOverrideFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s2irun-flags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	content := `{
+		"builderImage": "file/builder",
+		"tag": "file/app:1",
+		"sourceURL": "https://github.com/kubesphere/s2irun.git",
+		"environment": [{"name": "FROM", "value": "file"}],
+		"dockerConfig": {"endpoint": "tcp://file:2375", "useTLS": true}
+	}`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		expect func(*api.Config) bool
+	}{
+		{
+			name: "file values are kept",
+			expect: func(cfg *api.Config) bool {
+				return cfg.BuilderImage == "file/builder" && cfg.Tag == "docker.io/file/app:1" && cfg.DockerConfig.Endpoint == "tcp://file:2375"
+			},
+		},
+		{
+			name: "string flags override the file",
+			args: []string{"--builder-image", "flag/builder", "-t", "flag/app:2"},
+			expect: func(cfg *api.Config) bool {
+				return cfg.BuilderImage == "flag/builder" && cfg.Tag == "docker.io/flag/app:2"
+			},
+		},
+		{
+			name: "pflag values override the file",
+			args: []string{"-e", "FROM=flag", "--builder-pull-policy", "never"},
+			expect: func(cfg *api.Config) bool {
+				return reflect.DeepEqual(cfg.Environment, api.EnvironmentList{{Name: "FROM", Value: "flag"}}) &&
+					cfg.BuilderPullPolicy == api.PullNever
+			},
+		},
+		{
+			name: "nested flags keep the other file values",
+			args: []string{"--url", "tcp://flag:2375"},
+			expect: func(cfg *api.Config) bool {
+				return cfg.DockerConfig.Endpoint == "tcp://flag:2375" && cfg.DockerConfig.UseTLS
+			},
+		},
+	}
+	for _, tc := range tests {
+		cfg := &api.Config{}
+		c := &cobra.Command{}
+		AddCommonFlags(c, cfg)
+		if err := c.Flags().Parse(tc.args); err != nil {
+			t.Fatalf("%s: unexpected error parsing flags: %v", tc.name, err)
+		}
+		got, err := LoadConfig(c, path, cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !tc.expect(got) {
+			t.Errorf("%s: unexpected config %#v", tc.name, got)
+		}
+	}
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	cfg := &api.Config{}
+	c := &cobra.Command{}
+	AddCommonFlags(c, cfg)
+	if err := c.Flags().Parse([]string{"--builder-image", "flag/builder", "--cap-drop", "KILL,MKNOD"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadConfig(c, "", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BuilderImage != "flag/builder" || !reflect.DeepEqual(got.DropCapabilities, []string{"KILL", "MKNOD"}) {
+		t.Errorf("unexpected config %#v", got)
+	}
+	if got.DockerConfig == nil || len(got.DockerConfig.Endpoint) == 0 {
+		t.Errorf("expected the default Docker configuration, got %#v", got.DockerConfig)
+	}
+}
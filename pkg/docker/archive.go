@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/oci"
+)
+
+// ArchiveScheme prefixes the references to the images supplied as archives,
+// such as archive:/path/builder.tar, rather than pulled from a registry.
+const ArchiveScheme = "archive:"
+
+// ArchivePath returns the path of the archive referenced by image, and
+// whether image references an archive.
+func ArchivePath(image string) (string, bool) {
+	if !strings.HasPrefix(image, ArchiveScheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(image, ArchiveScheme), true
+}
+
+// LoadArchiveImage loads into the engine the image of the archive at path, of
+// docker save or of an OCI image layout, possibly gzipped, and returns its tag,
+// or its ID when it has none. An OCI image layout is converted to the format of
+// docker save through a temporary layout.
+func LoadArchiveImage(ctx context.Context, d Docker, path string) (string, error) {
+	format, err := oci.ReadArchiveFormat(path)
+	if err != nil {
+		return "", err
+	}
+	var images []string
+	if format == api.DockerArchiveFormat {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		images, err = d.LoadImage(ctx, f)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		dir, err := ioutil.TempDir("", "s2i-archive")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(dir)
+		layout, err := oci.NewLayout(dir)
+		if err != nil {
+			return "", err
+		}
+		image, err := oci.ImportArchive(layout, path)
+		if err != nil {
+			return "", err
+		}
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(oci.WriteDockerArchive(writer, layout, image, nil))
+		}()
+		images, err = d.LoadImage(ctx, reader)
+		reader.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(images) != 1 {
+		return "", fmt.Errorf("expected the archive %s to hold one image, got %v", path, images)
+	}
+	glog.V(1).Infof("Loaded image %s from the archive %s", images[0], path)
+	return images[0], nil
+}
+
+// loadArchiveImage loads the image referenced by *image when it is an archive,
+// and replaces the reference with the loaded image, which is never pulled.
+func loadArchiveImage(ctx context.Context, d Docker, image *string, pullPolicy *api.PullPolicy) error {
+	path, ok := ArchivePath(*image)
+	if !ok {
+		return nil
+	}
+	loaded, err := LoadArchiveImage(ctx, d, path)
+	if err != nil {
+		return fmt.Errorf("unable to load the image archive %s: %v", path, err)
+	}
+	*image = loaded
+	*pullPolicy = api.PullNever
+	return nil
+}
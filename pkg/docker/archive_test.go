@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/oci"
+)
+
+func TestGetBuilderImageFromArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s2i-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	layout, err := oci.NewLayout(filepath.Join(dir, "layout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "assemble"), []byte("#!/bin/sh"), 0700)
+	image, err := oci.Assemble(layout, &oci.Image{}, oci.AssembleOptions{
+		Files: map[string]string{"/usr/libexec/s2i/assemble": filepath.Join(dir, "assemble")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dockerArchive bytes.Buffer
+	if err = oci.WriteDockerArchive(&dockerArchive, layout, image, []string{"builder:latest"}); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "builder.tar"), dockerArchive.Bytes(), 0600)
+	var ociArchive bytes.Buffer
+	gz := gzip.NewWriter(&ociArchive)
+	if err = oci.WriteOCIArchive(gz, layout, image, "builder"); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	ioutil.WriteFile(filepath.Join(dir, "builder-oci.tar.gz"), ociArchive.Bytes(), 0600)
+
+	tests := []struct {
+		name      string
+		archive   string
+		converted bool
+	}{
+		{name: "docker archive", archive: "builder.tar"},
+		{name: "compressed OCI archive", archive: "builder-oci.tar.gz", converted: true},
+	}
+	for _, tc := range tests {
+		fakeDocker := &FakeDocker{LoadImageResult: []string{"sha256:1234"}}
+		config := &api.Config{
+			BuilderImage:      ArchiveScheme + filepath.Join(dir, tc.archive),
+			BuilderPullPolicy: api.PullAlways,
+		}
+		if _, err = GetBuilderImage(context.Background(), fakeDocker, config); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if config.BuilderImage != "sha256:1234" || config.BuilderPullPolicy != api.PullNever {
+			t.Errorf("%s: expected the loaded image never pulled, got %s pulled %s", tc.name, config.BuilderImage, config.BuilderPullPolicy)
+		}
+		if !tc.converted {
+			if !bytes.Equal(fakeDocker.LoadImageContent, dockerArchive.Bytes()) {
+				t.Errorf("%s: expected the archive loaded as is", tc.name)
+			}
+			continue
+		}
+		imported, err := oci.NewLayout(filepath.Join(dir, "imported"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		images, err := oci.ImportDockerArchive(imported, bytes.NewReader(fakeDocker.LoadImageContent))
+		if err != nil || len(images) != 1 || images[0].Manifest.Config.Digest != image.Manifest.Config.Digest {
+			t.Errorf("%s: expected the image loaded as a docker archive, got %+v, %v", tc.name, images, err)
+		}
+	}
+
+	config := &api.Config{BuilderImage: ArchiveScheme + filepath.Join(dir, "missing.tar"), BuilderPullPolicy: api.PullIfNotPresent}
+	if _, err = GetBuilderImage(context.Background(), &FakeDocker{}, config); err == nil {
+		t.Errorf("expected an error for a missing archive")
+	}
+}
@@ -0,0 +1,405 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/distribution/reference"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/api/validation"
+	"github.com/kubesphere/s2irun/pkg/utils"
+	"github.com/kubesphere/s2irun/pkg/utils/cmd"
+)
+
+// The files holding the credentials of the registries.
+const (
+	// DockerConfigFile is the configuration file of the Docker CLI.
+	DockerConfigFile = "config.json"
+	// DockerConfigJSONFile is the key holding the credentials in a Kubernetes
+	// secret of the kubernetes.io/dockerconfigjson type.
+	DockerConfigJSONFile = ".dockerconfigjson"
+	// DockerCfgFile is the key holding the credentials in a Kubernetes secret
+	// of the kubernetes.io/dockercfg type, in the legacy format.
+	DockerCfgFile = ".dockercfg"
+)
+
+const (
+	// credentialHelperPrefix is the prefix of the executables of the
+	// credential helpers, such as docker-credential-pass.
+	credentialHelperPrefix = "docker-credential-"
+	// identityTokenUsername is the username returned by the credential
+	// helpers along with an identity token instead of a password.
+	identityTokenUsername = "<token>"
+	// dockerHubHost is the host the Docker Hub credentials are matched with.
+	dockerHubHost = "docker.io"
+)
+
+// AuthResolver resolves the authentication to use for an image.
+type AuthResolver interface {
+	// Resolve returns the authentication of image, and false when it has
+	// none.
+	Resolve(image string) (api.AuthConfig, bool)
+}
+
+// ImageAuths holds the authentication of specific images, by repository.
+type ImageAuths map[string]api.AuthConfig
+
+// NewImageAuths returns the authentications given in config for its builder,
+// runtime and previous images.
+func NewImageAuths(config *api.Config) ImageAuths {
+	auths := ImageAuths{}
+	auths.Add(config.BuilderImage, config.PullAuthentication)
+	auths.Add(config.RuntimeImage, config.RuntimeAuthentication)
+	if config.Incremental {
+		auths.Add(utils.FirstNonEmpty(config.IncrementalFromTag, config.Tag), config.IncrementalAuthentication)
+	}
+	return auths
+}
+
+// Add sets the authentication of the repository of image, unless auth is empty
+// or the repository already has one.
+func (a ImageAuths) Add(image string, auth api.AuthConfig) {
+	repository := imageRepository(image)
+	if len(repository) == 0 || auth == (api.AuthConfig{}) {
+		return
+	}
+	if _, exists := a[repository]; !exists {
+		a[repository] = auth
+	}
+}
+
+// Resolve returns the authentication of the repository of image.
+func (a ImageAuths) Resolve(image string) (api.AuthConfig, bool) {
+	auth, ok := a[imageRepository(image)]
+	return auth, ok
+}
+
+// imageRepository returns the normalized repository of image, without its tag
+// or digest, or an empty string when image is not a valid reference.
+func imageRepository(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+	return named.Name()
+}
+
+// Keychain resolves the credentials of the registries from Docker config files
+// and docker-credential-* helpers, by registry host.
+type Keychain struct {
+	// auths holds the credentials of the config files by registry host.
+	auths map[string]api.AuthConfig
+	// credsStore is the helper storing the credentials of all the registries.
+	credsStore string
+	// credHelpers holds the helpers of specific registries by host.
+	credHelpers map[string]string
+	runner      cmd.CommandRunner
+}
+
+// dockerConfigFile is the content of a Docker config file.
+type dockerConfigFile struct {
+	Auths       map[string]dockerConfig `json:"auths"`
+	CredsStore  string                  `json:"credsStore"`
+	CredHelpers map[string]string       `json:"credHelpers"`
+}
+
+// helperCredentials are the credentials returned by a credential helper.
+type helperCredentials struct {
+	Username string
+	Secret   string
+}
+
+// DefaultDockerConfigPaths returns the existing Docker config files of the
+// user: $DOCKER_CONFIG/config.json, or ~/.docker/config.json, and the legacy
+// ~/.dockercfg.
+func DefaultDockerConfigPaths() []string {
+	candidates := []string{}
+	if dir := os.Getenv("DOCKER_CONFIG"); len(dir) > 0 {
+		candidates = append(candidates, filepath.Join(dir, DockerConfigFile))
+	} else if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, ".docker", DockerConfigFile))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, DockerCfgFile))
+	}
+	paths := []string{}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// LoadKeychain returns the keychain holding the credentials of the given
+// Docker config files. A path can also be a directory holding a config.json,
+// such as $DOCKER_CONFIG, or the mount of a Kubernetes secret holding a
+// .dockerconfigjson or a .dockercfg. The credentials of the first paths take
+// precedence.
+func LoadKeychain(paths []string) (*Keychain, error) {
+	k := &Keychain{
+		auths:       map[string]api.AuthConfig{},
+		credHelpers: map[string]string{},
+		runner:      cmd.NewCommandRunner(),
+	}
+	for _, path := range paths {
+		file, err := dockerConfigFilePath(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err = k.add(data); err != nil {
+			return nil, fmt.Errorf("unable to load the Docker config %s: %v", file, err)
+		}
+		glog.V(3).Infof("Loaded the registry credentials of %s", file)
+	}
+	return k, nil
+}
+
+// dockerConfigFilePath returns the config file at path, or in the directory at
+// path.
+func dockerConfigFilePath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return path, nil
+	}
+	for _, name := range []string{DockerConfigFile, DockerConfigJSONFile, DockerCfgFile} {
+		file := filepath.Join(path, name)
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("no %s, %s or %s found in %s", DockerConfigFile, DockerConfigJSONFile, DockerCfgFile, path)
+}
+
+// add adds the credentials of a Docker config file, in the current or the
+// legacy format, without replacing those already in the keychain.
+func (k *Keychain) add(data []byte) error {
+	var file dockerConfigFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	if len(file.Auths) == 0 && len(file.CredsStore) == 0 && len(file.CredHelpers) == 0 {
+		// legacy .dockercfg, holding the auths only
+		if err := json.Unmarshal(data, &file.Auths); err != nil {
+			return err
+		}
+	}
+	for registry, conf := range file.Auths {
+		auth, err := conf.authConfig(registry)
+		if err != nil {
+			return err
+		}
+		host := normalizeRegistryHost(registry)
+		if _, exists := k.auths[host]; !exists && auth != (api.AuthConfig{ServerAddress: registry}) {
+			k.auths[host] = auth
+		}
+	}
+	if len(k.credsStore) == 0 {
+		k.credsStore = file.CredsStore
+	}
+	for registry, helper := range file.CredHelpers {
+		host := normalizeRegistryHost(registry)
+		if _, exists := k.credHelpers[host]; !exists {
+			k.credHelpers[host] = helper
+		}
+	}
+	return nil
+}
+
+// authConfig returns the credentials of a registry of a Docker config file.
+func (c dockerConfig) authConfig(registry string) (api.AuthConfig, error) {
+	auth := api.AuthConfig{
+		Username:      c.Username,
+		Password:      c.Password,
+		Email:         c.Email,
+		IdentityToken: c.IdentityToken,
+		ServerAddress: registry,
+	}
+	if len(c.Auth) > 0 {
+		data, err := base64.StdEncoding.DecodeString(c.Auth)
+		if err != nil {
+			return auth, err
+		}
+		userpass := strings.SplitN(string(data), ":", 2)
+		if len(userpass) != 2 {
+			return auth, fmt.Errorf("cannot parse username/password of %s", registry)
+		}
+		auth.Username, auth.Password = userpass[0], userpass[1]
+	}
+	return auth, nil
+}
+
+// Resolve returns the credentials of the registry of image. The helper of the
+// registry takes precedence over the credentials of the config files, which
+// take precedence over the credentials store.
+func (k *Keychain) Resolve(image string) (api.AuthConfig, bool) {
+	if k == nil {
+		return api.AuthConfig{}, false
+	}
+	host := imageRegistryHost(image)
+	if helper, ok := k.credHelpers[host]; ok {
+		return k.helperAuth(helper, host)
+	}
+	if auth, ok := k.auths[host]; ok {
+		glog.V(5).Infof("Using the %s credentials of the Docker config for %s", host, image)
+		return auth, true
+	}
+	if len(k.credsStore) > 0 {
+		return k.helperAuth(k.credsStore, host)
+	}
+	return api.AuthConfig{}, false
+}
+
+// helperAuth returns the credentials of the registry at host stored by the
+// given credential helper.
+func (k *Keychain) helperAuth(helper, host string) (api.AuthConfig, bool) {
+	serverURL := host
+	if host == dockerHubHost {
+		serverURL = defaultRegistry
+	}
+	var stdout, stderr bytes.Buffer
+	opts := cmd.CommandOpts{Stdin: strings.NewReader(serverURL), Stdout: &stdout, Stderr: &stderr}
+	if err := k.runner.RunWithOptions(opts, credentialHelperPrefix+helper, "get"); err != nil {
+		output := strings.TrimSpace(stdout.String() + stderr.String())
+		if !strings.Contains(output, "credentials not found") {
+			glog.Warningf("Unable to get the credentials of %s from %s%s: %v %s", host, credentialHelperPrefix, helper, err, output)
+		}
+		return api.AuthConfig{}, false
+	}
+	var creds helperCredentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		glog.Warningf("Invalid credentials of %s returned by %s%s: %v", host, credentialHelperPrefix, helper, err)
+		return api.AuthConfig{}, false
+	}
+	glog.V(5).Infof("Using the %s credentials of %s%s", host, credentialHelperPrefix, helper)
+	auth := api.AuthConfig{Username: creds.Username, Password: creds.Secret, ServerAddress: serverURL}
+	if creds.Username == identityTokenUsername {
+		auth = api.AuthConfig{IdentityToken: creds.Secret, ServerAddress: serverURL}
+	}
+	return auth, true
+}
+
+// normalizeRegistryHost returns the host of a registry as found in the Docker
+// config files, such as "https://registry.example.com/v1/", the Docker Hub
+// registries all being "docker.io".
+func normalizeRegistryHost(registry string) string {
+	host := strings.ToLower(registry)
+	if i := strings.Index(host, "://"); i != -1 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexRune(host, '/'); i != -1 {
+		host = host[:i]
+	}
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return dockerHubHost
+	}
+	return host
+}
+
+// imageRegistryHost returns the host of the registry of image. The host of a
+// tag template is its first component, when it looks like a host.
+func imageRegistryHost(image string) string {
+	if named, err := reference.ParseNormalizedNamed(image); err == nil {
+		return normalizeRegistryHost(reference.Domain(named))
+	}
+	if i := strings.IndexRune(image, '/'); i != -1 {
+		host := image[:i]
+		if !strings.Contains(host, "{{") && (strings.ContainsAny(host, ".:") || host == "localhost") {
+			return normalizeRegistryHost(host)
+		}
+	}
+	return dockerHubHost
+}
+
+// ResolveAuthentications sets the authentications of config which are not
+// given to the credentials of the keychain matching the registry of each
+// image: the builder, runtime and previous images, the tag, the additional
+// tags and the registry mirrors of the builder and runtime images. The tags
+// which are templates are left to ResolvePushAuthentications, once expanded.
+func ResolveAuthentications(config *api.Config, keychain *Keychain) {
+	resolveAuthentication(&config.PullAuthentication, config.BuilderImage, keychain)
+	resolveAuthentication(&config.RuntimeAuthentication, config.RuntimeImage, keychain)
+	for _, image := range []string{config.BuilderImage, config.RuntimeImage} {
+		for _, mirror := range mirrorImages(config.RegistryMirrors, image) {
+			resolveRegistryAuthentication(config, mirror, keychain)
+		}
+	}
+	ResolvePushAuthentications(config, keychain)
+}
+
+// ResolvePushAuthentications sets the authentications of the tag, the
+// additional tags and the previous image of config which are not given to the
+// credentials of the keychain matching their registry. It is called again once
+// the templates of the tags are expanded, as their registry is only known then.
+func ResolvePushAuthentications(config *api.Config, keychain *Keychain) {
+	resolveAuthentication(&config.PushAuthentication, config.Tag, keychain)
+	if config.Incremental {
+		resolveAuthentication(&config.IncrementalAuthentication, utils.FirstNonEmpty(config.IncrementalFromTag, config.Tag), keychain)
+	}
+	for _, tag := range config.AdditionalTags {
+		resolveRegistryAuthentication(config, tag, keychain)
+	}
+}
+
+// resolveAuthentication sets auth, when not given, to the credentials of the
+// keychain matching the registry of image.
+func resolveAuthentication(auth *api.AuthConfig, image string, keychain *Keychain) {
+	if _, ok := ArchivePath(image); ok || len(image) == 0 || validation.IsTagTemplate(image) || *auth != (api.AuthConfig{}) {
+		return
+	}
+	if found, ok := keychain.Resolve(image); ok {
+		*auth = found
+	}
+}
+
+// resolveRegistryAuthentication sets the authentication of the registry of
+// image in config.RegistryAuthentications, when not given, to the credentials
+// of the keychain matching it.
+func resolveRegistryAuthentication(config *api.Config, image string, keychain *Keychain) {
+	if validation.IsTagTemplate(image) {
+		return
+	}
+	registry := imageRegistryHost(image)
+	if registry == dockerHubHost {
+		registry = defaultRegistry
+	}
+	if _, exists := config.RegistryAuthentications[registry]; exists {
+		return
+	}
+	if found, ok := keychain.Resolve(image); ok {
+		if config.RegistryAuthentications == nil {
+			config.RegistryAuthentications = map[string]api.AuthConfig{}
+		}
+		config.RegistryAuthentications[registry] = found
+	}
+}
+
+type keychainKey struct{}
+
+// WithKeychain returns a copy of ctx holding keychain, which resolves the
+// credentials of the tags expanded during the build.
+func WithKeychain(ctx context.Context, keychain *Keychain) context.Context {
+	return context.WithValue(ctx, keychainKey{}, keychain)
+}
+
+// KeychainFromContext returns the keychain held by ctx, if any.
+func KeychainFromContext(ctx context.Context) (*Keychain, bool) {
+	keychain, ok := ctx.Value(keychainKey{}).(*Keychain)
+	return keychain, ok && keychain != nil
+}
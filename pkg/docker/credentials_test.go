@@ -0,0 +1,126 @@
+package docker
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+)
+
+func writeFile(t *testing.T, path, content string, mode os.FileMode) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeychain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s2i-keychain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a credential helper answering for helper.example.com only
+	writeFile(t, filepath.Join(dir, "bin", "docker-credential-test"), `#!/bin/sh
+read server
+if [ "$server" = "helper.example.com" ]; then
+	echo '{"ServerURL":"helper.example.com","Username":"<token>","Secret":"identity"}'
+	exit 0
+fi
+echo "credentials not found in native keychain"
+exit 1
+`, 0755)
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", filepath.Join(dir, "bin")+string(os.PathListSeparator)+path)
+
+	hubAuth := base64.StdEncoding.EncodeToString([]byte("hubuser:hubpass"))
+	writeFile(t, filepath.Join(dir, "docker", DockerConfigFile), `{
+	"auths": {
+		"https://index.docker.io/v1/": {"auth": "`+hubAuth+`"},
+		"https://registry.example.com": {"username": "user", "password": "pass"}
+	},
+	"credHelpers": {"helper.example.com": "test"}
+}`, 0600)
+	secretAuth := base64.StdEncoding.EncodeToString([]byte("secretuser:secretpass"))
+	writeFile(t, filepath.Join(dir, "secret", DockerConfigJSONFile), `{
+	"auths": {
+		"registry.example.com": {"auth": "`+secretAuth+`"},
+		"quay.io": {"auth": "`+secretAuth+`"}
+	}
+}`, 0600)
+
+	keychain, err := LoadKeychain([]string{filepath.Join(dir, "docker"), filepath.Join(dir, "secret")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		image    string
+		expected api.AuthConfig
+		found    bool
+	}{
+		{"centos/ruby-25-centos7", api.AuthConfig{Username: "hubuser", Password: "hubpass", ServerAddress: "https://index.docker.io/v1/"}, true},
+		{"registry.example.com/foo/app:v1", api.AuthConfig{Username: "user", Password: "pass", ServerAddress: "https://registry.example.com"}, true},
+		{"quay.io/foo/app", api.AuthConfig{Username: "secretuser", Password: "secretpass", ServerAddress: "quay.io"}, true},
+		{"helper.example.com/foo/app", api.AuthConfig{IdentityToken: "identity", ServerAddress: "helper.example.com"}, true},
+		{"helper.example.com/foo/app:{{.ShortCommit}}", api.AuthConfig{IdentityToken: "identity", ServerAddress: "helper.example.com"}, true},
+		{"unknown.example.com/foo/app", api.AuthConfig{}, false},
+	}
+	for _, tc := range tests {
+		auth, found := keychain.Resolve(tc.image)
+		if found != tc.found || auth != tc.expected {
+			t.Errorf("%s: expected %+v (%v), got %+v (%v)", tc.image, tc.expected, tc.found, auth, found)
+		}
+	}
+
+	config := &api.Config{
+		BuilderImage:       "centos/ruby-25-centos7",
+		Tag:                "registry.example.com/foo/app:v1",
+		PullAuthentication: api.AuthConfig{Username: "given"},
+		AdditionalTags:     []string{"quay.io/foo/app:v1", "foo/app:latest"},
+		RegistryMirrors:    api.RegistryMirrors{"docker.io": {"helper.example.com/hub"}},
+	}
+	ResolveAuthentications(config, keychain)
+	if config.PullAuthentication.Username != "given" {
+		t.Errorf("the given pull authentication should be kept, got %+v", config.PullAuthentication)
+	}
+	if config.PushAuthentication.Username != "user" {
+		t.Errorf("unexpected push authentication %+v", config.PushAuthentication)
+	}
+	if config.RegistryAuthentications["quay.io"].Username != "secretuser" || config.RegistryAuthentications[defaultRegistry].Username != "hubuser" {
+		t.Errorf("unexpected registry authentications %+v", config.RegistryAuthentications)
+	}
+	if GetImageRegistryAuth(&AuthConfigurations{Configs: config.RegistryAuthentications}, "foo/app:latest").Username != "hubuser" {
+		t.Errorf("the resolved Docker Hub authentication should be found for the additional tag")
+	}
+	if config.RegistryAuthentications["helper.example.com"].IdentityToken != "identity" {
+		t.Errorf("the authentication of the registry mirror should be resolved, got %+v", config.RegistryAuthentications)
+	}
+
+	// The registry of a tag template is only known once it is expanded.
+	config = &api.Config{
+		BuilderImage:   "centos/ruby-25-centos7",
+		Tag:            "{{.Env.REGISTRY}}/foo/app:v1",
+		AdditionalTags: []string{"{{.Env.REGISTRY}}/foo/app:latest"},
+	}
+	ResolveAuthentications(config, keychain)
+	if config.PushAuthentication != (api.AuthConfig{}) || len(config.RegistryAuthentications) > 0 {
+		t.Errorf("the tag templates should not be resolved, got %+v and %+v", config.PushAuthentication, config.RegistryAuthentications)
+	}
+	config.Tag = "quay.io/foo/app:v1"
+	config.AdditionalTags = []string{"quay.io/foo/app:latest"}
+	ResolvePushAuthentications(config, keychain)
+	if config.PushAuthentication.Username != "secretuser" || config.RegistryAuthentications["quay.io"].Username != "secretuser" {
+		t.Errorf("the expanded tags should be resolved, got %+v and %+v", config.PushAuthentication, config.RegistryAuthentications)
+	}
+
+	if _, err = LoadKeychain([]string{filepath.Join(dir, "bin")}); err == nil {
+		t.Errorf("expected an error loading a directory without Docker config")
+	}
+}
@@ -13,9 +13,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"syscall"
 	"time"
 
 	dockertypes "github.com/docker/docker/api/types"
@@ -30,10 +28,11 @@ import (
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/api/constants"
 	s2ierr "github.com/kubesphere/s2irun/pkg/errors"
+	"github.com/kubesphere/s2irun/pkg/metrics"
 	s2itar "github.com/kubesphere/s2irun/pkg/tar"
 	"github.com/kubesphere/s2irun/pkg/utils"
 	"github.com/kubesphere/s2irun/pkg/utils/fs"
-	"github.com/kubesphere/s2irun/pkg/utils/interrupt"
+	utilglog "github.com/kubesphere/s2irun/pkg/utils/glog"
 )
 
 const (
@@ -93,24 +92,27 @@ type Docker interface {
 	IsImageOnBuild(string) bool
 	GetOnBuild(string) ([]string, error)
 	RemoveContainer(id string) error
-	GetScriptsURL(name string) (string, error)
-	GetAssembleInputFiles(string) (string, error)
-	RunContainer(opts RunContainerOptions) error
+	GetScriptsURL(ctx context.Context, name string) (string, error)
+	GetAssembleInputFiles(ctx context.Context, name string) (string, error)
+	RunContainer(ctx context.Context, opts RunContainerOptions) error
 	GetImageID(name string) (string, error)
 	GetImageWorkdir(name string) (string, error)
-	CommitContainer(opts CommitContainerOptions) (string, error)
+	CommitContainer(ctx context.Context, opts CommitContainerOptions) (string, error)
 	RemoveImage(name string) error
+	TagImage(name, tag string) error
 	CheckImage(name string) (*api.Image, error)
-	PullImage(name string) (*api.Image, error)
-	PushImage(name string) error
-	CheckAndPullImage(name string) (*api.Image, error)
-	BuildImage(opts BuildImageOptions) error
+	PullImage(ctx context.Context, name string) (*api.Image, error)
+	PushImage(ctx context.Context, name string) (string, error)
+	SaveImage(ctx context.Context, name string, w io.Writer) error
+	LoadImage(ctx context.Context, r io.Reader) ([]string, error)
+	CheckAndPullImage(ctx context.Context, name string) (*api.Image, error)
+	BuildImage(ctx context.Context, opts BuildImageOptions) error
 	GetImageUser(name string) (string, error)
 	GetImageEntrypoint(name string) ([]string, error)
 	GetLabels(name string) (map[string]string, error)
-	UploadToContainer(fs fs.FileSystem, srcPath, destPath, container string) error
-	UploadToContainerWithTarWriter(fs fs.FileSystem, srcPath, destPath, container string, makeTarWriter func(io.Writer) s2itar.Writer) error
-	DownloadFromContainer(containerPath string, w io.Writer, container string) error
+	UploadToContainer(ctx context.Context, fs fs.FileSystem, srcPath, destPath, container string) error
+	UploadToContainerWithTarWriter(ctx context.Context, fs fs.FileSystem, srcPath, destPath, container string, makeTarWriter func(io.Writer) s2itar.Writer) error
+	DownloadFromContainer(ctx context.Context, containerPath string, w io.Writer, container string) error
 	Version() (dockertypes.Version, error)
 	CheckReachable() error
 	InspectImage(name string) (*dockertypes.ImageInspect, error)
@@ -133,6 +135,9 @@ type Client interface {
 	ImagePull(ctx context.Context, ref string, options dockertypes.ImagePullOptions) (io.ReadCloser, error)
 	ImagePush(ctx context.Context, ref string, options dockertypes.ImagePushOptions) (io.ReadCloser, error)
 	ImageRemove(ctx context.Context, image string, options dockertypes.ImageRemoveOptions) ([]dockertypes.ImageDeleteResponseItem, error)
+	ImageSave(ctx context.Context, images []string) (io.ReadCloser, error)
+	ImageLoad(ctx context.Context, input io.Reader, quiet bool) (dockertypes.ImageLoadResponse, error)
+	ImageTag(ctx context.Context, image, ref string) error
 	ServerVersion(ctx context.Context) (dockertypes.Version, error)
 }
 
@@ -140,6 +145,14 @@ type stiDocker struct {
 	client   Client
 	pullAuth dockertypes.AuthConfig
 	pushAuth dockertypes.AuthConfig
+	// pullAuths resolves the authentication of the images which are not
+	// pulled with pullAuth.
+	pullAuths AuthResolver
+	// registryAuths holds the authentication of the registry mirrors, by
+	// registry as in api.Config.RegistryAuthentications.
+	registryAuths map[string]api.AuthConfig
+	mirrors       api.RegistryMirrors
+	retry         RetryPolicy
 }
 
 // InspectImage returns the image information and its raw representation.
@@ -315,22 +328,57 @@ func NewEngineAPIClient(config *api.DockerConfig) (*dockerapi.Client, error) {
 // New creates a new implementation of the STI Docker interface
 func New(client Client, pullAuth api.AuthConfig, pushAuth api.AuthConfig) Docker {
 	return &stiDocker{
-		client: client,
-		pullAuth: dockertypes.AuthConfig{
-			Username:      pullAuth.Username,
-			Password:      pullAuth.Password,
-			Email:         pullAuth.Email,
-			ServerAddress: pullAuth.ServerAddress,
-		},
-		pushAuth: dockertypes.AuthConfig{
-			Username:      pushAuth.Username,
-			Password:      pushAuth.Password,
-			Email:         pushAuth.Email,
-			ServerAddress: pushAuth.ServerAddress,
-		},
+		client:   client,
+		pullAuth: toDockerAuth(pullAuth),
+		pushAuth: toDockerAuth(pushAuth),
 	}
 }
 
+// NewWithAuthResolver creates a new implementation of the STI Docker interface
+// pulling the images resolved by pullAuths with their own authentication, and
+// the other images with pullAuth.
+func NewWithAuthResolver(client Client, pullAuth api.AuthConfig, pushAuth api.AuthConfig, pullAuths AuthResolver) Docker {
+	return &stiDocker{
+		client:    client,
+		pullAuth:  toDockerAuth(pullAuth),
+		pushAuth:  toDockerAuth(pushAuth),
+		pullAuths: pullAuths,
+	}
+}
+
+// NewForConfig creates a new implementation of the STI Docker interface pulling
+// the builder, runtime and previous images of config with the authentication
+// given for each of them, through the registry mirrors and with the retries of
+// config, and pushing with the push authentication.
+func NewForConfig(client Client, config *api.Config) Docker {
+	d := NewWithAuthResolver(client, config.PullAuthentication, config.PushAuthentication, NewImageAuths(config)).(*stiDocker)
+	d.registryAuths = config.RegistryAuthentications
+	d.mirrors = config.RegistryMirrors
+	d.retry = RetryPolicyForConfig(config)
+	return d
+}
+
+func toDockerAuth(auth api.AuthConfig) dockertypes.AuthConfig {
+	return dockertypes.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		Email:         auth.Email,
+		ServerAddress: auth.ServerAddress,
+		IdentityToken: auth.IdentityToken,
+	}
+}
+
+// pullAuthFor returns the authentication to pull the image with the
+// specified name.
+func (d *stiDocker) pullAuthFor(name string) dockertypes.AuthConfig {
+	if d.pullAuths != nil {
+		if auth, ok := d.pullAuths.Resolve(name); ok {
+			return toDockerAuth(auth)
+		}
+	}
+	return d.pullAuth
+}
+
 func getDefaultContext() (context.Context, context.CancelFunc) {
 	// the intention is: all docker API calls with the exception of known long-
 	// running calls (ContainerWait, ImagePull, ImageBuild, ImageCommit) must complete within a
@@ -374,12 +422,12 @@ func (d *stiDocker) GetImageEntrypoint(name string) ([]string, error) {
 }
 
 // UploadToContainer uploads artifacts to the container.
-func (d *stiDocker) UploadToContainer(fs fs.FileSystem, src, dest, container string) error {
+func (d *stiDocker) UploadToContainer(ctx context.Context, fs fs.FileSystem, src, dest, container string) error {
 	makeWorldWritable := func(writer io.Writer) s2itar.Writer {
 		return s2itar.ChmodAdapter{Writer: tar.NewWriter(writer), NewFileMode: 0666, NewExecFileMode: 0666, NewDirMode: 0777}
 	}
 
-	return d.UploadToContainerWithTarWriter(fs, src, dest, container, makeWorldWritable)
+	return d.UploadToContainerWithTarWriter(ctx, fs, src, dest, container, makeWorldWritable)
 }
 
 // UploadToContainerWithTarWriter uploads artifacts to the container.
@@ -387,7 +435,7 @@ func (d *stiDocker) UploadToContainer(fs fs.FileSystem, src, dest, container str
 // the destination (which has to be directory as well).
 // If the source is a single file, then the file copied into destination (which
 // has to be full path to a file inside the container).
-func (d *stiDocker) UploadToContainerWithTarWriter(fs fs.FileSystem, src, dest, container string, makeTarWriter func(io.Writer) s2itar.Writer) error {
+func (d *stiDocker) UploadToContainerWithTarWriter(ctx context.Context, fs fs.FileSystem, src, dest, container string, makeTarWriter func(io.Writer) s2itar.Writer) error {
 	destPath := filepath.Dir(dest)
 	r, w := io.Pipe()
 	go func() {
@@ -402,7 +450,7 @@ func (d *stiDocker) UploadToContainerWithTarWriter(fs fs.FileSystem, src, dest,
 		w.CloseWithError(err)
 	}()
 	glog.V(3).Infof("Uploading %q to %q ...", src, destPath)
-	ctx, cancel := getDefaultContext()
+	ctx, cancel := context.WithTimeout(ctx, DefaultDockerTimeout)
 	defer cancel()
 	err := d.client.CopyToContainer(ctx, container, destPath, r, dockertypes.CopyToContainerOptions{})
 	if err != nil {
@@ -412,8 +460,8 @@ func (d *stiDocker) UploadToContainerWithTarWriter(fs fs.FileSystem, src, dest,
 }
 
 // DownloadFromContainer downloads file (or directory) from the container.
-func (d *stiDocker) DownloadFromContainer(containerPath string, w io.Writer, container string) error {
-	ctx, cancel := getDefaultContext()
+func (d *stiDocker) DownloadFromContainer(ctx context.Context, containerPath string, w io.Writer, container string) error {
+	ctx, cancel := context.WithTimeout(ctx, DefaultDockerTimeout)
 	defer cancel()
 	readCloser, _, err := d.client.CopyFromContainer(ctx, container, containerPath)
 	if err != nil {
@@ -478,7 +526,7 @@ func (d *stiDocker) GetOnBuild(name string) ([]string, error) {
 
 // CheckAndPullImage pulls an image into the local registry if not present
 // and returns the image metadata
-func (d *stiDocker) CheckAndPullImage(name string) (*api.Image, error) {
+func (d *stiDocker) CheckAndPullImage(ctx context.Context, name string) (*api.Image, error) {
 	name = getImageName(name)
 	displayName := name
 
@@ -500,7 +548,7 @@ func (d *stiDocker) CheckAndPullImage(name string) (*api.Image, error) {
 	}
 	if image == nil {
 		glog.V(1).Infof("Image %q not available locally, pulling ...", displayName)
-		return d.PullImage(name)
+		return d.PullImage(ctx, name)
 	}
 
 	glog.V(3).Infof("Using locally available image %q", displayName)
@@ -532,20 +580,63 @@ func base64EncodeAuth(auth dockertypes.AuthConfig) (string, error) {
 	return base64.URLEncoding.EncodeToString(buf.Bytes()), nil
 }
 
-// PullImage pulls an image into the local registry
-func (d *stiDocker) PullImage(name string) (*api.Image, error) {
+// PullImage pulls an image into the local registry. The pull, and the retries
+// of a failed pull, are aborted when ctx is done. An image pulled from a mirror
+// is tagged with its name, unless it is referenced by digest, which cannot be
+// tagged; it is then returned as pulled from the mirror.
+func (d *stiDocker) PullImage(ctx context.Context, name string) (*api.Image, error) {
 	name = getImageName(name)
 
-	// RegistryAuth is the base64 encoded credentials for the registry
-	base64Auth, err := base64EncodeAuth(d.pullAuth)
+	source := api.ImageSourceInfo{Image: name}
+	pulled := name
+	for _, mirror := range mirrorImages(d.mirrors, name) {
+		err := d.pullImage(ctx, mirror, toDockerAuth(registryAuth(d.registryAuths, mirror)))
+		if err == nil && !isDigested(name) {
+			err = d.TagImage(mirror, name)
+		}
+		if err == nil {
+			source.Source = mirror
+			pulled = mirror
+			break
+		}
+		glog.Warningf("Failed to pull image %q from the mirror %q, falling back: %v", name, mirror, err)
+		source.FailedMirrors = append(source.FailedMirrors, mirror)
+	}
+	if len(source.Source) == 0 {
+		if err := d.pullImage(ctx, name, d.pullAuthFor(name)); err != nil {
+			recordImageSource(ctx, source)
+			return nil, err
+		}
+		source.Source = name
+	}
+	recordImageSource(ctx, source)
+
+	inspectResp, err := d.InspectImage(pulled)
 	if err != nil {
 		return nil, s2ierr.NewPullImageError(name, err)
 	}
-	var retriableError = false
+	if inspectResp != nil {
+		image := &api.Image{}
+		updateImageWithInspect(image, inspectResp)
+		return image, nil
+	}
+	return nil, nil
+}
+
+// pullImage pulls the image with the specified name with auth, retrying the
+// retriable errors of the retry policy.
+func (d *stiDocker) pullImage(ctx context.Context, name string, auth dockertypes.AuthConfig) error {
+	// RegistryAuth is the base64 encoded credentials for the registry
+	base64Auth, err := base64EncodeAuth(auth)
+	if err != nil {
+		return s2ierr.NewPullImageError(name, err)
+	}
 
-	for retries := 0; retries <= DefaultPullRetryCount; retries++ {
+	for retries := 0; ; retries++ {
+		progress := layerProgress{}
+		reporter := utilglog.NewProgressReporter(glog, "pull", name)
 		err = utils.TimeoutAfter(DefaultDockerTimeout, fmt.Sprintf("pulling image %q", name), func(timer *time.Timer) error {
-			resp, pullErr := d.client.ImagePull(context.Background(), name, dockertypes.ImagePullOptions{RegistryAuth: base64Auth})
+			resp, pullErr := d.client.ImagePull(ctx, name, dockertypes.ImagePullOptions{RegistryAuth: base64Auth})
 			if pullErr != nil {
 				return pullErr
 			}
@@ -571,42 +662,28 @@ func (d *stiDocker) PullImage(name string) (*api.Image, error) {
 					return msg.Error
 				}
 				if msg.Progress != nil {
-					if msg.Progress.Current != 0 {
-						glog.V(0).Infof("pulling image %s: %s", name, msg.Progress.String())
-					}
+					progress.update(&msg, pullProgressStatus)
+					reporter.Update(uint64(progress.total()), 0)
 				}
 			}
 		})
+		reporter.Done()
+		metrics.AddImageBytes(metrics.Pull, progress.total())
 		if err == nil {
-			break
+			return nil
 		}
 		glog.V(0).Infof("pulling image error : %v", err)
-		errMsg := fmt.Sprintf("%s", err)
-		for _, errorString := range RetriableErrors {
-			if strings.Contains(errMsg, errorString) {
-				retriableError = true
-				break
-			}
+		if retries >= d.retry.retries() || !d.retry.retriable(err) {
+			return s2ierr.NewPullImageError(name, err)
 		}
 
-		if !retriableError {
-			return nil, s2ierr.NewPullImageError(name, err)
+		metrics.IncImageRetries(metrics.Pull)
+		delay := d.retry.delay(retries)
+		glog.V(0).Infof("retrying in %s ...", delay)
+		if err = sleep(ctx, delay); err != nil {
+			return s2ierr.NewPullImageError(name, err)
 		}
-
-		glog.V(0).Infof("retrying in %s ...", DefaultPullRetryDelay)
-		time.Sleep(DefaultPullRetryDelay)
-	}
-
-	inspectResp, err := d.InspectImage(name)
-	if err != nil {
-		return nil, s2ierr.NewPullImageError(name, err)
 	}
-	if inspectResp != nil {
-		image := &api.Image{}
-		updateImageWithInspect(image, inspectResp)
-		return image, nil
-	}
-	return nil, nil
 }
 
 func updateImageWithInspect(image *api.Image, inspect *dockertypes.ImageInspect) {
@@ -625,17 +702,23 @@ func updateImageWithInspect(image *api.Image, inspect *dockertypes.ImageInspect)
 	}
 }
 
-func (d *stiDocker) PushImage(name string) error {
+// PushImage pushes an image to its registry and returns the digest of the
+// manifest the registry stored, as reported by the daemon. The push, and the
+// retries of a failed push, are aborted when ctx is done.
+func (d *stiDocker) PushImage(ctx context.Context, name string) (string, error) {
 	name = getImageName(name)
 	base64Auth, err := base64EncodeAuth(d.pushAuth)
 	if err != nil {
-		return s2ierr.NewPushImageError(name, err)
+		return "", s2ierr.NewPushImageError(name, err)
 	}
 	retriableError := false
+	digest := ""
 	glog.V(0).Infof("Begin to push image <%s>", name)
 	for retries := 0; retries <= DefaultPushRetryCount; retries++ {
+		progress := layerProgress{}
+		reporter := utilglog.NewProgressReporter(glog, "push", name)
 		err = utils.TimeoutAfter(DefaultDockerTimeout, fmt.Sprintf("pushing image %q", name), func(timer *time.Timer) error {
-			resp, pushErr := d.client.ImagePush(context.Background(), name, dockertypes.ImagePushOptions{RegistryAuth: base64Auth})
+			resp, pushErr := d.client.ImagePush(ctx, name, dockertypes.ImagePushOptions{RegistryAuth: base64Auth})
 			if pushErr != nil {
 				return pushErr
 			}
@@ -662,12 +745,19 @@ func (d *stiDocker) PushImage(name string) error {
 				}
 
 				if msg.Progress != nil {
-					if msg.Progress.Current != 0 {
-						glog.V(0).Infof("pushing image %s: %s", name, msg.Progress.String())
+					progress.update(&msg, pushProgressStatus)
+					reporter.Update(uint64(progress.total()), 0)
+				}
+				if msg.Aux != nil {
+					var result dockertypes.PushResult
+					if auxErr := json.Unmarshal(*msg.Aux, &result); auxErr == nil && len(result.Digest) > 0 {
+						digest = result.Digest
 					}
 				}
 			}
 		})
+		reporter.Done()
+		metrics.AddImageBytes(metrics.Push, progress.total())
 		if err == nil {
 			break
 		}
@@ -681,17 +771,63 @@ func (d *stiDocker) PushImage(name string) error {
 		}
 
 		if !retriableError {
-			return s2ierr.NewPushImageError(name, err)
+			return "", s2ierr.NewPushImageError(name, err)
 		}
 
+		metrics.IncImageRetries(metrics.Push)
 		glog.V(0).Infof("retrying in %s ...", DefaultPullRetryDelay)
-		time.Sleep(DefaultPullRetryDelay)
+		if err = sleep(ctx, DefaultPullRetryDelay); err != nil {
+			return "", s2ierr.NewPushImageError(name, err)
+		}
 	}
-	glog.V(0).Info("pushing image succeed")
 	if err != nil {
-		return s2ierr.NewPushImageError(name, err)
+		return "", s2ierr.NewPushImageError(name, err)
+	}
+	glog.V(0).Infof("pushing image succeed, digest: %s", digest)
+	return digest, nil
+}
+
+// The statuses of the progress messages reporting the transfer of a layer.
+const (
+	pullProgressStatus = "Downloading"
+	pushProgressStatus = "Pushing"
+)
+
+// layerProgress holds the bytes transferred for each layer of an image, as
+// reported by the progress messages of a pull or a push.
+type layerProgress map[string]int64
+
+// update records the progress of msg if it reports the transfer of a layer
+// with the given status.
+func (p layerProgress) update(msg *dockermessage.JSONMessage, status string) {
+	if msg.Progress == nil || msg.Status != status || len(msg.ID) == 0 {
+		return
+	}
+	if msg.Progress.Current > p[msg.ID] {
+		p[msg.ID] = msg.Progress.Current
+	}
+}
+
+// total returns the bytes transferred for all the layers.
+func (p layerProgress) total() int64 {
+	var total int64
+	for _, n := range p {
+		total += n
+	}
+	return total
+}
+
+// sleep waits for the given duration, returning early with the error of ctx
+// when it is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return nil
 }
 
 // RemoveContainer removes a container and its associated volumes.
@@ -754,9 +890,10 @@ func getVariable(image *api.Image, name string) string {
 	return ""
 }
 
-// GetScriptsURL finds a scripts-url label on the given image.
-func (d *stiDocker) GetScriptsURL(image string) (string, error) {
-	imageMetadata, err := d.CheckAndPullImage(image)
+// GetScriptsURL finds a scripts-url label on the given image. Pulling the image
+// is aborted when ctx is done.
+func (d *stiDocker) GetScriptsURL(ctx context.Context, image string) (string, error) {
+	imageMetadata, err := d.CheckAndPullImage(ctx, image)
 	if err != nil {
 		return "", err
 	}
@@ -765,8 +902,9 @@ func (d *stiDocker) GetScriptsURL(image string) (string, error) {
 }
 
 // GetAssembleInputFiles finds a io.openshift.s2i.assemble-input-files label on the given image.
-func (d *stiDocker) GetAssembleInputFiles(image string) (string, error) {
-	imageMetadata, err := d.CheckAndPullImage(image)
+// Pulling the image is aborted when ctx is done.
+func (d *stiDocker) GetAssembleInputFiles(ctx context.Context, image string) (string, error) {
+	imageMetadata, err := d.CheckAndPullImage(ctx, image)
 	if err != nil {
 		return "", err
 	}
@@ -965,8 +1103,9 @@ func (d *stiDocker) holdHijackedConnection(tty bool, opts *RunContainerOptions,
 
 // RunContainer creates and starts a container using the image specified in opts
 // with the ability to stream input and/or output.  Any non-nil
-// opts.Std{in,out,err} will be closed upon return.
-func (d *stiDocker) RunContainer(opts RunContainerOptions) error {
+// opts.Std{in,out,err} will be closed upon return. The container is killed
+// when ctx is done, and is always removed upon return.
+func (d *stiDocker) RunContainer(ctx context.Context, opts RunContainerOptions) error {
 	// Guarantee that Std{in,out,err} are closed upon return, including under
 	// error circumstances.  In normal circumstances, holdHijackedConnection
 	// should do this for us.
@@ -991,7 +1130,7 @@ func (d *stiDocker) RunContainer(opts RunContainerOptions) error {
 	if err == nil {
 		updateImageWithInspect(imageMetadata, inspect)
 		if opts.PullImage {
-			_, err = d.CheckAndPullImage(image)
+			_, err = d.CheckAndPullImage(ctx, image)
 		}
 	}
 	if err != nil {
@@ -1034,16 +1173,29 @@ func (d *stiDocker) RunContainer(opts RunContainerOptions) error {
 		createOpts.HostConfig.ShmSize = DefaultShmSize
 	}
 
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
 	// Create a new container.
 	glog.V(2).Infof("Creating container with options {Name:%q Config:%+v HostConfig:%+v} ...", createOpts.Name, *utils.SafeForLoggingContainerConfig(createOpts.Config), createOpts.HostConfig)
-	ctx, cancel := getDefaultContext()
+	createCtx, cancel := getDefaultContext()
 	defer cancel()
-	container, err := d.client.ContainerCreate(ctx, createOpts.Config, createOpts.HostConfig, createOpts.NetworkingConfig, createOpts.Name)
+	container, err := d.client.ContainerCreate(createCtx, createOpts.Config, createOpts.HostConfig, createOpts.NetworkingConfig, createOpts.Name)
 	if err != nil {
 		return err
 	}
 
-	// Container was created, so we defer its removal, and also remove it if we get a SIGINT/SIGTERM/SIGQUIT/SIGHUP.
+	// Attach the container to the log records while it runs.
+	fields := utilglog.CurrentFields()
+	utilglog.SetFields(utilglog.Fields{Stage: fields.Stage, ContainerID: container.ID, Image: image})
+	defer func() {
+		current := utilglog.CurrentFields()
+		utilglog.SetFields(utilglog.Fields{Stage: current.Stage, ContainerID: fields.ContainerID, Image: fields.Image})
+	}()
+
+	// Container was created, so we defer its removal, which also happens when
+	// the build is cancelled or exceeds its deadline.
 	removeContainer := func() {
 		glog.V(4).Infof("Removing container %q ...", container.ID)
 
@@ -1058,19 +1210,28 @@ func (d *stiDocker) RunContainer(opts RunContainerOptions) error {
 			glog.V(4).Infof("Removed container %q", container.ID)
 		}
 	}
-	dumpStack := func(signal os.Signal) {
-		if signal == syscall.SIGQUIT {
-			buf := make([]byte, 1<<16)
-			runtime.Stack(buf, true)
-			fmt.Printf("%s", buf)
+	defer removeContainer()
+
+	// Kill the container as soon as ctx is done, which ends the streaming of
+	// its output and the wait for it to stop below.
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			glog.V(0).Infof("Killing container %q: %v", container.ID, ctx.Err())
+			if err := d.KillContainer(container.ID); err != nil {
+				glog.V(0).Infof("warning: Failed to kill container %q: %v", container.ID, err)
+			}
+		case <-stopped:
 		}
-		os.Exit(2)
-	}
-	return interrupt.New(dumpStack, removeContainer).Run(func() error {
+	}()
+
+	err = func() error {
 		glog.V(2).Infof("Attaching to container %q ...", container.ID)
-		ctx, cancel := getDefaultContext()
+		apiCtx, cancel := getDefaultContext()
 		defer cancel()
-		resp, err := d.client.ContainerAttach(ctx, container.ID, opts.asDockerAttachToContainerOptions())
+		resp, err := d.client.ContainerAttach(apiCtx, container.ID, opts.asDockerAttachToContainerOptions())
 		if err != nil {
 			glog.V(0).Infof("error: Unable to attach to container %q: %v", container.ID, err)
 			return err
@@ -1079,9 +1240,9 @@ func (d *stiDocker) RunContainer(opts RunContainerOptions) error {
 
 		// Start the container
 		glog.V(2).Infof("Starting container %q ...", container.ID)
-		ctx, cancel = getDefaultContext()
+		apiCtx, cancel = getDefaultContext()
 		defer cancel()
-		err = d.client.ContainerStart(ctx, container.ID, dockertypes.ContainerStartOptions{})
+		err = d.client.ContainerStart(apiCtx, container.ID, dockertypes.ContainerStartOptions{})
 		if err != nil {
 			return err
 		}
@@ -1110,12 +1271,12 @@ func (d *stiDocker) RunContainer(opts RunContainerOptions) error {
 		// Return an error if the exit code of the container is
 		// non-zero.
 		glog.V(4).Infof("Waiting for container %q to stop ...", container.ID)
-		waitC, errC := d.client.ContainerWait(context.Background(), container.ID, dockercontainer.WaitConditionNextExit)
+		waitC, errC := d.client.ContainerWait(ctx, container.ID, dockercontainer.WaitConditionNextExit)
 		select {
 		case result := <-waitC:
 			if result.StatusCode != 0 {
 				var output string
-				jsonOutput, _ := d.client.ContainerInspect(ctx, container.ID)
+				jsonOutput, _ := d.client.ContainerInspect(apiCtx, container.ID)
 				if err == nil && jsonOutput.ContainerJSONBase != nil && jsonOutput.ContainerJSONBase.State != nil {
 					state := jsonOutput.ContainerJSONBase.State
 					output = fmt.Sprintf("Status: %s, Error: %s, OOMKilled: %v, Dead: %v", state.Status, state.Error, state.OOMKilled, state.Dead)
@@ -1140,7 +1301,11 @@ func (d *stiDocker) RunContainer(opts RunContainerOptions) error {
 			}
 		}
 		return nil
-	})
+	}()
+	if ctx.Err() != nil {
+		return fmt.Errorf("container %q was stopped: %w", container.ID, ctx.Err())
+	}
+	return err
 }
 
 // GetImageID retrieves the ID of the image identified by name
@@ -1155,7 +1320,7 @@ func (d *stiDocker) GetImageID(name string) (string, error) {
 
 // CommitContainer commits a container to an image with a specific tag.
 // The new image ID is returned
-func (d *stiDocker) CommitContainer(opts CommitContainerOptions) (string, error) {
+func (d *stiDocker) CommitContainer(ctx context.Context, opts CommitContainerOptions) (string, error) {
 	dockerOpts := dockertypes.ContainerCommitOptions{
 		Reference: opts.Repository,
 	}
@@ -1171,7 +1336,7 @@ func (d *stiDocker) CommitContainer(opts CommitContainerOptions) (string, error)
 		glog.V(9).Infof("Committing container with dockerOpts: %+v, config: %+v", dockerOpts, *utils.SafeForLoggingContainerConfig(&config))
 	}
 
-	resp, err := d.client.ContainerCommit(context.Background(), opts.ContainerID, dockerOpts)
+	resp, err := d.client.ContainerCommit(ctx, opts.ContainerID, dockerOpts)
 	if err == nil {
 		return resp.ID, nil
 	}
@@ -1186,8 +1351,65 @@ func (d *stiDocker) RemoveImage(imageID string) error {
 	return err
 }
 
+// TagImage gives the image with the specified name or ID an additional tag.
+func (d *stiDocker) TagImage(name, tag string) error {
+	ctx, cancel := getDefaultContext()
+	defer cancel()
+	return d.client.ImageTag(ctx, name, getImageName(tag))
+}
+
+// SaveImage writes the image with the specified name or ID to w in the
+// format of docker save. An image saved by name keeps its tag when loaded.
+func (d *stiDocker) SaveImage(ctx context.Context, name string, w io.Writer) error {
+	if !strings.HasPrefix(name, "sha256:") {
+		name = getImageName(name)
+	}
+	glog.V(2).Infof("Saving image %s", name)
+	resp, err := d.client.ImageSave(ctx, []string{name})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	_, err = io.Copy(w, resp)
+	return err
+}
+
+// LoadImage loads the images of the archive of docker save read from r, and
+// returns their tags, or their IDs when they have none.
+func (d *stiDocker) LoadImage(ctx context.Context, r io.Reader) ([]string, error) {
+	resp, err := d.client.ImageLoad(ctx, r, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	images := []string{}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg dockermessage.JSONMessage
+		if err = decoder.Decode(&msg); err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		for _, prefix := range []string{"Loaded image: ", "Loaded image ID: "} {
+			if strings.HasPrefix(msg.Stream, prefix) {
+				images = append(images, strings.TrimSpace(strings.TrimPrefix(msg.Stream, prefix)))
+			}
+		}
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no image loaded from the archive")
+	}
+	glog.V(2).Infof("Loaded images %v", images)
+	return images, nil
+}
+
 // BuildImage builds the image according to specified options
-func (d *stiDocker) BuildImage(opts BuildImageOptions) error {
+func (d *stiDocker) BuildImage(ctx context.Context, opts BuildImageOptions) error {
 	dockerOpts := dockertypes.ImageBuildOptions{
 		Tags:           []string{opts.Name},
 		NoCache:        true,
@@ -1201,7 +1423,7 @@ func (d *stiDocker) BuildImage(opts BuildImageOptions) error {
 		dockerOpts.CgroupParent = opts.CGroupLimits.Parent
 	}
 	glog.V(2).Infof("Building container using config: %+v", dockerOpts)
-	resp, err := d.client.ImageBuild(context.Background(), opts.Stdin, dockerOpts)
+	resp, err := d.client.ImageBuild(ctx, opts.Stdin, dockerOpts)
 	if err != nil {
 		return err
 	}
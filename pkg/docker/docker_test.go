@@ -2,6 +2,10 @@ package docker
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	goerrors "errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,7 +13,9 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/api/constants"
 	dockertest "github.com/kubesphere/s2irun/pkg/docker/test"
 	"github.com/kubesphere/s2irun/pkg/errors"
@@ -18,6 +24,7 @@ import (
 	dockertypes "github.com/docker/docker/api/types"
 	dockercontainer "github.com/docker/docker/api/types/container"
 	dockerstrslice "github.com/docker/docker/api/types/strslice"
+	dockermessage "github.com/docker/docker/pkg/jsonmessage"
 )
 
 func TestContainerName(t *testing.T) {
@@ -89,7 +96,7 @@ func TestCommitContainer(t *testing.T) {
 		}
 		dh := getDocker(fakeDocker)
 
-		imageID, err := dh.CommitContainer(opt)
+		imageID, err := dh.CommitContainer(context.Background(), opt)
 		if err != tst.expectedError {
 			t.Errorf("test case %s: Unexpected error returned: %v", desc, err)
 		}
@@ -147,7 +154,7 @@ func TestCopyToContainer(t *testing.T) {
 		}
 		dh := getDocker(fakeDocker)
 
-		err = dh.UploadToContainer(&testfs.FakeFileSystem{}, fileName, fileName, tst.containerID)
+		err = dh.UploadToContainer(context.Background(), &testfs.FakeFileSystem{}, fileName, fileName, tst.containerID)
 		// the error we are inducing will prevent call into engine-api
 		if len(tst.src) > 0 {
 			if err != nil {
@@ -201,7 +208,7 @@ func TestCopyFromContainer(t *testing.T) {
 		}
 		dh := getDocker(fakeDocker)
 
-		err := dh.DownloadFromContainer(tst.srcPath, buffer, tst.containerID)
+		err := dh.DownloadFromContainer(context.Background(), tst.srcPath, buffer, tst.containerID)
 		if err != tst.expectedError {
 			t.Errorf("test case %s: Unexpected error returned: %v", desc, err)
 		}
@@ -239,7 +246,7 @@ func TestImageBuild(t *testing.T) {
 			Name: tst.imageID,
 		}
 
-		err := dh.BuildImage(opts)
+		err := dh.BuildImage(context.Background(), opts)
 		if err != tst.expectedError {
 			t.Errorf("test case %s: Unexpected error returned: %v", desc, err)
 		}
@@ -335,7 +342,7 @@ func TestGetScriptsURL(t *testing.T) {
 		} else {
 			fakeDocker.Images = map[string]dockertypes.ImageInspect{tst.image.ID: tst.image}
 		}
-		url, err := dh.GetScriptsURL(tst.image.ID)
+		url, err := dh.GetScriptsURL(context.Background(), tst.image.ID)
 
 		if !reflect.DeepEqual(fakeDocker.Calls, tst.calls) {
 			t.Errorf("%s: Expected fakeDocker.Calls %v, got %v", desc, tst.calls, fakeDocker.Calls)
@@ -528,7 +535,7 @@ func TestRunContainer(t *testing.T) {
 			fakeDocker.WaitContainerErrInspectJSON = tst.errJSON
 		}
 
-		err := dh.RunContainer(RunContainerOptions{
+		err := dh.RunContainer(context.Background(), RunContainerOptions{
 			Image:           "test/image",
 			PullImage:       true,
 			ExternalScripts: tst.externalScripts,
@@ -579,6 +586,61 @@ func TestRunContainer(t *testing.T) {
 	}
 }
 
+func TestRunContainerCancelled(t *testing.T) {
+	fakeDocker := dockertest.NewFakeDockerClient()
+	dh := getDocker(fakeDocker)
+	image := dockertypes.ImageInspect{
+		ID:              "test/image:latest",
+		ContainerConfig: &dockercontainer.Config{},
+		Config:          &dockercontainer.Config{},
+	}
+	fakeDocker.Images = map[string]dockertypes.ImageInspect{image.ID: image}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := dh.RunContainer(ctx, RunContainerOptions{
+		Image:   "test/image",
+		Command: constants.Assemble,
+		OnStart: func(string) error {
+			cancel()
+			return nil
+		},
+	})
+	if !goerrors.Is(err, context.Canceled) {
+		t.Errorf("Expected the container to be stopped by the cancellation, got %v", err)
+	}
+	expectedCalls := []string{"inspect_image", "inspect_image", "create", "attach", "start", "remove"}
+	if !reflect.DeepEqual(fakeDocker.Calls, expectedCalls) {
+		t.Errorf("Expected fakeDocker.Calls %v, got %v", expectedCalls, fakeDocker.Calls)
+	}
+
+	fakeDocker.Calls = nil
+	err = dh.RunContainer(ctx, RunContainerOptions{Image: "test/image", Command: constants.Assemble})
+	if !goerrors.Is(err, context.Canceled) {
+		t.Errorf("Expected no container to be created after the cancellation, got %v", err)
+	}
+	expectedCalls = []string{"inspect_image", "inspect_image"}
+	if !reflect.DeepEqual(fakeDocker.Calls, expectedCalls) {
+		t.Errorf("Expected fakeDocker.Calls %v, got %v", expectedCalls, fakeDocker.Calls)
+	}
+}
+
+func TestLayerProgress(t *testing.T) {
+	progress := layerProgress{}
+	for _, msg := range []dockermessage.JSONMessage{
+		{ID: "a", Status: "Downloading", Progress: &dockermessage.JSONProgress{Current: 100, Total: 300}},
+		{ID: "a", Status: "Downloading", Progress: &dockermessage.JSONProgress{Current: 300, Total: 300}},
+		{ID: "a", Status: "Extracting", Progress: &dockermessage.JSONProgress{Current: 1000, Total: 1000}},
+		{ID: "b", Status: "Downloading", Progress: &dockermessage.JSONProgress{Current: 50, Total: 50}},
+		{ID: "c", Status: "Already exists"},
+		{Status: "Downloading", Progress: &dockermessage.JSONProgress{Current: 10}},
+	} {
+		progress.update(&msg, pullProgressStatus)
+	}
+	if total := progress.total(); total != 350 {
+		t.Errorf("expected 350 bytes, got %d", total)
+	}
+}
+
 func TestGetImageID(t *testing.T) {
 	fakeDocker := dockertest.NewFakeDockerClient()
 	dh := getDocker(fakeDocker)
@@ -627,3 +689,272 @@ func TestGetImageName(t *testing.T) {
 		}
 	}
 }
+
+func TestPushImageDigest(t *testing.T) {
+	fakeDocker := dockertest.NewFakeDockerClient()
+	fakeDocker.PushOutput = `{"status":"The push refers to repository [docker.io/foo/app]"}
+{"status":"Pushing","progressDetail":{"current":512,"total":1024},"id":"a"}
+{"status":"v1: digest: sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b size: 527"}
+{"progressDetail":{},"aux":{"Tag":"v1","Digest":"sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b","Size":527}}
+`
+	dh := getDocker(fakeDocker)
+	digest, err := dh.PushImage(context.Background(), "foo/app:v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if digest != "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b" {
+		t.Errorf("unexpected digest %q", digest)
+	}
+}
+
+func TestPullImageAuthentication(t *testing.T) {
+	fakeDocker := dockertest.NewFakeDockerClient()
+	fakeDocker.PullOptions = map[string]dockertypes.ImagePullOptions{}
+	config := &api.Config{
+		BuilderImage:          "registry.example.com/builder:1.0",
+		PullAuthentication:    api.AuthConfig{Username: "builder"},
+		RuntimeImage:          "quay.io/foo/runtime",
+		RuntimeAuthentication: api.AuthConfig{Username: "runtime"},
+		Incremental:           true,
+		Tag:                   "foo/app:v1",
+	}
+	images := []string{"registry.example.com/builder:1.0", "quay.io/foo/runtime:latest", "foo/app:v1", "other/image:latest"}
+	for _, image := range images {
+		fakeDocker.Images[image] = dockertypes.ImageInspect{ID: image}
+	}
+	d := NewForConfig(fakeDocker, config)
+	for _, image := range images {
+		if _, err := d.PullImage(context.Background(), image); err != nil {
+			t.Fatalf("unexpected error pulling %s: %v", image, err)
+		}
+	}
+
+	expected := map[string]string{
+		"registry.example.com/builder:1.0": "builder",
+		"quay.io/foo/runtime:latest":       "runtime",
+		// the previous image has no authentication of its own
+		"foo/app:v1":         "builder",
+		"other/image:latest": "builder",
+	}
+	for image, username := range expected {
+		data, err := base64.URLEncoding.DecodeString(fakeDocker.PullOptions[image].RegistryAuth)
+		if err != nil {
+			t.Fatalf("%s: invalid registry auth: %v", image, err)
+		}
+		var auth dockertypes.AuthConfig
+		if err = json.Unmarshal(data, &auth); err != nil {
+			t.Fatalf("%s: invalid registry auth %s: %v", image, data, err)
+		}
+		if auth.Username != username {
+			t.Errorf("%s: expected to be pulled as %q, got %q", image, username, auth.Username)
+		}
+	}
+}
+
+func TestPullImageMirrors(t *testing.T) {
+	config := &api.Config{
+		RegistryMirrors: api.RegistryMirrors{
+			"docker.io": {"https://mirror-a.local", "mirror-b.local:5000/hub/"},
+		},
+		RegistryAuthentications: map[string]api.AuthConfig{
+			"mirror-b.local:5000": {Username: "mirror"},
+		},
+		PullRetryCount: -1,
+	}
+	tests := []struct {
+		name       string
+		image      string
+		pullErrors map[string]error
+		expected   api.ImageSourceInfo
+		expectErr  bool
+	}{
+		{
+			name:     "first mirror",
+			image:    "ruby:2.5",
+			expected: api.ImageSourceInfo{Image: "ruby:2.5", Source: "mirror-a.local/library/ruby:2.5"},
+		},
+		{
+			name:       "failed mirror",
+			image:      "ruby:2.5",
+			pullErrors: map[string]error{"mirror-a.local/library/ruby:2.5": goerrors.New("not found")},
+			expected: api.ImageSourceInfo{
+				Image:         "ruby:2.5",
+				Source:        "mirror-b.local:5000/hub/library/ruby:2.5",
+				FailedMirrors: []string{"mirror-a.local/library/ruby:2.5"},
+			},
+		},
+		{
+			name:  "origin fallback",
+			image: "docker.io/foo/builder:1.0",
+			pullErrors: map[string]error{
+				"mirror-a.local/foo/builder:1.0":          goerrors.New("not found"),
+				"mirror-b.local:5000/hub/foo/builder:1.0": goerrors.New("not found"),
+			},
+			expected: api.ImageSourceInfo{
+				Image:         "docker.io/foo/builder:1.0",
+				Source:        "docker.io/foo/builder:1.0",
+				FailedMirrors: []string{"mirror-a.local/foo/builder:1.0", "mirror-b.local:5000/hub/foo/builder:1.0"},
+			},
+		},
+		{
+			name:     "digest",
+			image:    "ruby@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			expected: api.ImageSourceInfo{Image: "ruby@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Source: "mirror-a.local/library/ruby@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+		},
+		{
+			name:     "registry without mirror",
+			image:    "quay.io/foo/builder:1.0",
+			expected: api.ImageSourceInfo{Image: "quay.io/foo/builder:1.0", Source: "quay.io/foo/builder:1.0"},
+		},
+		{
+			name:  "failed pull",
+			image: "quay.io/foo/builder:1.0",
+			pullErrors: map[string]error{
+				"quay.io/foo/builder:1.0": goerrors.New("not found"),
+			},
+			expected:  api.ImageSourceInfo{Image: "quay.io/foo/builder:1.0"},
+			expectErr: true,
+		},
+	}
+	for _, tc := range tests {
+		fakeDocker := dockertest.NewFakeDockerClient()
+		fakeDocker.PullOptions = map[string]dockertypes.ImagePullOptions{}
+		fakeDocker.PullErrors = tc.pullErrors
+		for _, image := range []string{tc.image, "mirror-a.local/library/ruby:2.5", "mirror-b.local:5000/hub/library/ruby:2.5", "mirror-a.local/library/ruby@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"} {
+			fakeDocker.Images[image] = dockertypes.ImageInspect{ID: image}
+		}
+		// An image pulled by digest from a mirror is known by the mirror
+		// reference only.
+		if strings.Contains(tc.image, "@") {
+			delete(fakeDocker.Images, tc.image)
+		}
+		recorder := &PullRecorder{}
+		d := NewForConfig(fakeDocker, config)
+		_, err := d.PullImage(WithPullRecorder(context.Background(), recorder), tc.image)
+		if (err != nil) != tc.expectErr {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if sources := recorder.Sources(); !reflect.DeepEqual(sources, []api.ImageSourceInfo{tc.expected}) {
+			t.Errorf("%s: expected the source %+v, got %+v", tc.name, tc.expected, sources)
+		}
+		if tc.expected.Source != "mirror-b.local:5000/hub/library/ruby:2.5" {
+			continue
+		}
+		data, _ := base64.URLEncoding.DecodeString(fakeDocker.PullOptions[tc.expected.Source].RegistryAuth)
+		var auth dockertypes.AuthConfig
+		if err = json.Unmarshal(data, &auth); err != nil || auth.Username != "mirror" {
+			t.Errorf("%s: expected the mirror pulled with its authentication, got %s", tc.name, data)
+		}
+	}
+}
+
+func TestGetBuilderImageDigestMirror(t *testing.T) {
+	digest := "@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	fakeDocker := dockertest.NewFakeDockerClient()
+	// An image pulled by digest from a mirror is known by the mirror
+	// reference only.
+	fakeDocker.Images = map[string]dockertypes.ImageInspect{
+		"mirror-a.local/library/ruby" + digest: {
+			ID:              "mirror-a.local/library/ruby" + digest,
+			ContainerConfig: &dockercontainer.Config{},
+			Config:          &dockercontainer.Config{},
+		},
+	}
+	config := &api.Config{
+		BuilderImage:      "ruby" + digest,
+		BuilderPullPolicy: api.PullAlways,
+		RegistryMirrors:   api.RegistryMirrors{"docker.io": {"mirror-a.local"}},
+		PullRetryCount:    -1,
+	}
+	d := NewForConfig(fakeDocker, config)
+	if _, err := GetBuilderImage(context.Background(), d, config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.BuilderImage != "mirror-a.local/library/ruby"+digest {
+		t.Errorf("expected the builder image replaced with the mirror reference, got %q", config.BuilderImage)
+	}
+
+	// The image is now found locally instead of being pulled again.
+	config.BuilderPullPolicy = api.PullIfNotPresent
+	fakeDocker.Calls = nil
+	if _, err := GetBuilderImage(context.Background(), d, config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, call := range fakeDocker.Calls {
+		if call == "pull" {
+			t.Errorf("expected the builder image not pulled again, got calls %v", fakeDocker.Calls)
+		}
+	}
+
+	err := d.RunContainer(context.Background(), RunContainerOptions{
+		Image:           config.BuilderImage,
+		ExternalScripts: true,
+		Command:         constants.Assemble,
+		Stdin:           ioutil.NopCloser(os.Stdin),
+	})
+	if err != nil {
+		t.Errorf("unexpected error running the builder image: %v", err)
+	}
+}
+
+func TestPullImageRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		err      error
+		expected int
+	}{
+		{
+			name:     "retriable error",
+			policy:   RetryPolicy{Count: 2, Delay: time.Millisecond},
+			err:      goerrors.New("connection reset by peer"),
+			expected: 3,
+		},
+		{
+			name:     "extra retriable error",
+			policy:   RetryPolicy{Count: 1, Delay: time.Millisecond, RetriableErrors: []string{"toomanyrequests"}},
+			err:      goerrors.New("toomanyrequests: rate limit exceeded"),
+			expected: 2,
+		},
+		{
+			name:     "not retriable error",
+			policy:   RetryPolicy{Count: 2, Delay: time.Millisecond},
+			err:      goerrors.New("manifest unknown"),
+			expected: 1,
+		},
+		{
+			name:     "no retries",
+			policy:   RetryPolicy{Count: -1},
+			err:      goerrors.New("connection reset by peer"),
+			expected: 1,
+		},
+	}
+	for _, tc := range tests {
+		fakeDocker := dockertest.NewFakeDockerClient()
+		fakeDocker.PullFail = tc.err
+		d := getDocker(fakeDocker)
+		d.retry = tc.policy
+		if _, err := d.PullImage(context.Background(), "foo/bar"); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		pulls := 0
+		for _, call := range fakeDocker.Calls {
+			if call == "pull" {
+				pulls++
+			}
+		}
+		if pulls != tc.expected {
+			t.Errorf("%s: expected %d pulls, got %d", tc.name, tc.expected, pulls)
+		}
+	}
+
+	policy := RetryPolicy{Delay: time.Second, Backoff: 2}
+	for retries, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if delay := policy.delay(retries); delay != expected {
+			t.Errorf("expected the delay %s after %d retries, got %s", expected, retries, delay)
+		}
+	}
+	if delay := (RetryPolicy{}).delay(3); delay != DefaultPullRetryDelay {
+		t.Errorf("expected the default delay, got %s", delay)
+	}
+}
@@ -0,0 +1,127 @@
+package docker
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+)
+
+const (
+	// PodmanScheme is the scheme of the endpoints served by Podman, such as
+	// podman:///run/podman/podman.sock.
+	PodmanScheme = "podman"
+
+	// PodmanHostEnv is the environment variable Podman reads its endpoint
+	// from.
+	PodmanHostEnv = "CONTAINER_HOST"
+
+	// DefaultPodmanSocket is the socket of the Podman service run as root.
+	DefaultPodmanSocket = "/run/podman/podman.sock"
+)
+
+// Engine creates the clients of a container engine. The strategies only talk
+// to the engine through Client, so any engine serving the Docker API, natively
+// or through a compatibility layer, can run the builds.
+type Engine interface {
+	// NewClient returns a client of the engine at config.Endpoint.
+	NewClient(config *api.DockerConfig) (Client, error)
+}
+
+// EngineFunc adapts a function to the Engine interface.
+type EngineFunc func(config *api.DockerConfig) (Client, error)
+
+// NewClient calls f(config).
+func (f EngineFunc) NewClient(config *api.DockerConfig) (Client, error) {
+	return f(config)
+}
+
+var engines = map[api.ContainerEngine]Engine{
+	api.DockerEngine: EngineFunc(newDockerClient),
+	api.PodmanEngine: EngineFunc(newPodmanClient),
+}
+
+// RegisterEngine makes the engine available under name, replacing the engine
+// registered before under the same name. It is meant to be called at
+// initialization, to plug in engines such as a containerd shim.
+func RegisterEngine(name api.ContainerEngine, engine Engine) {
+	engines[name] = engine
+}
+
+// NewClient returns a client of the container engine selected by config. The
+// engine is given by config.Engine, or by the scheme of config.Endpoint, and is
+// Docker when neither is set.
+func NewClient(config *api.DockerConfig) (Client, error) {
+	resolved, err := ResolveEngine(config)
+	if err != nil {
+		return nil, err
+	}
+	engine, ok := engines[resolved.Engine]
+	if !ok {
+		return nil, fmt.Errorf("unknown container engine %q", resolved.Engine)
+	}
+	glog.V(2).Infof("Using the %s container engine at %s", resolved.Engine, resolved.Endpoint)
+	return engine.NewClient(resolved)
+}
+
+// ResolveEngine returns a copy of config with the engine set and the endpoint
+// translated to one the engine client understands. A podman:// endpoint is
+// served on a unix socket, and Podman without an endpoint of its own listens
+// on its default socket rather than the Docker one.
+func ResolveEngine(config *api.DockerConfig) (*api.DockerConfig, error) {
+	resolved := *config
+	if strings.HasPrefix(resolved.Endpoint, PodmanScheme+"://") {
+		if len(resolved.Engine) > 0 && resolved.Engine != api.PodmanEngine {
+			return nil, fmt.Errorf("the endpoint %s is served by Podman, not by the %s engine", resolved.Endpoint, resolved.Engine)
+		}
+		resolved.Engine = api.PodmanEngine
+		resolved.Endpoint = "unix://" + strings.TrimPrefix(resolved.Endpoint, PodmanScheme+"://")
+		return &resolved, nil
+	}
+	if len(resolved.Engine) == 0 {
+		resolved.Engine = api.DockerEngine
+	}
+	if resolved.Engine == api.PodmanEngine && (len(resolved.Endpoint) == 0 || resolved.Endpoint == client.DefaultDockerHost) {
+		resolved.Endpoint = DefaultPodmanHost()
+	}
+	return &resolved, nil
+}
+
+// DefaultPodmanHost returns the endpoint of the local Podman service: the one
+// in $CONTAINER_HOST, the socket of the user service when running rootless or
+// the socket of the system service.
+func DefaultPodmanHost() string {
+	if host := os.Getenv(PodmanHostEnv); strings.HasPrefix(host, "unix://") {
+		return host
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); len(runtimeDir) > 0 && os.Geteuid() != 0 {
+		return "unix://" + filepath.Join(runtimeDir, "podman", "podman.sock")
+	}
+	return "unix://" + DefaultPodmanSocket
+}
+
+// newDockerClient returns a client of the Docker engine.
+func newDockerClient(config *api.DockerConfig) (Client, error) {
+	c, err := NewEngineAPIClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newPodmanClient returns a client of the Docker compatible API of Podman.
+// Unlike the Docker daemon, the Podman service is usually socket activated
+// and not running, so a missing socket is reported with how to start it.
+func newPodmanClient(config *api.DockerConfig) (Client, error) {
+	if u, err := url.Parse(config.Endpoint); err == nil && u.Scheme == "unix" {
+		if _, err = os.Stat(u.Path); err != nil {
+			return nil, fmt.Errorf("the Podman socket %s is not available, start the service with \"systemctl --user start podman.socket\" or \"podman system service\": %v", u.Path, err)
+		}
+	}
+	return newDockerClient(config)
+}
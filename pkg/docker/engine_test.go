@@ -0,0 +1,103 @@
+package docker
+
+import (
+	"os"
+	"testing"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	dockertest "github.com/kubesphere/s2irun/pkg/docker/test"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+func TestResolveEngine(t *testing.T) {
+	host := os.Getenv(PodmanHostEnv)
+	defer os.Setenv(PodmanHostEnv, host)
+	os.Setenv(PodmanHostEnv, "unix:///tmp/podman.sock")
+
+	tests := []struct {
+		name             string
+		config           api.DockerConfig
+		expectedEngine   api.ContainerEngine
+		expectedEndpoint string
+		expectError      bool
+	}{
+		{
+			name:             "docker by default",
+			config:           api.DockerConfig{Endpoint: "tcp://127.0.0.1:2375"},
+			expectedEngine:   api.DockerEngine,
+			expectedEndpoint: "tcp://127.0.0.1:2375",
+		},
+		{
+			name:             "podman scheme",
+			config:           api.DockerConfig{Endpoint: "podman:///run/user/1000/podman/podman.sock"},
+			expectedEngine:   api.PodmanEngine,
+			expectedEndpoint: "unix:///run/user/1000/podman/podman.sock",
+		},
+		{
+			name:             "podman engine on the default Docker endpoint",
+			config:           api.DockerConfig{Endpoint: client.DefaultDockerHost, Engine: api.PodmanEngine},
+			expectedEngine:   api.PodmanEngine,
+			expectedEndpoint: "unix:///tmp/podman.sock",
+		},
+		{
+			name:             "podman engine with its own endpoint",
+			config:           api.DockerConfig{Endpoint: "tcp://127.0.0.1:8080", Engine: api.PodmanEngine},
+			expectedEngine:   api.PodmanEngine,
+			expectedEndpoint: "tcp://127.0.0.1:8080",
+		},
+		{
+			name:        "podman scheme with the docker engine",
+			config:      api.DockerConfig{Endpoint: "podman:///run/podman/podman.sock", Engine: api.DockerEngine},
+			expectError: true,
+		},
+	}
+	for _, tc := range tests {
+		resolved, err := ResolveEngine(&tc.config)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if resolved.Engine != tc.expectedEngine || resolved.Endpoint != tc.expectedEndpoint {
+			t.Errorf("%s: expected %s at %s, got %s at %s", tc.name, tc.expectedEngine, tc.expectedEndpoint, resolved.Engine, resolved.Endpoint)
+		}
+	}
+}
+
+func TestRegisterEngine(t *testing.T) {
+	const fakeEngine api.ContainerEngine = "fake"
+	fakeClient := dockertest.NewFakeDockerClient()
+	fakeClient.Images["centos/ruby-25-centos7:latest"] = dockertypes.ImageInspect{ID: "sha256:1234"}
+	var endpoint string
+	RegisterEngine(fakeEngine, EngineFunc(func(config *api.DockerConfig) (Client, error) {
+		endpoint = config.Endpoint
+		return fakeClient, nil
+	}))
+	defer delete(engines, fakeEngine)
+
+	c, err := NewClient(&api.DockerConfig{Endpoint: "unix:///tmp/fake.sock", Engine: fakeEngine})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if endpoint != "unix:///tmp/fake.sock" {
+		t.Errorf("unexpected endpoint %q", endpoint)
+	}
+	image, err := New(c, api.AuthConfig{}, api.AuthConfig{}).CheckImage("centos/ruby-25-centos7")
+	if err != nil || image.ID != "sha256:1234" {
+		t.Errorf("expected the image to be inspected through the registered engine, got %+v, %v", image, err)
+	}
+
+	if _, err = NewClient(&api.DockerConfig{Endpoint: "unix:///tmp/fake.sock", Engine: "unknown"}); err == nil {
+		t.Errorf("expected an error for an unknown engine")
+	}
+	if _, err = NewClient(&api.DockerConfig{Endpoint: "podman:///nonexistent/podman.sock"}); err == nil {
+		t.Errorf("expected an error for a missing Podman socket")
+	}
+}
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"context"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -42,12 +43,21 @@ type FakeDocker struct {
 	CommitContainerError         error
 	RemoveImageName              string
 	RemoveImageError             error
+	TagImageTags                 []string
+	TagImageError                error
 	BuildImageOpts               BuildImageOptions
 	BuildImageError              error
 	PullResult                   bool
 	PullError                    error
 	PushResult                   bool
 	PushError                    error
+	PushDigest                   string
+	SaveImageName                string
+	SaveImageContent             []byte
+	SaveImageError               error
+	LoadImageContent             []byte
+	LoadImageResult              []string
+	LoadImageError               error
 	OnBuildImage                 string
 	OnBuildResult                []string
 	OnBuildError                 error
@@ -99,22 +109,25 @@ func (f *FakeDocker) KillContainer(id string) error {
 }
 
 // GetScriptsURL returns a default STI scripts URL
-func (f *FakeDocker) GetScriptsURL(image string) (string, error) {
+func (f *FakeDocker) GetScriptsURL(ctx context.Context, image string) (string, error) {
 	f.DefaultURLImage = image
 	return f.DefaultURLResult, f.DefaultURLError
 }
 
 // GetAssembleInputFiles finds a io.openshift.s2i.assemble-input-files label on the given image.
-func (f *FakeDocker) GetAssembleInputFiles(image string) (string, error) {
+func (f *FakeDocker) GetAssembleInputFiles(ctx context.Context, image string) (string, error) {
 	return f.AssembleInputFilesResult, f.AssembleInputFilesError
 }
 
 // RunContainer runs a fake Docker container
-func (f *FakeDocker) RunContainer(opts RunContainerOptions) error {
+func (f *FakeDocker) RunContainer(ctx context.Context, opts RunContainerOptions) error {
 	f.RunContainerOpts = opts
 	if f.RunContainerErrorBeforeStart {
 		return f.RunContainerError
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if opts.Stdout != nil {
 		opts.Stdout.Close()
 	}
@@ -139,17 +152,17 @@ func (f *FakeDocker) RunContainer(opts RunContainerOptions) error {
 }
 
 // UploadToContainer uploads artifacts to the container.
-func (f *FakeDocker) UploadToContainer(fs fs.FileSystem, srcPath, destPath, container string) error {
+func (f *FakeDocker) UploadToContainer(ctx context.Context, fs fs.FileSystem, srcPath, destPath, container string) error {
 	return nil
 }
 
 // UploadToContainerWithTarWriter uploads artifacts to the container.
-func (f *FakeDocker) UploadToContainerWithTarWriter(fs fs.FileSystem, srcPath, destPath, container string, makeTarWriter func(io.Writer) tar.Writer) error {
+func (f *FakeDocker) UploadToContainerWithTarWriter(ctx context.Context, fs fs.FileSystem, srcPath, destPath, container string, makeTarWriter func(io.Writer) tar.Writer) error {
 	return errors.New("not implemented")
 }
 
 // DownloadFromContainer downloads file (or directory) from the container.
-func (f *FakeDocker) DownloadFromContainer(containerPath string, w io.Writer, container string) error {
+func (f *FakeDocker) DownloadFromContainer(ctx context.Context, containerPath string, w io.Writer, container string) error {
 	return errors.New("not implemented")
 }
 
@@ -176,7 +189,7 @@ func (f *FakeDocker) GetImageEntrypoint(image string) ([]string, error) {
 }
 
 // CommitContainer commits a fake Docker container
-func (f *FakeDocker) CommitContainer(opts CommitContainerOptions) (string, error) {
+func (f *FakeDocker) CommitContainer(ctx context.Context, opts CommitContainerOptions) (string, error) {
 	f.CommitContainerOpts = opts
 	return f.CommitContainerResult, f.CommitContainerError
 }
@@ -187,27 +200,52 @@ func (f *FakeDocker) RemoveImage(name string) error {
 	return f.RemoveImageError
 }
 
+// TagImage tags a fake Docker image
+func (f *FakeDocker) TagImage(name, tag string) error {
+	f.TagImageTags = append(f.TagImageTags, tag)
+	return f.TagImageError
+}
+
 // CheckImage checks image in local registry
 func (f *FakeDocker) CheckImage(name string) (*api.Image, error) {
 	return nil, nil
 }
 
 // PullImage pulls a fake docker image
-func (f *FakeDocker) PullImage(imageName string) (*api.Image, error) {
+func (f *FakeDocker) PullImage(ctx context.Context, imageName string) (*api.Image, error) {
 	if f.PullResult {
 		return &api.Image{}, nil
 	}
 	return nil, f.PullError
 }
-func (f *FakeDocker) PushImage(name string) error {
+func (f *FakeDocker) PushImage(ctx context.Context, name string) (string, error) {
 	if f.PushResult {
-		return nil
+		return f.PushDigest, nil
+	}
+	return "", f.PushError
+}
+
+// SaveImage writes the content of a fake Docker image
+func (f *FakeDocker) SaveImage(ctx context.Context, name string, w io.Writer) error {
+	f.SaveImageName = name
+	if f.SaveImageError != nil {
+		return f.SaveImageError
+	}
+	_, err := w.Write(f.SaveImageContent)
+	return err
+}
+
+// LoadImage loads a fake Docker image
+func (f *FakeDocker) LoadImage(ctx context.Context, r io.Reader) ([]string, error) {
+	var err error
+	if f.LoadImageContent, err = ioutil.ReadAll(r); err != nil {
+		return nil, err
 	}
-	return f.PushError
+	return f.LoadImageResult, f.LoadImageError
 }
 
 // CheckAndPullImage pulls a fake docker image
-func (f *FakeDocker) CheckAndPullImage(name string) (*api.Image, error) {
+func (f *FakeDocker) CheckAndPullImage(ctx context.Context, name string) (*api.Image, error) {
 	if f.PullResult {
 		return &api.Image{}, nil
 	}
@@ -215,7 +253,7 @@ func (f *FakeDocker) CheckAndPullImage(name string) (*api.Image, error) {
 }
 
 // BuildImage builds image
-func (f *FakeDocker) BuildImage(opts BuildImageOptions) error {
+func (f *FakeDocker) BuildImage(ctx context.Context, opts BuildImageOptions) error {
 	f.BuildImageOpts = opts
 	if opts.Stdin != nil {
 		_, err := io.Copy(ioutil.Discard, opts.Stdin)
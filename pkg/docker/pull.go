@@ -0,0 +1,184 @@
+package docker
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/reference"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/oci"
+)
+
+// RetryPolicy configures the retries of the failed image pulls. The zero value
+// retries DefaultPullRetryCount times every DefaultPullRetryDelay the errors
+// listed in RetriableErrors.
+type RetryPolicy struct {
+	// Count is the number of retries, DefaultPullRetryCount when zero and none
+	// when negative.
+	Count int
+	// Delay is the delay before the first retry, DefaultPullRetryDelay when
+	// zero.
+	Delay time.Duration
+	// Backoff multiplies the delay after each retry, the delay is constant
+	// when it is not above 1.
+	Backoff float64
+	// RetriableErrors are the substrings of the errors retried in addition to
+	// RetriableErrors.
+	RetriableErrors []string
+}
+
+// RetryPolicyForConfig returns the retry policy of the pulls set in config.
+func RetryPolicyForConfig(config *api.Config) RetryPolicy {
+	return RetryPolicy{
+		Count:           config.PullRetryCount,
+		Delay:           time.Duration(config.PullRetryDelaySeconds) * time.Second,
+		Backoff:         config.PullRetryBackoff,
+		RetriableErrors: config.PullRetriableErrors,
+	}
+}
+
+// retries returns the number of retries of a failed pull.
+func (p RetryPolicy) retries() int {
+	switch {
+	case p.Count < 0:
+		return 0
+	case p.Count == 0:
+		return DefaultPullRetryCount
+	}
+	return p.Count
+}
+
+// delay returns the delay before the retry following the given number of
+// retries.
+func (p RetryPolicy) delay(retries int) time.Duration {
+	delay := p.Delay
+	if delay == 0 {
+		delay = DefaultPullRetryDelay
+	}
+	if p.Backoff > 1 {
+		delay = time.Duration(float64(delay) * math.Pow(p.Backoff, float64(retries)))
+	}
+	return delay
+}
+
+// retriable returns whether the pull failing with err is retried.
+func (p RetryPolicy) retriable(err error) bool {
+	msg := err.Error()
+	for _, errorString := range append(append([]string{}, RetriableErrors...), p.RetriableErrors...) {
+		if strings.Contains(msg, errorString) {
+			return true
+		}
+	}
+	return false
+}
+
+// mirrorImages returns the references to image in the mirrors of its registry,
+// in order.
+func mirrorImages(mirrors api.RegistryMirrors, image string) []string {
+	if len(mirrors) == 0 {
+		return nil
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil
+	}
+	domain := reference.Domain(named)
+	path := strings.TrimPrefix(named.String(), domain+"/")
+	registries := make([]string, 0, len(mirrors))
+	for registry := range mirrors {
+		if normalizeRegistryHost(registry) == normalizeRegistryHost(domain) {
+			registries = append(registries, registry)
+		}
+	}
+	sort.Strings(registries)
+	images := []string{}
+	for _, registry := range registries {
+		for _, mirror := range mirrors[registry] {
+			if i := strings.Index(mirror, "://"); i != -1 {
+				mirror = mirror[i+3:]
+			}
+			images = append(images, strings.TrimSuffix(mirror, "/")+"/"+path)
+		}
+	}
+	return images
+}
+
+// isDigested returns true if image is referenced by its digest.
+func isDigested(image string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false
+	}
+	_, ok := named.(reference.Digested)
+	return ok
+}
+
+// PullOCIImage pulls image into layout with auth through the registry mirrors
+// of config, talking plain HTTP to its insecure registries, and records where
+// it was pulled from into the recorder of ctx.
+func PullOCIImage(ctx context.Context, config *api.Config, layout *oci.Layout, image string, auth api.AuthConfig) (*oci.Image, error) {
+	source := api.ImageSourceInfo{Image: image}
+	defer func() { recordImageSource(ctx, source) }()
+	for _, mirror := range mirrorImages(config.RegistryMirrors, image) {
+		pulled, err := oci.NewRegistry(registryAuth(config.RegistryAuthentications, mirror), config.InsecureRegistries...).Pull(ctx, mirror, layout)
+		if err == nil {
+			source.Source = mirror
+			return pulled, nil
+		}
+		glog.Warningf("Failed to pull image %q from the mirror %q, falling back: %v", image, mirror, err)
+		source.FailedMirrors = append(source.FailedMirrors, mirror)
+	}
+	pulled, err := oci.NewRegistry(auth, config.InsecureRegistries...).Pull(ctx, image, layout)
+	if err == nil {
+		source.Source = image
+	}
+	return pulled, err
+}
+
+// registryAuth returns the authentication of the registry of image in auths,
+// by registry.
+func registryAuth(auths map[string]api.AuthConfig, image string) api.AuthConfig {
+	registry := imageRegistryHost(image)
+	if registry == dockerHubHost {
+		registry = defaultRegistry
+	}
+	return auths[registry]
+}
+
+// PullRecorder records where the images pulled with a context holding it were
+// pulled from.
+type PullRecorder struct {
+	mu      sync.Mutex
+	sources []api.ImageSourceInfo
+}
+
+type pullRecorderKey struct{}
+
+// WithPullRecorder returns a copy of ctx recording the sources of the images
+// pulled with it into recorder.
+func WithPullRecorder(ctx context.Context, recorder *PullRecorder) context.Context {
+	return context.WithValue(ctx, pullRecorderKey{}, recorder)
+}
+
+// Sources returns the sources of the images pulled so far.
+func (r *PullRecorder) Sources() []api.ImageSourceInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]api.ImageSourceInfo{}, r.sources...)
+}
+
+// recordImageSource records source into the recorder of ctx, if any.
+func recordImageSource(ctx context.Context, source api.ImageSourceInfo) {
+	recorder, ok := ctx.Value(pullRecorderKey{}).(*PullRecorder)
+	if !ok {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.sources = append(recorder.sources, source)
+}
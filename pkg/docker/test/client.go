@@ -8,6 +8,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net"
+	"strings"
 	"time"
 
 	dockertypes "github.com/docker/docker/api/types"
@@ -90,6 +91,16 @@ type FakeDockerClient struct {
 
 	PullFail error
 	PushFail error
+	// PullErrors holds the errors the pulls fail with, by image.
+	PullErrors map[string]error
+	// PullOptions holds the options of the pulls by image.
+	PullOptions map[string]dockertypes.ImagePullOptions
+	// PushOutput is the stream of JSON messages returned by ImagePush.
+	PushOutput string
+	// SaveOutput is the archive returned by ImageSave.
+	SaveOutput []byte
+	// LoadOutput is the stream of JSON messages returned by ImageLoad.
+	LoadOutput string
 
 	Calls []string
 }
@@ -207,10 +218,16 @@ func (d *FakeDockerClient) ContainerStart(ctx context.Context, containerID strin
 // ImagePull requests the docker host to pull an image from a remote registry.
 func (d *FakeDockerClient) ImagePull(ctx context.Context, ref string, options dockertypes.ImagePullOptions) (io.ReadCloser, error) {
 	d.Calls = append(d.Calls, "pull")
+	if d.PullOptions != nil {
+		d.PullOptions[ref] = options
+	}
 
 	if d.PullFail != nil {
 		return nil, d.PullFail
 	}
+	if err := d.PullErrors[ref]; err != nil {
+		return nil, err
+	}
 
 	return ioutil.NopCloser(bytes.NewReader([]byte{})), nil
 }
@@ -220,7 +237,19 @@ func (d *FakeDockerClient) ImagePush(ctx context.Context, ref string, options do
 	if d.PullFail != nil {
 		return nil, d.PullFail
 	}
-	return ioutil.NopCloser(bytes.NewReader([]byte{})), nil
+	return ioutil.NopCloser(bytes.NewReader([]byte(d.PushOutput))), nil
+}
+
+// ImageTag tags an image on the docker host.
+func (d *FakeDockerClient) ImageTag(ctx context.Context, image, ref string) error {
+	d.Calls = append(d.Calls, "tag_image")
+	if _, exists := d.Images[image]; !exists {
+		return errors.New("image does not exist")
+	}
+	if strings.Contains(ref, "@") {
+		return errors.New("refusing to create a tag with a digest reference")
+	}
+	return nil
 }
 
 // ImageRemove removes an image from the docker host.
@@ -234,6 +263,26 @@ func (d *FakeDockerClient) ImageRemove(ctx context.Context, imageID string, opti
 	return []dockertypes.ImageDeleteResponseItem{}, errors.New("image does not exist")
 }
 
+// ImageSave saves images from the docker host as a tar archive.
+func (d *FakeDockerClient) ImageSave(ctx context.Context, images []string) (io.ReadCloser, error) {
+	d.Calls = append(d.Calls, "save_image")
+	for _, image := range images {
+		if _, exists := d.Images[image]; !exists {
+			return nil, errors.New("image does not exist")
+		}
+	}
+	return ioutil.NopCloser(bytes.NewReader(d.SaveOutput)), nil
+}
+
+// ImageLoad loads images to the docker host from a tar archive.
+func (d *FakeDockerClient) ImageLoad(ctx context.Context, input io.Reader, quiet bool) (dockertypes.ImageLoadResponse, error) {
+	d.Calls = append(d.Calls, "load_image")
+	if _, err := ioutil.ReadAll(input); err != nil {
+		return dockertypes.ImageLoadResponse{}, err
+	}
+	return dockertypes.ImageLoadResponse{Body: ioutil.NopCloser(bytes.NewReader([]byte(d.LoadOutput))), JSON: true}, nil
+}
+
 // ServerVersion returns information of the docker client and server host.
 func (d *FakeDockerClient) ServerVersion(ctx context.Context) (dockertypes.Version, error) {
 	return dockertypes.Version{}, nil
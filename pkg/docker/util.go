@@ -3,6 +3,7 @@ package docker
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -40,8 +41,11 @@ type AuthConfigurations struct {
 }
 
 type dockerConfig struct {
-	Auth  string `json:"auth"`
-	Email string `json:"email"`
+	Auth          string `json:"auth"`
+	Email         string `json:"email"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
 }
 
 const (
@@ -251,7 +255,7 @@ func parseRepositoryTag(repos string) (string, string, string) {
 
 // PullImage pulls the Docker image specified by name taking the pull policy
 // into the account.
-func PullImage(name string, d Docker, policy api.PullPolicy) (*PullResult, error) {
+func PullImage(ctx context.Context, name string, d Docker, policy api.PullPolicy) (*PullResult, error) {
 	if len(policy) == 0 {
 		return nil, errors.New("the policy for pull image must be set")
 	}
@@ -262,10 +266,10 @@ func PullImage(name string, d Docker, policy api.PullPolicy) (*PullResult, error
 	)
 	switch policy {
 	case api.PullIfNotPresent:
-		image, err = d.CheckAndPullImage(name)
+		image, err = d.CheckAndPullImage(ctx, name)
 	case api.PullAlways:
 		glog.Infof("Pulling image %q ...", name)
-		image, err = d.PullImage(name)
+		image, err = d.PullImage(ctx, name)
 	case api.PullNever:
 		glog.Infof("Checking if image %q is available locally ...", name)
 		image, err = d.CheckImage(name)
@@ -380,13 +384,39 @@ func (d *stiDocker) CheckReachable() error {
 	return err
 }
 
-func pullAndCheck(image string, docker Docker, pullPolicy api.PullPolicy, config *api.Config) (*PullResult, error) {
-	r, err := PullImage(image, docker, pullPolicy)
+// localMirrorImage returns the reference under which the engine knows name.
+// A digest-pinned image pulled from a registry mirror cannot be tagged with
+// its origin reference, so it is only available locally as the mirror one.
+func localMirrorImage(docker Docker, mirrors api.RegistryMirrors, name string) string {
+	if !isDigested(name) {
+		return name
+	}
+	if _, err := docker.InspectImage(name); err == nil {
+		return name
+	}
+	for _, mirror := range mirrorImages(mirrors, name) {
+		if _, err := docker.InspectImage(mirror); err == nil {
+			return mirror
+		}
+	}
+	return name
+}
+
+// pullAndCheck makes image available locally and checks its user. image is
+// replaced with the reference it was pulled as, which is the registry mirror
+// one for a digest-pinned image pulled from a mirror.
+func pullAndCheck(ctx context.Context, image *string, docker Docker, pullPolicy api.PullPolicy, config *api.Config) (*PullResult, error) {
+	*image = localMirrorImage(docker, config.RegistryMirrors, *image)
+	r, err := PullImage(ctx, *image, docker, pullPolicy)
 	if err != nil {
 		return nil, err
 	}
+	if pulled := localMirrorImage(docker, config.RegistryMirrors, *image); pulled != *image {
+		*image = pulled
+		r.OnBuild = docker.IsImageOnBuild(pulled)
+	}
 
-	err = CheckAllowedUser(docker, image, config.AllowedUIDs, r.OnBuild, config.AssembleUser)
+	err = CheckAllowedUser(docker, *image, config.AllowedUIDs, r.OnBuild, config.AssembleUser)
 	if err != nil {
 		return nil, err
 	}
@@ -397,22 +427,34 @@ func pullAndCheck(image string, docker Docker, pullPolicy api.PullPolicy, config
 // GetBuilderImage processes the config and performs operations necessary to
 // make the Docker image specified as BuilderImage available locally. It
 // returns information about the base image, containing metadata necessary for
-// choosing the right STI build strategy.
-func GetBuilderImage(docker Docker, config *api.Config) (*PullResult, error) {
-	return pullAndCheck(config.BuilderImage, docker, config.BuilderPullPolicy, config)
+// choosing the right STI build strategy. A BuilderImage referencing an archive
+// is loaded and replaced with the name of the loaded image, and a digest-pinned
+// one pulled from a registry mirror with the mirror reference.
+func GetBuilderImage(ctx context.Context, docker Docker, config *api.Config) (*PullResult, error) {
+	if err := loadArchiveImage(ctx, docker, &config.BuilderImage, &config.BuilderPullPolicy); err != nil {
+		return nil, err
+	}
+	return pullAndCheck(ctx, &config.BuilderImage, docker, config.BuilderPullPolicy, config)
 }
 
 // GetRebuildImage obtains the metadata information for the image specified in
 // a s2i rebuild operation. Assumptions are made that the build is available
 // locally since it should have been previously built.
-func GetRebuildImage(docker Docker, config *api.Config) (*PullResult, error) {
-	return pullAndCheck(config.Tag, docker, config.BuilderPullPolicy, config)
+func GetRebuildImage(ctx context.Context, docker Docker, config *api.Config) (*PullResult, error) {
+	image := config.Tag
+	return pullAndCheck(ctx, &image, docker, config.BuilderPullPolicy, config)
 }
 
 // GetRuntimeImage processes the config and performs operations necessary to
-// make the Docker image specified as RuntimeImage available locally.
-func GetRuntimeImage(docker Docker, config *api.Config) error {
-	_, err := pullAndCheck(config.RuntimeImage, docker, config.RuntimeImagePullPolicy, config)
+// make the Docker image specified as RuntimeImage available locally. A
+// RuntimeImage referencing an archive is loaded and replaced with the name of
+// the loaded image, and a digest-pinned one pulled from a registry mirror with
+// the mirror reference.
+func GetRuntimeImage(ctx context.Context, docker Docker, config *api.Config) error {
+	if err := loadArchiveImage(ctx, docker, &config.RuntimeImage, &config.RuntimeImagePullPolicy); err != nil {
+		return err
+	}
+	_, err := pullAndCheck(ctx, &config.RuntimeImage, docker, config.RuntimeImagePullPolicy, config)
 	return err
 }
 
@@ -0,0 +1,143 @@
+// Package metrics records the metrics of a build and exposes them in the
+// Prometheus format, either on an HTTP endpoint or in a file for the textfile
+// collector of the node exporter.
+package metrics
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	utilglog "github.com/kubesphere/s2irun/pkg/utils/glog"
+)
+
+var glog = utilglog.StderrLog
+
+const namespace = "s2irun"
+
+// Operation is an image transfer between the Docker daemon and a registry.
+type Operation string
+
+const (
+	// Pull is the pull of an image from its registry.
+	Pull Operation = "pull"
+	// Push is the push of an image to its registry.
+	Push Operation = "push"
+)
+
+// UnknownReason is the failure reason of the failed builds which did not
+// record one.
+const UnknownReason = "Unknown"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	buildDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_duration_seconds",
+		Help:      "Time spent in the recorded stages of the build.",
+	})
+	stageDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_stage_duration_seconds",
+		Help:      "Time spent in each stage of the build.",
+	}, []string{"stage"})
+	stepDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_step_duration_seconds",
+		Help:      "Time spent in each step of the build.",
+	}, []string{"stage", "step"})
+	builds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "builds_total",
+		Help:      "Number of completed builds by result.",
+	}, []string{"result"})
+	buildFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "build_failures_total",
+		Help:      "Number of failed builds by failure reason.",
+	}, []string{"reason"})
+	imageBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_transferred_bytes_total",
+		Help:      "Bytes of image layers pulled from or pushed to registries.",
+	}, []string{"operation"})
+	imageRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_transfer_retries_total",
+		Help:      "Number of retried image pulls and pushes.",
+	}, []string{"operation"})
+)
+
+func init() {
+	registry.MustRegister(buildDuration, stageDuration, stepDuration, builds, buildFailures, imageBytes, imageRetries)
+}
+
+// AddImageBytes records n bytes of image layers transferred by op.
+func AddImageBytes(op Operation, n int64) {
+	if n > 0 {
+		imageBytes.WithLabelValues(string(op)).Add(float64(n))
+	}
+}
+
+// IncImageRetries records a retry of op.
+func IncImageRetries(op Operation) {
+	imageRetries.WithLabelValues(string(op)).Inc()
+}
+
+// RecordResult records the duration of the stages and steps of the build, and
+// its failure reason if it failed.
+func RecordResult(result *api.Result) {
+	var total int64
+	for _, stage := range result.BuildInfo.Stages {
+		total += stage.DurationMilliseconds
+		stageDuration.WithLabelValues(string(stage.Name)).Set(seconds(stage.DurationMilliseconds))
+		for _, step := range stage.Steps {
+			stepDuration.WithLabelValues(string(stage.Name), string(step.Name)).Set(seconds(step.DurationMilliseconds))
+		}
+	}
+	buildDuration.Set(seconds(total))
+
+	if result.Success {
+		builds.WithLabelValues("success").Inc()
+		return
+	}
+	builds.WithLabelValues("failure").Inc()
+	reason := string(result.BuildInfo.FailureReason.Reason)
+	if len(reason) == 0 {
+		reason = UnknownReason
+	}
+	buildFailures.WithLabelValues(reason).Inc()
+}
+
+func seconds(milliseconds int64) float64 {
+	return float64(milliseconds) / 1000
+}
+
+// Serve exposes the metrics on the /metrics path of addr, in the background.
+// It returns once addr is listened on.
+func Serve(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("Serving metrics on %s failed: %v", addr, err)
+		}
+	}()
+	glog.V(1).Infof("Serving metrics on %s/metrics", listener.Addr())
+	return server, nil
+}
+
+// WriteTextfile writes the metrics to the file at path in the format of the
+// textfile collector. The file is replaced atomically.
+func WriteTextfile(path string) error {
+	return prometheus.WriteToTextfile(path, registry)
+}
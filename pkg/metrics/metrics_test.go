@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	utilstatus "github.com/kubesphere/s2irun/pkg/utils/status"
+)
+
+func TestWriteTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s2i-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+	result := &api.Result{
+		BuildInfo: api.BuildInfo{
+			Stages: api.RecordStageAndStepInfo(nil, api.StagePushImage, api.StepPushImage, start, start.Add(2500*time.Millisecond)),
+			FailureReason: utilstatus.NewFailureReason(
+				utilstatus.ReasonPushImageFailed,
+				utilstatus.ReasonMessagePushImageFailed,
+			),
+		},
+	}
+	RecordResult(result)
+	RecordResult(&api.Result{})
+	AddImageBytes(Pull, 1024)
+	AddImageBytes(Push, 0)
+	IncImageRetries(Push)
+
+	path := filepath.Join(dir, "s2irun.prom")
+	if err = WriteTextfile(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`s2irun_build_duration_seconds 0`,
+		`s2irun_build_stage_duration_seconds{stage="PushImage"} 2.5`,
+		`s2irun_build_step_duration_seconds{stage="PushImage",step="PushImage"} 2.5`,
+		`s2irun_builds_total{result="failure"} 2`,
+		`s2irun_build_failures_total{reason="PushImageFailed"} 1`,
+		`s2irun_build_failures_total{reason="Unknown"} 1`,
+		`s2irun_image_transferred_bytes_total{operation="pull"} 1024`,
+		`s2irun_image_transfer_retries_total{operation="push"} 1`,
+	} {
+		if !strings.Contains(string(data), line+"\n") {
+			t.Errorf("expected %q in the metrics:\n%s", line, data)
+		}
+	}
+	if strings.Contains(string(data), `operation="push"} 0`) {
+		t.Errorf("unexpected push bytes in the metrics:\n%s", data)
+	}
+}
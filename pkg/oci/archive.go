@@ -0,0 +1,413 @@
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+)
+
+// dockerArchiveManifest is the file of the archives of docker save listing
+// their images.
+const dockerArchiveManifest = "manifest.json"
+
+// dockerArchiveImage is an image listed in the manifest of the archives of
+// docker save.
+type dockerArchiveImage struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// WriteOCIArchive writes image to w as an OCI image layout archived with tar,
+// referencing it as name in the index when name is set.
+func WriteOCIArchive(w io.Writer, layout *Layout, image *Image, name string) error {
+	tw := tar.NewWriter(w)
+	desc := image.Descriptor
+	if len(name) > 0 {
+		desc.Annotations = map[string]string{v1.AnnotationRefName: name}
+	}
+	index := v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: v1.MediaTypeImageIndex,
+		Manifests: []v1.Descriptor{desc},
+	}
+	if err := writeTarJSON(tw, v1.ImageLayoutFile, v1.ImageLayout{Version: v1.ImageLayoutVersion}); err != nil {
+		return err
+	}
+	if err := writeTarJSON(tw, v1.ImageIndexFile, index); err != nil {
+		return err
+	}
+	blobsDir := path.Join(v1.ImageBlobsDir, string(digest.Canonical))
+	for _, dir := range []string{v1.ImageBlobsDir, blobsDir} {
+		if err := tw.WriteHeader(&tar.Header{Name: dir + "/", Mode: 0755, Typeflag: tar.TypeDir}); err != nil {
+			return err
+		}
+	}
+	written := map[digest.Digest]bool{}
+	for _, blob := range append([]v1.Descriptor{image.Descriptor, image.Manifest.Config}, image.Manifest.Layers...) {
+		if written[blob.Digest] {
+			continue
+		}
+		written[blob.Digest] = true
+		if err := writeTarBlob(tw, layout, path.Join(v1.ImageBlobsDir, blob.Digest.Algorithm().String(), blob.Digest.Encoded()), blob.Digest); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// WriteDockerArchive writes image to w in the format of docker save, tagged
+// with tags once loaded. The layers are stored uncompressed, as docker load
+// expects them.
+func WriteDockerArchive(w io.Writer, layout *Layout, image *Image, tags []string) error {
+	if len(image.Manifest.Layers) != len(image.Config.RootFS.DiffIDs) {
+		return fmt.Errorf("the image %s has %d layers but %d diff IDs", image.Descriptor.Digest, len(image.Manifest.Layers), len(image.Config.RootFS.DiffIDs))
+	}
+	tw := tar.NewWriter(w)
+	entry := dockerArchiveImage{
+		Config:   image.Manifest.Config.Digest.Encoded() + ".json",
+		RepoTags: tags,
+	}
+	if err := writeTarBlob(tw, layout, entry.Config, image.Manifest.Config.Digest); err != nil {
+		return err
+	}
+	written := map[string]bool{}
+	for i, layer := range image.Manifest.Layers {
+		name := path.Join(image.Config.RootFS.DiffIDs[i].Encoded(), "layer.tar")
+		entry.Layers = append(entry.Layers, name)
+		if written[name] {
+			continue
+		}
+		written[name] = true
+		if err := writeTarLayer(tw, layout, name, layer); err != nil {
+			return fmt.Errorf("unable to write the layer %s: %v", layer.Digest, err)
+		}
+	}
+	if err := writeTarJSON(tw, dockerArchiveManifest, []dockerArchiveImage{entry}); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ImportDockerArchive stores in layout the images of the archive of docker
+// save read from r, with their layers uncompressed, and returns them. Each
+// image is referenced in the layout by its first tag.
+func ImportDockerArchive(layout *Layout, r io.Reader) ([]*Image, error) {
+	tr := tar.NewReader(r)
+	blobs := map[string]v1.Descriptor{}
+	links := map[string]string{}
+	var entries []dockerArchiveImage
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid image archive: %v", err)
+		}
+		name := path.Clean(header.Name)
+		switch {
+		case name == dockerArchiveManifest:
+			if err = json.NewDecoder(tr).Decode(&entries); err != nil {
+				return nil, fmt.Errorf("invalid manifest of the image archive: %v", err)
+			}
+		case header.Typeflag == tar.TypeSymlink:
+			// docker save links the layers shared by several images.
+			links[name] = path.Join(path.Dir(name), header.Linkname)
+		case header.Typeflag == tar.TypeReg:
+			// The files are named differently by the versions of docker,
+			// they are all stored until the manifest tells their use.
+			if blobs[name], err = layout.WriteBlob(tr, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if entries == nil {
+		return nil, fmt.Errorf("invalid image archive: no %s", dockerArchiveManifest)
+	}
+
+	blob := func(name, mediaType string) (v1.Descriptor, error) {
+		name = path.Clean(name)
+		if target, ok := links[name]; ok {
+			name = target
+		}
+		desc, ok := blobs[name]
+		if !ok {
+			return v1.Descriptor{}, fmt.Errorf("invalid image archive: no %s", name)
+		}
+		desc.MediaType = mediaType
+		return desc, nil
+	}
+	images := []*Image{}
+	for _, entry := range entries {
+		image := &Image{Manifest: v1.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: v1.MediaTypeImageManifest,
+			Layers:    []v1.Descriptor{},
+		}}
+		var err error
+		if image.Manifest.Config, err = blob(entry.Config, v1.MediaTypeImageConfig); err != nil {
+			return nil, err
+		}
+		if err = layout.ReadJSON(image.Manifest.Config.Digest, &image.Config); err != nil {
+			return nil, fmt.Errorf("invalid image config %s: %v", entry.Config, err)
+		}
+		for _, name := range entry.Layers {
+			layer, err := blob(name, v1.MediaTypeImageLayer)
+			if err != nil {
+				return nil, err
+			}
+			image.Manifest.Layers = append(image.Manifest.Layers, layer)
+		}
+		if image.Descriptor, err = layout.WriteJSON(image.Manifest, v1.MediaTypeImageManifest); err != nil {
+			return nil, err
+		}
+		if len(entry.RepoTags) > 0 {
+			if err = layout.AddManifest(image.Descriptor, entry.RepoTags[0]); err != nil {
+				return nil, err
+			}
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// ImportOCIArchive stores in layout the blobs of the OCI image layout archived
+// with tar read from r, and returns its image: the only image of its index, or
+// the Linux image of the current architecture.
+func ImportOCIArchive(layout *Layout, r io.Reader) (*Image, error) {
+	tr := tar.NewReader(r)
+	var index *v1.Index
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid image archive: %v", err)
+		}
+		name := path.Clean(header.Name)
+		switch {
+		case header.Typeflag != tar.TypeReg:
+		case name == v1.ImageIndexFile:
+			index = &v1.Index{}
+			if err = json.NewDecoder(tr).Decode(index); err != nil {
+				return nil, fmt.Errorf("invalid index of the image archive: %v", err)
+			}
+		case path.Dir(path.Dir(name)) == v1.ImageBlobsDir:
+			expected := digest.NewDigestFromEncoded(digest.Algorithm(path.Base(path.Dir(name))), path.Base(name))
+			desc, err := layout.WriteBlob(tr, "")
+			if err != nil {
+				return nil, err
+			}
+			if desc.Digest != expected {
+				return nil, fmt.Errorf("invalid image archive: the blob %s has the digest %s", name, desc.Digest)
+			}
+		}
+	}
+	if index == nil {
+		return nil, fmt.Errorf("invalid image archive: no %s", v1.ImageIndexFile)
+	}
+
+	for {
+		desc, err := indexManifest(*index)
+		if err != nil {
+			return nil, err
+		}
+		if desc.MediaType != v1.MediaTypeImageIndex && desc.MediaType != dockerManifestListMediaType {
+			image := &Image{}
+			if err = layout.ReadJSON(desc.Digest, &image.Manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest %s: %v", desc.Digest, err)
+			}
+			normalizeManifest(&image.Manifest)
+			if err = layout.ReadJSON(image.Manifest.Config.Digest, &image.Config); err != nil {
+				return nil, fmt.Errorf("invalid image config %s: %v", image.Manifest.Config.Digest, err)
+			}
+			if image.Descriptor, err = layout.WriteJSON(image.Manifest, v1.MediaTypeImageManifest); err != nil {
+				return nil, err
+			}
+			return image, nil
+		}
+		index = &v1.Index{}
+		if err = layout.ReadJSON(desc.Digest, index); err != nil {
+			return nil, fmt.Errorf("invalid index %s: %v", desc.Digest, err)
+		}
+	}
+}
+
+// ImportArchive stores in layout the image of the archive at file, of docker
+// save or of an OCI image layout, possibly gzipped, and returns it.
+func ImportArchive(layout *Layout, file string) (*Image, error) {
+	format, err := ReadArchiveFormat(file)
+	if err != nil {
+		return nil, err
+	}
+	r, err := OpenArchive(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if format == api.OCIArchiveFormat {
+		return ImportOCIArchive(layout, r)
+	}
+	images, err := ImportDockerArchive(layout, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) != 1 {
+		return nil, fmt.Errorf("expected the archive %s to hold one image, got %d", file, len(images))
+	}
+	return images[0], nil
+}
+
+// ReadArchiveFormat returns the format of the image archive at file, possibly
+// gzipped: an archive of docker save holds a manifest.json file, which recent
+// versions of docker add to an OCI image layout too.
+func ReadArchiveFormat(file string) (api.ArchiveFormat, error) {
+	r, err := OpenArchive(file)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
+	layout := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid image archive %s: %v", file, err)
+		}
+		switch path.Clean(header.Name) {
+		case dockerArchiveManifest:
+			return api.DockerArchiveFormat, nil
+		case v1.ImageLayoutFile:
+			layout = true
+		}
+	}
+	if !layout {
+		return "", fmt.Errorf("%s is neither an archive of docker save nor of an OCI image layout", file)
+	}
+	return api.OCIArchiveFormat, nil
+}
+
+// OpenArchive opens the archive at file, decompressing it when it is gzipped.
+func OpenArchive(file string) (io.ReadCloser, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	if magic, _ := r.Peek(2); !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return struct {
+			io.Reader
+			io.Closer
+		}{r, f}, nil
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// indexManifest returns the only manifest of index, or the manifest of the
+// Linux image of the current architecture.
+func indexManifest(index v1.Index) (v1.Descriptor, error) {
+	switch len(index.Manifests) {
+	case 0:
+		return v1.Descriptor{}, errors.New("no image in the index")
+	case 1:
+		return index.Manifests[0], nil
+	}
+	return platformManifest(index)
+}
+
+// writeTarJSON adds to the archive the file name holding v encoded in JSON.
+func writeTarJSON(tw *tar.Writer, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// writeTarBlob adds to the archive the file name holding the blob with the
+// digest d.
+func writeTarBlob(tw *tar.Writer, layout *Layout, name string, d digest.Digest) error {
+	f, err := layout.OpenBlob(d)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size(), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// writeTarLayer adds to the archive the file name holding the uncompressed
+// content of layer. The size of a gzipped layer being unknown, it is
+// decompressed twice rather than stored in a temporary file.
+func writeTarLayer(tw *tar.Writer, layout *Layout, name string, layer v1.Descriptor) error {
+	switch layer.MediaType {
+	case v1.MediaTypeImageLayer:
+		return writeTarBlob(tw, layout, name, layer.Digest)
+	case v1.MediaTypeImageLayerGzip:
+	default:
+		return fmt.Errorf("unsupported layer media type %s", layer.MediaType)
+	}
+	size, err := gunzipBlob(ioutil.Discard, layout, layer.Digest)
+	if err != nil {
+		return err
+	}
+	if err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err = gunzipBlob(tw, layout, layer.Digest)
+	return err
+}
+
+// gunzipBlob writes the decompressed content of the blob with the digest d to
+// w and returns its size.
+func gunzipBlob(w io.Writer, layout *Layout, d digest.Digest) (int64, error) {
+	f, err := layout.OpenBlob(d)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+	return io.Copy(w, gz)
+}
@@ -0,0 +1,231 @@
+package oci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// AssembleOptions describes the layer and the configuration added to a base
+// image by Assemble.
+type AssembleOptions struct {
+	// Dir is the directory whose content is added to the image.
+	Dir string
+	// Destination is the directory of the image the content of Dir is added
+	// to, the working directory of the base image by default.
+	Destination string
+	// Files maps the paths in the image of additional files to their path on
+	// the local filesystem.
+	Files map[string]string
+	// Cmd is the command of the image.
+	Cmd []string
+	// Env holds the environment variables, in "NAME=value" form, set in the
+	// image on top of those of the base image.
+	Env []string
+	// Labels holds the labels of the image, replacing those of the base image.
+	Labels map[string]string
+	// CreatedBy describes the layer in the history of the image.
+	CreatedBy string
+}
+
+// Assemble stores in layout the image made of base and a layer holding the
+// content of opts.Dir and opts.Files, configured by opts. The files of the
+// layer are owned by the user of the base image, when it is given by its ID,
+// and made readable by everyone, as when they are uploaded to a container.
+func Assemble(layout *Layout, base *Image, opts AssembleOptions) (*Image, error) {
+	config := v1.Image{}
+	data, err := json.Marshal(base.Config)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	destination := opts.Destination
+	if len(destination) == 0 {
+		destination = config.Config.WorkingDir
+	}
+	if len(destination) == 0 {
+		destination = "/"
+	}
+	uid, gid := imageOwner(config.Config.User)
+
+	layer, diffID, err := writeLayer(layout, opts, destination, uid, gid)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the image layer: %v", err)
+	}
+
+	now := time.Now().UTC()
+	config.Created = &now
+	config.Config.Cmd = opts.Cmd
+	config.Config.Env = mergeEnv(config.Config.Env, opts.Env)
+	config.Config.Labels = opts.Labels
+	config.RootFS.Type = "layers"
+	config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+	config.History = append(config.History, v1.History{Created: &now, CreatedBy: opts.CreatedBy})
+	configDesc, err := layout.WriteJSON(config, v1.MediaTypeImageConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := v1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: v1.MediaTypeImageManifest,
+		Config:    configDesc,
+		Layers:    append(append([]v1.Descriptor{}, base.Manifest.Layers...), layer),
+	}
+	manifestDesc, err := layout.WriteJSON(manifest, v1.MediaTypeImageManifest)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(2).Infof("Assembled image %s with layer %s", manifestDesc.Digest, layer.Digest)
+	return &Image{Descriptor: manifestDesc, Manifest: manifest, Config: config}, nil
+}
+
+// writeLayer stores the gzipped layer holding the content of opts.Dir under
+// destination and opts.Files, and returns its descriptor and the digest of its
+// uncompressed content.
+func writeLayer(layout *Layout, opts AssembleOptions, destination string, uid, gid int) (v1.Descriptor, digest.Digest, error) {
+	reader, writer := io.Pipe()
+	diffID := digest.Canonical.Digester()
+	go func() {
+		gz := gzip.NewWriter(writer)
+		tw := tar.NewWriter(io.MultiWriter(gz, diffID.Hash()))
+		err := addLayerFiles(tw, opts, destination, uid, gid)
+		if err == nil {
+			err = tw.Close()
+		}
+		if err == nil {
+			err = gz.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	desc, err := layout.WriteBlob(reader, v1.MediaTypeImageLayerGzip)
+	reader.Close()
+	return desc, diffID.Digest(), err
+}
+
+func addLayerFiles(tw *tar.Writer, opts AssembleOptions, destination string, uid, gid int) error {
+	if len(opts.Dir) > 0 {
+		err := filepath.Walk(opts.Dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(opts.Dir, p)
+			if err != nil || rel == "." {
+				return err
+			}
+			return addLayerFile(tw, p, path.Join(destination, filepath.ToSlash(rel)), info, uid, gid)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(opts.Files))
+	for name := range opts.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		info, err := os.Lstat(opts.Files[name])
+		if err != nil {
+			return err
+		}
+		if err = addLayerFile(tw, opts.Files[name], name, info, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addLayerFile adds the file at p to the layer as name. The directories and
+// the executable files are given the 0755 mode, the other files 0644.
+func addLayerFile(tw *tar.Writer, p, name string, info os.FileInfo, uid, gid int) error {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(p); err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	header.Uid, header.Gid = uid, gid
+	header.Uname, header.Gname = "", ""
+	switch {
+	case info.IsDir():
+		header.Name += "/"
+		header.Mode = 0755
+	case info.Mode().IsRegular() && info.Mode()&0111 != 0:
+		header.Mode = 0755
+	case info.Mode().IsRegular():
+		header.Mode = 0644
+	}
+	if err = tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// imageOwner returns the user and group IDs of user, given as "uid" or
+// "uid:gid", and root otherwise.
+func imageOwner(user string) (int, int) {
+	parts := strings.SplitN(user, ":", 2)
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0
+	}
+	gid := 0
+	if len(parts) == 2 {
+		if g, err := strconv.Atoi(parts[1]); err == nil {
+			gid = g
+		}
+	}
+	return uid, gid
+}
+
+// mergeEnv returns the environment variables of base overridden by env.
+func mergeEnv(base, env []string) []string {
+	merged := append([]string{}, base...)
+	for _, e := range env {
+		name := strings.SplitN(e, "=", 2)[0]
+		replaced := false
+		for i, m := range merged {
+			if strings.SplitN(m, "=", 2)[0] == name {
+				merged[i] = e
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, e)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,188 @@
+package oci
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	utilglog "github.com/kubesphere/s2irun/pkg/utils/glog"
+)
+
+var glog = utilglog.StderrLog
+
+// Image is an image whose manifest, config and layers are stored in a Layout.
+type Image struct {
+	// Descriptor is the descriptor of the manifest of the image.
+	Descriptor v1.Descriptor
+	Manifest   v1.Manifest
+	Config     v1.Image
+}
+
+// Size returns the size of the compressed layers of the image.
+func (i *Image) Size() int64 {
+	var size int64
+	for _, layer := range i.Manifest.Layers {
+		size += layer.Size
+	}
+	return size
+}
+
+// Layout is an OCI image layout on the local filesystem. It holds the blobs of
+// the images and an index of their manifests, referenced by name.
+type Layout struct {
+	// Path is the root directory of the layout.
+	Path string
+}
+
+// NewLayout returns the layout at path, creating it when it does not exist.
+func NewLayout(path string) (*Layout, error) {
+	l := &Layout{Path: path}
+	if err := os.MkdirAll(filepath.Join(path, v1.ImageBlobsDir, string(digest.Canonical)), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create the OCI layout %s: %v", path, err)
+	}
+	layoutFile := filepath.Join(path, v1.ImageLayoutFile)
+	if _, err := os.Stat(layoutFile); os.IsNotExist(err) {
+		if err = writeJSONFile(layoutFile, v1.ImageLayout{Version: v1.ImageLayoutVersion}); err != nil {
+			return nil, err
+		}
+	}
+	indexFile := filepath.Join(path, v1.ImageIndexFile)
+	if _, err := os.Stat(indexFile); os.IsNotExist(err) {
+		index := v1.Index{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: v1.MediaTypeImageIndex,
+			Manifests: []v1.Descriptor{},
+		}
+		if err = writeJSONFile(indexFile, index); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// BlobPath returns the path of the blob with the digest d.
+func (l *Layout) BlobPath(d digest.Digest) string {
+	return filepath.Join(l.Path, v1.ImageBlobsDir, d.Algorithm().String(), d.Encoded())
+}
+
+// HasBlob reports whether the layout holds the blob with the digest d.
+func (l *Layout) HasBlob(d digest.Digest) bool {
+	_, err := os.Stat(l.BlobPath(d))
+	return err == nil
+}
+
+// WriteBlob stores the content of r and returns its descriptor.
+func (l *Layout) WriteBlob(r io.Reader, mediaType string) (v1.Descriptor, error) {
+	f, err := ioutil.TempFile(filepath.Join(l.Path, v1.ImageBlobsDir), "s2i-blob")
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	defer os.Remove(f.Name())
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(io.MultiWriter(f, digester.Hash()), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return v1.Descriptor{}, fmt.Errorf("unable to write blob: %v", err)
+	}
+	desc := v1.Descriptor{MediaType: mediaType, Digest: digester.Digest(), Size: size}
+	if err = os.Rename(f.Name(), l.BlobPath(desc.Digest)); err != nil {
+		return v1.Descriptor{}, err
+	}
+	return desc, nil
+}
+
+// WriteJSON stores v encoded in JSON and returns its descriptor.
+func (l *Layout) WriteJSON(v interface{}, mediaType string) (v1.Descriptor, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	return l.WriteBlob(bytes.NewReader(data), mediaType)
+}
+
+// OpenBlob opens the blob with the digest d.
+func (l *Layout) OpenBlob(d digest.Digest) (*os.File, error) {
+	return os.Open(l.BlobPath(d))
+}
+
+// ReadJSON decodes the blob with the digest d into v.
+func (l *Layout) ReadJSON(d digest.Digest, v interface{}) error {
+	data, err := ioutil.ReadFile(l.BlobPath(d))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Index returns the index of the manifests of the layout.
+func (l *Layout) Index() (*v1.Index, error) {
+	index := &v1.Index{}
+	data, err := ioutil.ReadFile(filepath.Join(l.Path, v1.ImageIndexFile))
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("invalid index of the OCI layout %s: %v", l.Path, err)
+	}
+	return index, nil
+}
+
+// AddManifest adds the manifest described by desc to the index of the layout
+// under name, replacing the manifest referenced by the same name before.
+func (l *Layout) AddManifest(desc v1.Descriptor, name string) error {
+	index, err := l.Index()
+	if err != nil {
+		return err
+	}
+	manifests := []v1.Descriptor{}
+	for _, m := range index.Manifests {
+		if m.Annotations[v1.AnnotationRefName] != name {
+			manifests = append(manifests, m)
+		}
+	}
+	desc.Annotations = map[string]string{v1.AnnotationRefName: name}
+	index.Manifests = append(manifests, desc)
+	glog.V(3).Infof("Referencing %s as %s in the OCI layout %s", desc.Digest, name, l.Path)
+	return writeJSONFile(filepath.Join(l.Path, v1.ImageIndexFile), index)
+}
+
+// Image returns the image referenced by name in the layout.
+func (l *Layout) Image(name string) (*Image, error) {
+	index, err := l.Index()
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range index.Manifests {
+		if desc.Annotations[v1.AnnotationRefName] != name {
+			continue
+		}
+		image := &Image{Descriptor: desc}
+		image.Descriptor.Annotations = nil
+		if err = l.ReadJSON(desc.Digest, &image.Manifest); err != nil {
+			return nil, err
+		}
+		if err = l.ReadJSON(image.Manifest.Config.Digest, &image.Config); err != nil {
+			return nil, err
+		}
+		return image, nil
+	}
+	return nil, fmt.Errorf("no image %s in the OCI layout %s", name, l.Path)
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,361 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+)
+
+// fakeRegistry is an in-memory registry requiring a bearer token obtained
+// with basic authentication.
+type fakeRegistry struct {
+	sync.Mutex
+	server    *httptest.Server
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	uploads   int
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	r := &fakeRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+func (r *fakeRegistry) addBlob(data []byte) digest.Digest {
+	d := digest.FromBytes(data)
+	r.blobs[d.String()] = data
+	return d
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+	if req.URL.Path == "/token" {
+		if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"token":"secret-%s"}`, req.URL.Query().Get("scope"))
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/v2/"), "/", 2)
+	repo, rest := parts[0], parts[1]
+	scope := "repository:" + repo + ":pull"
+	if req.Method != http.MethodGet && req.Method != http.MethodHead || strings.HasPrefix(rest, "blobs/uploads") {
+		scope += ",push"
+	}
+	if req.Header.Get("Authorization") != "Bearer secret-"+scope && req.Header.Get("Authorization") != "Bearer secret-repository:"+repo+":pull,push" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case strings.HasPrefix(rest, "manifests/"):
+		key := repo + ":" + strings.TrimPrefix(rest, "manifests/")
+		if req.Method == http.MethodPut {
+			data, _ := ioutil.ReadAll(req.Body)
+			r.manifests[key] = data
+			d := digest.FromBytes(data)
+			r.manifests[repo+":"+d.String()] = data
+			w.Header().Set("Docker-Content-Digest", d.String())
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		data, ok := r.manifests[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var versioned struct {
+			MediaType string `json:"mediaType"`
+		}
+		json.Unmarshal(data, &versioned)
+		w.Header().Set("Content-Type", versioned.MediaType)
+		w.Write(data)
+	case rest == "blobs/uploads/":
+		w.Header().Set("Location", "/v2/"+repo+"/blobs/uploads/1?state=x")
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(rest, "blobs/uploads/"):
+		data, _ := ioutil.ReadAll(req.Body)
+		if digest.FromBytes(data).String() != req.URL.Query().Get("digest") || req.URL.Query().Get("state") != "x" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[req.URL.Query().Get("digest")] = data
+		r.uploads++
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(rest, "blobs/"):
+		data, ok := r.blobs[strings.TrimPrefix(rest, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.Method == http.MethodGet {
+			w.Write(data)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func gzipTar(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestPullAssemblePush(t *testing.T) {
+	registry := newFakeRegistry(t)
+	defer registry.server.Close()
+
+	// a runtime image served with the Docker media types
+	baseLayer := gzipTar(t, map[string]string{"etc/hello": "hello"})
+	baseConfig, _ := json.Marshal(v1.Image{
+		Config: v1.ImageConfig{
+			User:       "1001",
+			WorkingDir: "/opt/app",
+			Env:        []string{"PATH=/usr/bin", "MODE=base"},
+			Labels:     map[string]string{"base": "true"},
+		},
+		RootFS: v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{"sha256:0000000000000000000000000000000000000000000000000000000000000000"}},
+	})
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"mediaType":%q,"digest":%q,"size":%d},"layers":[{"mediaType":%q,"digest":%q,"size":%d}]}`,
+		dockerManifestMediaType, dockerConfigMediaType, registry.addBlob(baseConfig), len(baseConfig), dockerLayerMediaType, registry.addBlob(baseLayer), len(baseLayer))
+	registry.manifests["runtime:1"] = []byte(manifest)
+
+	dir, err := ioutil.TempDir("", "s2i-oci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	layout, err := NewLayout(filepath.Join(dir, "layout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err = NewRegistry(api.AuthConfig{}).Pull(ctx, registry.host()+"/runtime:1", layout); err == nil {
+		t.Fatalf("expected the pull without credentials to fail")
+	}
+	auth := api.AuthConfig{Username: "user", Password: "pass"}
+	base, err := NewRegistry(auth).Pull(ctx, registry.host()+"/runtime:1", layout)
+	if err != nil {
+		t.Fatalf("unexpected error pulling the runtime image: %v", err)
+	}
+	if base.Config.Config.WorkingDir != "/opt/app" || base.Manifest.Layers[0].MediaType != v1.MediaTypeImageLayerGzip {
+		t.Fatalf("unexpected runtime image %+v", base)
+	}
+
+	artifacts := filepath.Join(dir, "artifacts")
+	os.MkdirAll(filepath.Join(artifacts, "lib"), 0700)
+	ioutil.WriteFile(filepath.Join(artifacts, "lib", "app.jar"), []byte("jar"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "run"), []byte("#!/bin/sh"), 0700)
+	image, err := Assemble(layout, base, AssembleOptions{
+		Dir:    artifacts,
+		Files:  map[string]string{"/opt/app/scripts/run": filepath.Join(dir, "run")},
+		Cmd:    []string{"/opt/app/scripts/run"},
+		Env:    []string{"MODE=app", "APP=1"},
+		Labels: map[string]string{"app": "true"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error assembling the image: %v", err)
+	}
+	config := image.Config.Config
+	if !reflect.DeepEqual(config.Cmd, []string{"/opt/app/scripts/run"}) || !reflect.DeepEqual(config.Env, []string{"PATH=/usr/bin", "MODE=app", "APP=1"}) ||
+		!reflect.DeepEqual(config.Labels, map[string]string{"app": "true"}) || config.User != "1001" {
+		t.Errorf("unexpected config %+v", config)
+	}
+	if len(image.Manifest.Layers) != 2 || len(image.Config.RootFS.DiffIDs) != 2 || image.Manifest.Layers[0].Digest != base.Manifest.Layers[0].Digest {
+		t.Fatalf("expected a layer added to the runtime image, got %+v", image.Manifest)
+	}
+
+	// the files of the new layer
+	f, err := layout.OpenBlob(image.Manifest.Layers[1].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffID := digest.Canonical.Digester()
+	content := io.TeeReader(gz, diffID.Hash())
+	tr := tar.NewReader(content)
+	headers := map[string]string{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[h.Name] = fmt.Sprintf("%o %d:%d", h.Mode, h.Uid, h.Gid)
+	}
+	io.Copy(ioutil.Discard, content)
+	expected := map[string]string{
+		"opt/app/lib/":        "755 1001:0",
+		"opt/app/lib/app.jar": "644 1001:0",
+		"opt/app/scripts/run": "755 1001:0",
+	}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("expected the layer files %v, got %v", expected, headers)
+	}
+	if diffID.Digest() != image.Config.RootFS.DiffIDs[1] {
+		t.Errorf("expected the diff ID %s, got %s", diffID.Digest(), image.Config.RootFS.DiffIDs[1])
+	}
+
+	if err = layout.AddManifest(image.Descriptor, "app:v1"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := layout.Image("app:v1")
+	if err != nil || stored.Descriptor.Digest != image.Descriptor.Digest || !reflect.DeepEqual(stored.Config.Config, image.Config.Config) {
+		t.Errorf("unexpected image %+v in the layout: %v", stored, err)
+	}
+
+	// Only the new layer and the config are uploaded, the runtime image
+	// layer being in the registry already.
+	registry.blobs[base.Manifest.Layers[0].Digest.String()] = baseLayer
+	pushed, err := NewRegistry(auth).Push(ctx, image, layout, registry.host()+"/runtime:app")
+	if err != nil {
+		t.Fatalf("unexpected error pushing the image: %v", err)
+	}
+	if pushed != image.Descriptor.Digest.String() || registry.uploads != 2 {
+		t.Errorf("expected %s pushed with 2 uploads, got %s with %d uploads", image.Descriptor.Digest, pushed, registry.uploads)
+	}
+	if _, err = NewRegistry(auth).Push(ctx, image, layout, registry.host()+"/runtime@"+image.Descriptor.Digest.String()); err == nil {
+		t.Errorf("expected an error pushing to a digest")
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull,push"`)
+	expected := map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io", "scope": "repository:library/alpine:pull,push"}
+	if scheme != "Bearer" || !reflect.DeepEqual(params, expected) {
+		t.Errorf("unexpected challenge %s %v", scheme, params)
+	}
+}
+
+func TestParseReferenceScheme(t *testing.T) {
+	r := NewRegistry(api.AuthConfig{}, "http://registry.local:5000/")
+	tests := []struct {
+		image  string
+		scheme string
+		host   string
+	}{
+		{"ruby:2.5", "https", dockerHubRegistry},
+		{"localhost:5000/ruby", "http", "localhost:5000"},
+		{"registry.local:5000/ruby", "http", "registry.local:5000"},
+		{"registry.local/ruby", "https", "registry.local"},
+	}
+	for _, tc := range tests {
+		repo, _, err := r.parseReference(tc.image)
+		if err != nil || repo.scheme != tc.scheme || repo.host != tc.host {
+			t.Errorf("%s: expected %s://%s, got %s://%s (%v)", tc.image, tc.scheme, tc.host, repo.scheme, repo.host, err)
+		}
+	}
+}
+
+func TestArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s2i-oci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	layout, err := NewLayout(filepath.Join(dir, "layout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "run"), []byte("#!/bin/sh"), 0700)
+	image, err := Assemble(layout, &Image{}, AssembleOptions{
+		Files: map[string]string{"/usr/bin/run": filepath.Join(dir, "run")},
+		Cmd:   []string{"/usr/bin/run"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The docker archive holds the layer uncompressed, so that it is imported
+	// with the diff ID as digest and the same config.
+	var archive bytes.Buffer
+	if err = WriteDockerArchive(&archive, layout, image, []string{"app:v1"}); err != nil {
+		t.Fatalf("unexpected error writing the docker archive: %v", err)
+	}
+	imported, err := NewLayout(filepath.Join(dir, "imported"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := ImportDockerArchive(imported, &archive)
+	if err != nil {
+		t.Fatalf("unexpected error importing the docker archive: %v", err)
+	}
+	if len(images) != 1 || images[0].Manifest.Config.Digest != image.Manifest.Config.Digest ||
+		images[0].Manifest.Layers[0].Digest != image.Config.RootFS.DiffIDs[0] || images[0].Manifest.Layers[0].MediaType != v1.MediaTypeImageLayer {
+		t.Fatalf("unexpected imported images %+v", images)
+	}
+	if stored, err := imported.Image("app:v1"); err != nil || stored.Descriptor.Digest != images[0].Descriptor.Digest {
+		t.Errorf("expected the imported image referenced by its tag, got %+v, %v", stored, err)
+	}
+
+	archive.Reset()
+	if err = WriteOCIArchive(&archive, imported, images[0], "app:v1"); err != nil {
+		t.Fatalf("unexpected error writing the OCI archive: %v", err)
+	}
+	tr := tar.NewReader(&archive)
+	files := []string{}
+	var index v1.Index
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, h.Name)
+		if h.Name == v1.ImageIndexFile {
+			json.NewDecoder(tr).Decode(&index)
+		}
+	}
+	blob := func(d digest.Digest) string { return "blobs/sha256/" + d.Encoded() }
+	expected := []string{"oci-layout", "index.json", "blobs/", "blobs/sha256/", blob(images[0].Descriptor.Digest), blob(images[0].Manifest.Config.Digest), blob(images[0].Manifest.Layers[0].Digest)}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected the OCI archive files %v, got %v", expected, files)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Annotations[v1.AnnotationRefName] != "app:v1" {
+		t.Errorf("unexpected index %+v", index)
+	}
+}
@@ -0,0 +1,481 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+)
+
+const (
+	// Docker media types of the images pulled from registries which do not
+	// serve OCI manifests.
+	dockerManifestMediaType     = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerConfigMediaType       = "application/vnd.docker.container.image.v1+json"
+	dockerLayerMediaType        = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+
+	// dockerHubRegistry is the host serving the images of Docker Hub.
+	dockerHubRegistry = "registry-1.docker.io"
+
+	// maxManifestSize bounds the size of the manifests read from a registry.
+	maxManifestSize = 4 << 20
+)
+
+var manifestMediaTypes = []string{
+	v1.MediaTypeImageManifest,
+	v1.MediaTypeImageIndex,
+	dockerManifestMediaType,
+	dockerManifestListMediaType,
+}
+
+// Registry is a client of the registries serving the Docker registry HTTP API
+// V2, which pulls and pushes images stored in a Layout.
+type Registry struct {
+	client *http.Client
+	auth   api.AuthConfig
+	// tokens holds the bearer tokens by repository.
+	tokens map[string]string
+	// insecure holds the hosts of the registries served over plain HTTP.
+	insecure map[string]bool
+}
+
+// NewRegistry returns a registry client authenticating with auth, talking
+// plain HTTP to the insecure registries, such as "registry.local:5000".
+func NewRegistry(auth api.AuthConfig, insecure ...string) *Registry {
+	r := &Registry{
+		client:   http.DefaultClient,
+		auth:     auth,
+		tokens:   map[string]string{},
+		insecure: map[string]bool{},
+	}
+	for _, host := range insecure {
+		if i := strings.Index(host, "://"); i != -1 {
+			host = host[i+3:]
+		}
+		r.insecure[strings.TrimSuffix(host, "/")] = true
+	}
+	return r
+}
+
+// repository is a repository of a registry.
+type repository struct {
+	scheme string
+	host   string
+	name   string
+}
+
+func (r repository) url(format string, args ...interface{}) string {
+	return fmt.Sprintf("%s://%s/v2/%s/", r.scheme, r.host, r.name) + fmt.Sprintf(format, args...)
+}
+
+// parseReference returns the repository of image and its tag or digest.
+func (r *Registry) parseReference(image string) (repository, string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return repository{}, "", fmt.Errorf("invalid image reference %q: %v", image, err)
+	}
+	repo := repository{scheme: "https", host: reference.Domain(named), name: reference.Path(named)}
+	if repo.host == "docker.io" {
+		repo.host = dockerHubRegistry
+	}
+	// The registries on the loopback interface are usually served without
+	// TLS, as the Docker daemon allows.
+	host := repo.host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) || r.insecure[repo.host] {
+		repo.scheme = "http"
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		return repo, digested.Digest().String(), nil
+	}
+	return repo, reference.TagNameOnly(named).(reference.Tagged).Tag(), nil
+}
+
+// Pull pulls image into layout and returns it. A manifest list is resolved to
+// the Linux image of the current architecture. The Docker media types are
+// translated to the OCI ones, so the manifest of the returned image is an OCI
+// manifest referencing the same blobs.
+func (r *Registry) Pull(ctx context.Context, image string, layout *Layout) (*Image, error) {
+	repo, ref, err := r.parseReference(image)
+	if err != nil {
+		return nil, err
+	}
+	data, mediaType, err := r.getManifest(ctx, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	if mediaType == v1.MediaTypeImageIndex || mediaType == dockerManifestListMediaType {
+		index := v1.Index{}
+		if err = json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("invalid manifest list of %s: %v", image, err)
+		}
+		desc, err := platformManifest(index)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", image, err)
+		}
+		if data, mediaType, err = r.getManifest(ctx, repo, desc.Digest.String()); err != nil {
+			return nil, err
+		}
+	}
+	if mediaType != v1.MediaTypeImageManifest && mediaType != dockerManifestMediaType {
+		return nil, fmt.Errorf("unsupported manifest type %q of %s", mediaType, image)
+	}
+
+	pulled := &Image{}
+	if err = json.Unmarshal(data, &pulled.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest of %s: %v", image, err)
+	}
+	normalizeManifest(&pulled.Manifest)
+	for _, desc := range append([]v1.Descriptor{pulled.Manifest.Config}, pulled.Manifest.Layers...) {
+		if err = r.pullBlob(ctx, repo, desc, layout); err != nil {
+			return nil, fmt.Errorf("unable to pull %s: %v", image, err)
+		}
+	}
+	if err = layout.ReadJSON(pulled.Manifest.Config.Digest, &pulled.Config); err != nil {
+		return nil, fmt.Errorf("invalid config of %s: %v", image, err)
+	}
+	if pulled.Descriptor, err = layout.WriteJSON(pulled.Manifest, v1.MediaTypeImageManifest); err != nil {
+		return nil, err
+	}
+	glog.V(2).Infof("Pulled %s (%s) into the OCI layout %s", image, pulled.Descriptor.Digest, layout.Path)
+	return pulled, nil
+}
+
+// normalizeManifest translates the Docker media types of manifest to the OCI
+// ones.
+func normalizeManifest(manifest *v1.Manifest) {
+	manifest.MediaType = v1.MediaTypeImageManifest
+	manifest.Config.MediaType = v1.MediaTypeImageConfig
+	for i, layer := range manifest.Layers {
+		if layer.MediaType == dockerLayerMediaType {
+			manifest.Layers[i].MediaType = v1.MediaTypeImageLayerGzip
+		}
+	}
+}
+
+// platformManifest returns the manifest of the Linux image of the current
+// architecture listed in index.
+func platformManifest(index v1.Index) (v1.Descriptor, error) {
+	for _, desc := range index.Manifests {
+		if desc.Platform != nil && desc.Platform.OS == "linux" && desc.Platform.Architecture == runtime.GOARCH {
+			return desc, nil
+		}
+	}
+	return v1.Descriptor{}, fmt.Errorf("no image for linux/%s in the manifest list", runtime.GOARCH)
+}
+
+func (r *Registry) getManifest(ctx context.Context, repo repository, ref string) ([]byte, string, error) {
+	resp, err := r.do(ctx, repo, "pull", func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, repo.url("manifests/%s", ref), nil)
+		if err == nil {
+			req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+		}
+		return req, err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", responseError(resp, "unable to get the manifest %s of %s", ref, repo.name)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, "", err
+	}
+	mediaType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	if mediaType != v1.MediaTypeImageManifest && mediaType != v1.MediaTypeImageIndex &&
+		mediaType != dockerManifestMediaType && mediaType != dockerManifestListMediaType {
+		// Some registries serve the manifests as plain JSON, the media type
+		// is then read from the manifest itself.
+		var versioned struct {
+			MediaType string `json:"mediaType"`
+		}
+		json.Unmarshal(data, &versioned)
+		mediaType = versioned.MediaType
+	}
+	return data, mediaType, nil
+}
+
+func (r *Registry) pullBlob(ctx context.Context, repo repository, desc v1.Descriptor, layout *Layout) error {
+	if layout.HasBlob(desc.Digest) {
+		return nil
+	}
+	resp, err := r.do(ctx, repo, "pull", func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, repo.url("blobs/%s", desc.Digest), nil)
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp, "unable to get the blob %s", desc.Digest)
+	}
+	written, err := layout.WriteBlob(resp.Body, desc.MediaType)
+	if err != nil {
+		return err
+	}
+	if written.Digest != desc.Digest {
+		return fmt.Errorf("the blob %s has the digest %s", desc.Digest, written.Digest)
+	}
+	return nil
+}
+
+// Push pushes image from layout to tag and returns the digest of its
+// manifest. The blobs already in the repository are not uploaded again.
+func (r *Registry) Push(ctx context.Context, image *Image, layout *Layout, tag string) (string, error) {
+	repo, ref, err := r.parseReference(tag)
+	if err != nil {
+		return "", err
+	}
+	if _, err = digest.Parse(ref); err == nil {
+		return "", fmt.Errorf("cannot push to the digest reference %s", tag)
+	}
+	for _, desc := range append([]v1.Descriptor{image.Manifest.Config}, image.Manifest.Layers...) {
+		if err = r.pushBlob(ctx, repo, desc, layout); err != nil {
+			return "", fmt.Errorf("unable to push %s: %v", tag, err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(layout.BlobPath(image.Descriptor.Digest))
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.do(ctx, repo, "pull,push", func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPut, repo.url("manifests/%s", ref), bytes.NewReader(data))
+		if err == nil {
+			req.Header.Set("Content-Type", image.Descriptor.MediaType)
+		}
+		return req, err
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", responseError(resp, "unable to push the manifest of %s", tag)
+	}
+	pushed := image.Descriptor.Digest.String()
+	if d := resp.Header.Get("Docker-Content-Digest"); len(d) > 0 {
+		pushed = d
+	}
+	glog.V(1).Infof("Pushed %s@%s", tag, pushed)
+	return pushed, nil
+}
+
+func (r *Registry) pushBlob(ctx context.Context, repo repository, desc v1.Descriptor, layout *Layout) error {
+	resp, err := r.do(ctx, repo, "pull,push", func() (*http.Request, error) {
+		return http.NewRequest(http.MethodHead, repo.url("blobs/%s", desc.Digest), nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		glog.V(3).Infof("Blob %s already exists in %s", desc.Digest, repo.name)
+		return nil
+	}
+
+	resp, err = r.do(ctx, repo, "pull,push", func() (*http.Request, error) {
+		return http.NewRequest(http.MethodPost, repo.url("blobs/uploads/"), nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp, "unable to start the upload of the blob %s", desc.Digest)
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location %q: %v", resp.Header.Get("Location"), err)
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest.String())
+	location.RawQuery = query.Encode()
+
+	resp, err = r.do(ctx, repo, "pull,push", func() (*http.Request, error) {
+		f, err := layout.OpenBlob(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPut, location.String(), f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		req.ContentLength = desc.Size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError(resp, "unable to upload the blob %s", desc.Digest)
+	}
+	glog.V(3).Infof("Uploaded blob %s to %s", desc.Digest, repo.name)
+	return nil
+}
+
+// do sends the request returned by newRequest to the repository. A request
+// rejected for its authentication is sent again with the credentials asked by
+// the registry: basic authentication, or a bearer token granting actions on
+// the repository.
+func (r *Registry) do(ctx context.Context, repo repository, actions string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		if token, ok := r.tokens[repo.host+"/"+repo.name+":"+actions]; ok {
+			req.Header.Set("Authorization", token)
+		}
+		return r.client.Do(req)
+	}
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	scheme, params := parseChallenge(challenge)
+	var authorization string
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if len(r.auth.Username) == 0 {
+			return nil, fmt.Errorf("%s requires authentication", repo.host)
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(r.auth.Username, r.auth.Password)
+		authorization = req.Header.Get("Authorization")
+	case "bearer":
+		token, err := r.fetchToken(ctx, params, fmt.Sprintf("repository:%s:%s", repo.name, actions))
+		if err != nil {
+			return nil, err
+		}
+		authorization = "Bearer " + token
+	default:
+		return nil, fmt.Errorf("unsupported authentication %q of %s", challenge, repo.host)
+	}
+	r.tokens[repo.host+"/"+repo.name+":"+actions] = authorization
+	return send()
+}
+
+// fetchToken gets a bearer token for scope from the token server of the
+// challenge, authenticating with the credentials of the registry.
+func (r *Registry) fetchToken(ctx context.Context, params map[string]string, scope string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || len(realm.Host) == 0 {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+
+	var req *http.Request
+	if len(r.auth.IdentityToken) > 0 {
+		query.Set("grant_type", "refresh_token")
+		query.Set("refresh_token", r.auth.IdentityToken)
+		query.Set("client_id", "s2irun")
+		req, err = http.NewRequest(http.MethodPost, realm.String(), strings.NewReader(query.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		realm.RawQuery = query.Encode()
+		req, err = http.NewRequest(http.MethodGet, realm.String(), nil)
+		if err == nil && len(r.auth.Username) > 0 {
+			req.SetBasicAuth(r.auth.Username, r.auth.Password)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError(resp, "unable to get a token for %s from %s", scope, realm.Host)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token from %s: %v", realm.Host, err)
+	}
+	if len(token.AccessToken) > 0 {
+		return token.AccessToken, nil
+	}
+	return token.Token, nil
+}
+
+// parseChallenge parses the WWW-Authenticate header, such as
+// `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	rest := parts[1]
+	for len(rest) > 0 {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return parts[0], params
+}
+
+// responseError returns the error of an unexpected response of a registry,
+// with the errors reported in its body.
+func responseError(resp *http.Response, format string, args ...interface{}) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	message := strings.TrimSpace(string(body))
+	if len(message) == 0 {
+		return fmt.Errorf("%s: %s", fmt.Sprintf(format, args...), resp.Status)
+	}
+	return fmt.Errorf("%s: %s: %s", fmt.Sprintf(format, args...), resp.Status, message)
+}
@@ -2,6 +2,9 @@ package outputresult
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"time"
 
@@ -13,10 +16,27 @@ import (
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 
+	"github.com/distribution/reference"
 	dockertypes "github.com/docker/docker/api/types"
 	utilglog "github.com/kubesphere/s2irun/pkg/utils/glog"
+	godigest "github.com/opencontainers/go-digest"
 )
 
+// StdoutPath is the build result path which writes the result to the standard
+// output.
+const StdoutPath = "-"
+
+// stdout is the standard output the build result is written to, which is kept
+// when the rest of the output is redirected by RedirectStdout.
+var stdout io.Writer = os.Stdout
+
+// RedirectStdout sends what the build writes to the standard output, such as
+// the output of git or the stack dump of SIGQUIT, to the standard error, so
+// that the standard output only holds the build result.
+func RedirectStdout() {
+	os.Stdout = os.Stderr
+}
+
 var (
 	Retry = wait.Backoff{
 		Steps:    10,
@@ -29,13 +49,40 @@ var (
 
 func OutputResult(builderConfig *api.Config, imageInspect *dockertypes.ImageInspect, result *api.Result) *api.Result {
 	// build result info.
-	result.ResultInfo.ImageID = imageInspect.ID
-	result.ResultInfo.ImageCreated = imageInspect.Created
-	result.ResultInfo.ImageRepoTags = imageInspect.RepoTags
+	result.ResultInfo.ImageName = builderConfig.Tag
 	result.ResultInfo.CommandPull = api.CommandPull + builderConfig.Tag
-	result.ResultInfo.ImageSize = imageInspect.Size
+	if imageInspect != nil {
+		result.ResultInfo.ImageID = imageInspect.ID
+		result.ResultInfo.ImageCreated = imageInspect.Created
+		result.ResultInfo.ImageRepoTags = imageInspect.RepoTags
+		result.ResultInfo.ImageRepoDigests = imageInspect.RepoDigests
+		result.ResultInfo.ImageSize = imageInspect.Size
+	}
+	if len(result.ResultInfo.ImageDigest) > 0 {
+		if ref, err := DigestReference(builderConfig.Tag, result.ResultInfo.ImageDigest); err != nil {
+			glog.Warningf("Unable to reference %s by digest %s: %v", builderConfig.Tag, result.ResultInfo.ImageDigest, err)
+		} else {
+			if !containsString(result.ResultInfo.ImageRepoDigests, ref) {
+				result.ResultInfo.ImageRepoDigests = append(result.ResultInfo.ImageRepoDigests, ref)
+			}
+			if builderConfig.PullByDigest {
+				result.ResultInfo.CommandPull = api.CommandPull + ref
+			}
+		}
+	}
+	for _, push := range result.ResultInfo.Pushes {
+		if push.Tag == builderConfig.Tag || len(push.Digest) == 0 {
+			continue
+		}
+		if ref, err := DigestReference(push.Tag, push.Digest); err == nil && !containsString(result.ResultInfo.ImageRepoDigests, ref) {
+			result.ResultInfo.ImageRepoDigests = append(result.ResultInfo.ImageRepoDigests, ref)
+		}
+	}
 
 	// build source info.
+	if builderConfig.SourceInfo == nil {
+		return result
+	}
 	if builderConfig.IsBinaryURL == true {
 		result.SourceInfo.BinaryName = builderConfig.SourceInfo.BinaryName
 		result.SourceInfo.BinarySize = builderConfig.SourceInfo.BinarySize
@@ -43,11 +90,38 @@ func OutputResult(builderConfig *api.Config, imageInspect *dockertypes.ImageInsp
 		result.SourceInfo.CommitID = builderConfig.SourceInfo.CommitID
 		result.SourceInfo.CommitterName = builderConfig.SourceInfo.CommitterName
 		result.SourceInfo.CommitterEmail = builderConfig.SourceInfo.CommitterEmail
+		result.SourceInfo.Refspec = builderConfig.SourceInfo.Refspec
+		if len(builderConfig.SourceInfo.ParentIDs) > 1 {
+			result.SourceInfo.ParentIDs = builderConfig.SourceInfo.ParentIDs
+		}
 	}
 
 	return result
 }
 
+// DigestReference returns the reference to the image named by tag with the
+// given manifest digest, such as "foo/app@sha256:...".
+func DigestReference(tag, digest string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(tag)
+	if err != nil {
+		return "", err
+	}
+	canonical, err := reference.WithDigest(reference.TrimNamed(named), godigest.Digest(digest))
+	if err != nil {
+		return "", err
+	}
+	return reference.FamiliarString(canonical), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 func AddBuildResultToAnnotation(buildResult *api.Result) error {
 	namespace := os.Getenv("POD_NAMESPACE")
 	podName := os.Getenv("POD_NAME")
@@ -83,3 +157,21 @@ func AddBuildResultToAnnotation(buildResult *api.Result) error {
 
 	return retryErr
 }
+
+// WriteBuildResult writes the result of the build as JSON to the file at path,
+// or to the standard output when path is "-".
+func WriteBuildResult(path string, result *api.Result) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == StdoutPath {
+		_, err = stdout.Write(data)
+		return err
+	}
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write the build result to %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package outputresult
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/scm/git"
+	utilstatus "github.com/kubesphere/s2irun/pkg/utils/status"
+)
+
+func TestWriteBuildResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s2i-result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	result := &api.Result{
+		BuildInfo: api.BuildInfo{
+			Stages: api.RecordStageAndStepInfo(nil, api.StagePullImages, api.StepPullBuilderImage, start, start.Add(1500*time.Millisecond)),
+			FailureReason: utilstatus.NewFailureReason(
+				utilstatus.ReasonPushImageFailed,
+				utilstatus.ReasonMessagePushImageFailed,
+			),
+		},
+		ResultInfo: api.OutputResultInfo{ImageName: "docker.io/foo/bar:latest", ImageID: "sha256:abc"},
+		SourceInfo: api.SourceInfo{CommitID: "1234567"},
+	}
+	path := filepath.Join(dir, "result.json")
+	if err = WriteBuildResult(path, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]interface{}
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	expected := map[string]interface{}{
+		"success": false,
+		"buildInfo": map[string]interface{}{
+			"stages": []interface{}{
+				map[string]interface{}{
+					"name":                 "PullImages",
+					"startTime":            "2020-01-02T03:04:05Z",
+					"durationMilliseconds": float64(1500),
+					"steps": []interface{}{
+						map[string]interface{}{
+							"name":                 "PullBuilderImage",
+							"startTime":            "2020-01-02T03:04:05Z",
+							"durationMilliseconds": float64(1500),
+						},
+					},
+				},
+			},
+			"failureReason": map[string]interface{}{
+				"reason":  string(utilstatus.ReasonPushImageFailed),
+				"message": string(utilstatus.ReasonMessagePushImageFailed),
+			},
+		},
+		"resultInfo": map[string]interface{}{
+			"imageName": "docker.io/foo/bar:latest",
+			"imageID":   "sha256:abc",
+		},
+		"sourceInfo": map[string]interface{}{
+			"commitID": "1234567",
+		},
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("got %s", data)
+	}
+
+	if err = WriteBuildResult(filepath.Join(dir, "missing", "result.json"), result); err == nil {
+		t.Errorf("expected an error writing to a missing directory")
+	}
+}
+
+func TestWriteBuildResultToStdout(t *testing.T) {
+	var result bytes.Buffer
+	defer func(out io.Writer, realStdout, realStderr *os.File) {
+		stdout, os.Stdout, os.Stderr = out, realStdout, realStderr
+	}(stdout, os.Stdout, os.Stderr)
+	stderr, err := ioutil.TempFile("", "s2i-stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(stderr.Name())
+	defer stderr.Close()
+	stdout, os.Stderr = &result, stderr
+
+	RedirectStdout()
+	fmt.Fprint(os.Stdout, "Cloning into 'upload/src'...")
+	if err = WriteBuildResult(StdoutPath, &api.Result{Success: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(stderr.Name()); string(data) != "Cloning into 'upload/src'..." {
+		t.Errorf("expected the output redirected to the standard error, got %q", data)
+	}
+	var decoded api.Result
+	if err = json.Unmarshal(result.Bytes(), &decoded); err != nil || !decoded.Success {
+		t.Errorf("expected the standard output to only hold the result, got %q", result.String())
+	}
+}
+
+func TestOutputResultDigest(t *testing.T) {
+	digest := "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+	tests := []struct {
+		name         string
+		tag          string
+		pullByDigest bool
+		repoDigests  []string
+		commandPull  string
+		expected     []string
+	}{
+		{
+			name:        "pull by tag",
+			tag:         "docker.io/foo/app:v1",
+			commandPull: "docker pull docker.io/foo/app:v1",
+			expected:    []string{"foo/app@" + digest},
+		},
+		{
+			name:         "pull by digest",
+			tag:          "registry.example.com:5000/foo/app:v1",
+			pullByDigest: true,
+			commandPull:  "docker pull registry.example.com:5000/foo/app@" + digest,
+			expected:     []string{"registry.example.com:5000/foo/app@" + digest},
+		},
+		{
+			name:         "digest already inspected",
+			tag:          "foo/app",
+			pullByDigest: true,
+			repoDigests:  []string{"foo/app@" + digest},
+			commandPull:  "docker pull foo/app@" + digest,
+			expected:     []string{"foo/app@" + digest},
+		},
+	}
+	for _, tc := range tests {
+		config := &api.Config{Tag: tc.tag, PullByDigest: tc.pullByDigest, SourceInfo: &git.SourceInfo{}}
+		result := &api.Result{ResultInfo: api.OutputResultInfo{ImageDigest: digest}}
+		OutputResult(config, &dockertypes.ImageInspect{RepoDigests: tc.repoDigests}, result)
+		if result.ResultInfo.CommandPull != tc.commandPull {
+			t.Errorf("%s: expected pull command %q, got %q", tc.name, tc.commandPull, result.ResultInfo.CommandPull)
+		}
+		if !reflect.DeepEqual(result.ResultInfo.ImageRepoDigests, tc.expected) {
+			t.Errorf("%s: expected repo digests %v, got %v", tc.name, tc.expected, result.ResultInfo.ImageRepoDigests)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/api/validation"
+	"github.com/kubesphere/s2irun/pkg/scm/git"
+)
+
+const (
+	// StdinConfigPath is the config path which reads the configuration from
+	// the standard input.
+	StdinConfigPath = "-"
+	// ConfigEnvPrefix is the prefix of the environment variables which
+	// override the fields of the configuration, such as S2I_TAG.
+	ConfigEnvPrefix = "S2I_"
+)
+
+// LoadConfig reads the build configuration, in JSON or YAML format, from the
+// file at path or from the standard input when path is "-". The S2I_*
+// environment variables are applied on top of it.
+func LoadConfig(path string) (*api.Config, error) {
+	var data []byte
+	var err error
+	switch path {
+	case "":
+		return nil, fmt.Errorf("no config file provided, set the %s environment variable", ConfigEnvVariable)
+	case StdinConfigPath:
+		data, err = ioutil.ReadAll(os.Stdin)
+	default:
+		data, err = ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("config file does not exist, please check the path: %s", path)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %s: %v", path, err)
+	}
+
+	cfg, err := DecodeConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("there are some errors in config file %s: %v", path, err)
+	}
+	if err = ApplyEnvironment(cfg, os.Environ()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// DecodeConfig decodes a build configuration. The format, JSON or YAML, is
+// detected from the content. Unknown fields are rejected.
+func DecodeConfig(data []byte) (*api.Config, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("the config is empty")
+	}
+	if !bytes.HasPrefix(data, []byte("{")) {
+		var err error
+		if data, err = yaml.YAMLToJSON(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkFields(data); err != nil {
+		return nil, err
+	}
+	cfg := new(api.Config)
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, describeDecodeError(data, err)
+	}
+	return cfg, nil
+}
+
+// describeDecodeError turns the error of the JSON decoder into one which
+// points at the offending field or position.
+func describeDecodeError(data []byte, err error) error {
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		if len(e.Field) == 0 {
+			return fmt.Errorf("cannot use %s as the config, expected an object", e.Value)
+		}
+		return fmt.Errorf("invalid value for field %q: cannot use %s as %s", e.Field, e.Value, e.Type)
+	case *json.SyntaxError:
+		// The offset points right after the offending character.
+		line, column := position(data, e.Offset-1)
+		return fmt.Errorf("syntax error at line %d, column %d: %v", line, column, e)
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return errors.New("unexpected end of the config")
+	}
+	return err
+}
+
+// position returns the line and column of the byte at offset in data.
+func position(data []byte, offset int64) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// ApplyEnvironment overrides the fields of cfg with the S2I_* variables of
+// environ, given in "NAME=value" form. The name of the variable is the JSON
+// path of the field in upper snake case, such as S2I_BUILDER_IMAGE for
+// builderImage or S2I_DOCKER_CONFIG_ENDPOINT for dockerConfig.endpoint.
+func ApplyEnvironment(cfg *api.Config, environ []string) error {
+	env := map[string]string{}
+	for _, e := range environ {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[0], ConfigEnvPrefix) {
+			env[parts[0]] = parts[1]
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	_, err := applyEnvironment(reflect.ValueOf(cfg).Elem(), strings.TrimSuffix(ConfigEnvPrefix, "_"), "", env)
+	return err
+}
+
+// applyEnvironment sets the fields of the struct v from env and reports
+// whether any of them was set.
+func applyEnvironment(v reflect.Value, prefix, path string, env map[string]string) (bool, error) {
+	applied := false
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if len(name) == 0 || name == "-" {
+			continue
+		}
+		envName := prefix + "_" + upperSnakeCase(name)
+		fieldPath := name
+		if len(path) > 0 {
+			fieldPath = path + "." + name
+		}
+		field := v.Field(i)
+
+		// Descend into the nested configuration structs of the api package,
+		// allocating the pointers only when one of their fields is set.
+		if st := structType(field.Type()); st != nil {
+			if field.Kind() == reflect.Ptr {
+				nested := reflect.New(st)
+				if !field.IsNil() {
+					nested.Elem().Set(field.Elem())
+				}
+				ok, err := applyEnvironment(nested.Elem(), envName, fieldPath, env)
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					field.Set(nested)
+					applied = true
+				}
+				continue
+			}
+			ok, err := applyEnvironment(field, envName, fieldPath, env)
+			if err != nil {
+				return false, err
+			}
+			applied = applied || ok
+			continue
+		}
+
+		value, ok := env[envName]
+		if !ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return false, fmt.Errorf("invalid value %q of %s for field %q: %v", value, envName, fieldPath, err)
+		}
+		applied = true
+	}
+	return applied, nil
+}
+
+// structType returns the struct type of t, or of the element of t when it is
+// a pointer, if the struct is defined in the api package.
+func structType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct && t.PkgPath() == reflect.TypeOf(api.Config{}).PkgPath() {
+		return t
+	}
+	return nil
+}
+
+// setField parses value into field. The types implementing pflag.Value use
+// the same syntax as the command line flags.
+func setField(field reflect.Value, value string) error {
+	if field.CanAddr() {
+		if pv, ok := field.Addr().Interface().(pflag.Value); ok {
+			field.Set(reflect.Zero(field.Type()))
+			return pv.Set(value)
+		}
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		items := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = reflect.Append(items, reflect.ValueOf(item).Convert(field.Type().Elem()))
+			}
+		}
+		field.Set(items)
+	case reflect.Map:
+		if field.Type().Key().Kind() != reflect.String || field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		m := reflect.MakeMap(field.Type())
+		for _, item := range strings.Split(value, ",") {
+			kv := strings.SplitN(item, "=", 2)
+			if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+				return fmt.Errorf("invalid format %q, must be name=value", item)
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(kv[0])), reflect.ValueOf(strings.TrimSpace(kv[1])))
+		}
+		field.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// upperSnakeCase converts a JSON field name such as "sourceURL" or
+// "allowedUIDs" to upper snake case ("SOURCE_URL", "ALLOWED_UIDS").
+func upperSnakeCase(name string) string {
+	runes := []rune(name)
+	var buf bytes.Buffer
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			// An upper case letter starts a new word after a lower case one,
+			// or when it ends an acronym followed by a word ("URLPath"), but
+			// not a plural acronym ("UIDs").
+			endsAcronym := unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) &&
+				!(runes[i+1] == 's' && (i+2 == len(runes) || unicode.IsUpper(runes[i+2])))
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || endsAcronym {
+				buf.WriteRune('_')
+			}
+		}
+		buf.WriteRune(unicode.ToUpper(r))
+	}
+	return buf.String()
+}
+
+// CompleteConfig fills in the fields of the configuration which are derived
+// from the values provided by the user, such as the parsed source location and
+// the fully qualified name of the output image. A tag template is completed
+// once it is expanded, after the source is downloaded.
+func CompleteConfig(cfg *api.Config) error {
+	var err error
+	if len(cfg.SourceURL) > 0 {
+		cfg.Source, err = git.Parse(cfg.SourceURL, cfg.IsBinaryURL)
+		if err != nil {
+			return fmt.Errorf("SourceURL is illegal, please check the error:\n%v", err)
+		}
+	}
+	return completeTag(cfg)
+}
+
+// completeTag qualifies the Tag of cfg with the registry of its push
+// authentication, unless it is a template.
+func completeTag(cfg *api.Config) error {
+	if len(cfg.Tag) == 0 || validation.IsTagTemplate(cfg.Tag) {
+		return nil
+	}
+	tag, err := api.Parse(cfg.Tag, cfg.PushAuthentication.ServerAddress)
+	if err != nil {
+		return fmt.Errorf("there are some errors in image name, please check the error:\n%v", err)
+	}
+	cfg.Tag = tag
+	return nil
+}
@@ -0,0 +1,148 @@
+package run
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+)
+
+func TestDecodeConfig(t *testing.T) {
+	expected := &api.Config{
+		BuilderImage:      "kubesphere/java-8-centos7:v2.1.0",
+		Tag:               "kubesphere/app:v1",
+		BuilderPullPolicy: api.PullIfNotPresent,
+		Export:            true,
+		Environment:       api.EnvironmentList{{Name: "MAVEN_OPTS", Value: "-Xmx1g"}},
+		DockerConfig:      &api.DockerConfig{Endpoint: "unix:///var/run/docker.sock"},
+	}
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "json",
+			data: `{
+				"builderImage": "kubesphere/java-8-centos7:v2.1.0",
+				"tag": "kubesphere/app:v1",
+				"builderPullPolicy": "if-not-present",
+				"export": true,
+				"environment": [{"name": "MAVEN_OPTS", "value": "-Xmx1g"}],
+				"dockerConfig": {"endpoint": "unix:///var/run/docker.sock"}
+			}`,
+		},
+		{
+			name: "yaml",
+			data: `
+builderImage: kubesphere/java-8-centos7:v2.1.0
+tag: kubesphere/app:v1
+builderPullPolicy: if-not-present
+export: true
+environment:
+- name: MAVEN_OPTS
+  value: -Xmx1g
+dockerConfig:
+  endpoint: unix:///var/run/docker.sock
+`,
+		},
+	}
+	for _, tc := range tests {
+		cfg, err := DecodeConfig([]byte(tc.data))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, expected) {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, expected, cfg)
+		}
+	}
+}
+
+func TestDecodeConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{"empty", "  \n", "the config is empty"},
+		{"json type", `{"dockerConfig": {"endpoint": 2375}}`, `field "dockerConfig.endpoint"`},
+		{"yaml type", "export: [true]", `field "export"`},
+		{"json syntax", "{\n\"tag\": \"app\",\n}", "line 3, column 1"},
+		{"yaml syntax", "tag: app\n  builderImage: builder", "line 2"},
+		{"not an object", "- tag", "expected an object"},
+		{"unknown field", `{"tag": "app", "sorceURL": "https://github.com/kubesphere/s2irun"}`, `unknown field "sorceURL", did you mean "sourceURL"?`},
+		{"unknown nested field", "dockerConfig:\n  endpont: tcp://docker:2375", `unknown field "dockerConfig.endpont", did you mean "dockerConfig.endpoint"?`},
+		{"unknown list field", `{"environment": [{"name": "A", "valeu": "b"}]}`, `unknown field "environment[0].valeu", did you mean "environment[0].value"?`},
+		{"unknown field without suggestion", `{"imageName": "app"}`, `unknown field "imageName"`},
+		{"field in another case", `{"sourceUrl": "https://github.com/kubesphere/s2irun"}`, `unknown field "sourceUrl", did you mean "sourceURL"?`},
+		{"nested field in another case", `{"pushAuthentication": {"UserName": "user"}}`, `unknown field "pushAuthentication.UserName", did you mean "pushAuthentication.username"?`},
+	}
+	for _, tc := range tests {
+		_, err := DecodeConfig([]byte(tc.data))
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", tc.name, tc.expected, err)
+		}
+	}
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	cfg := &api.Config{
+		Tag:         "file/app:v1",
+		Environment: api.EnvironmentList{{Name: "FROM", Value: "file"}},
+	}
+	environ := []string{
+		"S2I_CONFIG_PATH=/root/data/config.json",
+		"S2I_TAG=env/app:v2",
+		"S2I_BUILDER_IMAGE=env/builder",
+		"S2I_INCREMENTAL=true",
+		"S2I_BUILDER_PULL_POLICY=never",
+		"S2I_ENVIRONMENT=FROM=env",
+		"S2I_DROP_CAPABILITIES=KILL,MKNOD",
+		"S2I_LABELS=a=1,b=2",
+		"S2I_DOCKER_CONFIG_ENDPOINT=tcp://docker:2375",
+		"S2I_PUSH_AUTHENTICATION_USERNAME=user",
+		"HOME=/root",
+	}
+	if err := ApplyEnvironment(cfg, environ); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &api.Config{
+		Tag:                "env/app:v2",
+		BuilderImage:       "env/builder",
+		Incremental:        true,
+		BuilderPullPolicy:  api.PullNever,
+		Environment:        api.EnvironmentList{{Name: "FROM", Value: "env"}},
+		DropCapabilities:   []string{"KILL", "MKNOD"},
+		Labels:             map[string]string{"a": "1", "b": "2"},
+		DockerConfig:       &api.DockerConfig{Endpoint: "tcp://docker:2375"},
+		PushAuthentication: api.AuthConfig{Username: "user"},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected %#v, got %#v", expected, cfg)
+	}
+
+	err := ApplyEnvironment(cfg, []string{"S2I_INCREMENTAL=maybe"})
+	if err == nil || !strings.Contains(err.Error(), "S2I_INCREMENTAL") {
+		t.Errorf("expected an error pointing at S2I_INCREMENTAL, got %v", err)
+	}
+}
+
+func TestUpperSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"tag":           "TAG",
+		"builderImage":  "BUILDER_IMAGE",
+		"sourceURL":     "SOURCE_URL",
+		"isBinaryURL":   "IS_BINARY_URL",
+		"revisionId":    "REVISION_ID",
+		"allowedUIDs":   "ALLOWED_UIDS",
+		"cGroupLimits":  "C_GROUP_LIMITS",
+		"useTLS":        "USE_TLS",
+		"scriptsURLDir": "SCRIPTS_URL_DIR",
+	}
+	for name, expected := range tests {
+		if got := upperSnakeCase(name); got != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, got)
+		}
+	}
+}
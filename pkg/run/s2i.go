@@ -2,38 +2,43 @@ package run
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/api/describe"
 	"github.com/kubesphere/s2irun/pkg/api/validation"
+	"github.com/kubesphere/s2irun/pkg/build"
 	"github.com/kubesphere/s2irun/pkg/build/strategies"
+	"github.com/kubesphere/s2irun/pkg/build/strategies/sti"
 	"github.com/kubesphere/s2irun/pkg/docker"
 	s2ierr "github.com/kubesphere/s2irun/pkg/errors"
-	"github.com/kubesphere/s2irun/pkg/scm/git"
+	"github.com/kubesphere/s2irun/pkg/metrics"
+	"github.com/kubesphere/s2irun/pkg/outputresult"
+	"github.com/kubesphere/s2irun/pkg/tracing"
 	utilglog "github.com/kubesphere/s2irun/pkg/utils/glog"
-	"os"
+	"github.com/kubesphere/s2irun/pkg/utils/interrupt"
 )
 
 const (
 	ConfigEnvVariable = "S2I_CONFIG_PATH"
+
+	// tracingExportTimeout bounds the time spent exporting the trace spans.
+	tracingExportTimeout = 10 * time.Second
 )
 
 var glog = utilglog.StderrLog
 
-// S2I Just run the command
-func S2I(cfg *api.Config) error {
-	cfg.DockerConfig = docker.GetDefaultDockerConfig()
-	if len(cfg.AsDockerfile) > 0 {
-		if cfg.RunImage {
-			return fmt.Errorf("ERROR: --run cannot be used with --as-dockerfile")
-		}
-		if len(cfg.RuntimeImage) > 0 {
-			return fmt.Errorf("ERROR: --runtime-image cannot be used with --as-dockerfile")
-		}
-	}
-	if cfg.Incremental && len(cfg.RuntimeImage) > 0 {
-		return fmt.Errorf("ERROR: Incremental build with runtime image isn't supported")
+// setDefaults fills in the defaults for the Docker connection and the image
+// pull policies which were not provided by the user.
+func setDefaults(cfg *api.Config) {
+	if cfg.DockerConfig == nil {
+		cfg.DockerConfig = docker.GetDefaultDockerConfig()
 	}
 	//set default image pull policy
 	if len(cfg.BuilderPullPolicy) == 0 {
@@ -45,6 +50,21 @@ func S2I(cfg *api.Config) error {
 	if len(cfg.RuntimeImagePullPolicy) == 0 {
 		cfg.RuntimeImagePullPolicy = api.DefaultRuntimeImagePullPolicy
 	}
+}
+
+// prepareConfig sets the defaults on cfg, validates it, sets up the log format
+// and resolves the registry credentials which are not given. It returns the
+// keychain the credentials were resolved from.
+func prepareConfig(cfg *api.Config) (*docker.Keychain, error) {
+	setDefaults(cfg)
+	if len(cfg.AsDockerfile) > 0 {
+		if cfg.RunImage {
+			return nil, fmt.Errorf("ERROR: --run cannot be used with --as-dockerfile")
+		}
+		if len(cfg.RuntimeImage) > 0 && !cfg.OCIAssemble {
+			return nil, fmt.Errorf("ERROR: --runtime-image cannot be used with --as-dockerfile unless --oci-assemble is set")
+		}
+	}
 	if errs := validation.ValidateConfig(cfg); len(errs) > 0 {
 		var buf bytes.Buffer
 		for _, e := range errs {
@@ -52,27 +72,96 @@ func S2I(cfg *api.Config) error {
 			buf.WriteString(e.Error())
 			buf.WriteString("\n")
 		}
-		return fmt.Errorf(buf.String())
+		return nil, fmt.Errorf(buf.String())
 	}
+	if cfg.LogFormat == utilglog.JSONFormat {
+		utilglog.SetSink(utilglog.NewJSONSink(os.Stderr))
+	}
+	paths := cfg.DockerConfigPaths
+	if len(paths) == 0 {
+		paths = docker.DefaultDockerConfigPaths()
+	}
+	keychain, err := docker.LoadKeychain(paths)
+	if err != nil {
+		return nil, err
+	}
+	docker.ResolveAuthentications(cfg, keychain)
+	return keychain, nil
+}
 
-	client, err := docker.NewEngineAPIClient(cfg.DockerConfig)
+// S2I Just run the command
+func S2I(cfg *api.Config) error {
+	keychain, err := prepareConfig(cfg)
 	if err != nil {
 		return err
 	}
+	if cfg.BuildResultPath == outputresult.StdoutPath {
+		outputresult.RedirectStdout()
+	}
 
-	d := docker.New(client, cfg.PullAuthentication, cfg.PushAuthentication)
-	err = d.CheckReachable()
+	client, err := docker.NewClient(cfg.DockerConfig)
 	if err != nil {
 		return err
 	}
 
-	glog.V(9).Infof("\n%s\n", describe.Config(client, cfg))
+	// Generating a Dockerfile does not talk to the Docker daemon at all.
+	if len(cfg.AsDockerfile) == 0 {
+		d := docker.NewForConfig(client, cfg)
+		if err = d.CheckReachable(); err != nil {
+			return err
+		}
+	}
+
+	// The metrics are served until the result of the build is reported, and
+	// for the grace period following it, as a failure exits the process.
+	stopMetrics := func() {}
+	if len(cfg.MetricsAddress) > 0 {
+		server, err := metrics.Serve(cfg.MetricsAddress)
+		if err != nil {
+			return fmt.Errorf("unable to serve metrics on %s: %v", cfg.MetricsAddress, err)
+		}
+		stopMetrics = func() {
+			closeMetrics(server, cfg.MetricsGracePeriodSeconds)
+		}
+	}
+
+	start := time.Now()
+	ctx, cancel := buildContext(cfg)
+	defer cancel()
+	// The sources of the pulled images, such as the registry mirrors, are
+	// reported in the build info.
+	pulls := &docker.PullRecorder{}
+	ctx = docker.WithPullRecorder(ctx, pulls)
+	// The credentials of the tags which are templates are resolved once the
+	// templates are expanded.
+	ctx = docker.WithKeychain(ctx, keychain)
 
-	builder, _, err := strategies.GetStrategy(client, cfg)
+	glog.V(9).Infof("\n%s\n", describe.Config(ctx, client, cfg))
+
+	builder, buildInfo, err := strategies.GetStrategy(ctx, client, cfg)
+	if err != nil {
+		buildInfo.ImageSources = pulls.Sources()
+		reportResult(cfg, &api.Result{BuildInfo: buildInfo}, start)
+		stopMetrics()
+	}
 	s2ierr.CheckError(err)
-	result, err := builder.Build(cfg)
+
+	// A termination signal cancels the build, which stops and removes its
+	// containers before returning.
+	var result *api.Result
+	err = runUntilSignal(cancel, func() error {
+		var buildErr error
+		result, buildErr = builder.Build(ctx, cfg)
+		return buildErr
+	})
+	if result == nil {
+		result = &api.Result{}
+	}
+	result.BuildInfo.ImageSources = pulls.Sources()
+	reportResult(cfg, result, start)
+	stopMetrics()
 	if err != nil {
-		glog.V(0).Infof("Build failed")
+		glog.V(0).Infof(failureMessage(ctx, cfg))
 		s2ierr.CheckError(err)
 		return err
 	} else {
@@ -91,30 +180,193 @@ func S2I(cfg *api.Config) error {
 	return nil
 }
 
-func App() int {
-	var apiConfig = new(api.Config)
-	path := os.Getenv(ConfigEnvVariable)
-	file, err := os.Open(path)
-	defer file.Close()
-	if os.IsNotExist(err) {
-		glog.Errorf("Config file does not exist,please check the path: %s", path)
-		return 1
+// reportResult records the metrics of the build which started at start, and
+// writes its result, metrics and trace spans to the destinations set in cfg.
+// A failure to write them is logged, it does not fail the build.
+func reportResult(cfg *api.Config, result *api.Result, start time.Time) {
+	if len(cfg.BuildResultPath) > 0 {
+		if err := outputresult.WriteBuildResult(cfg.BuildResultPath, result); err != nil {
+			glog.Errorf("%v", err)
+		}
+	}
+	metrics.RecordResult(result)
+	if len(cfg.MetricsTextfilePath) > 0 {
+		if err := metrics.WriteTextfile(cfg.MetricsTextfilePath); err != nil {
+			glog.Errorf("Unable to write the metrics to %s: %v", cfg.MetricsTextfilePath, err)
+		}
+	}
+
+	if len(cfg.TracingEndpoint) == 0 && len(cfg.TracingFilePath) == 0 {
+		return
+	}
+	spans := tracing.SpansFromResult(cfg, result, start, time.Now())
+	if len(cfg.TracingFilePath) > 0 {
+		if err := tracing.WriteFile(cfg.TracingFilePath, spans); err != nil {
+			glog.Errorf("Unable to write the trace spans to %s: %v", cfg.TracingFilePath, err)
+		}
 	}
+	if len(cfg.TracingEndpoint) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingExportTimeout)
+		defer cancel()
+		if err := tracing.Export(ctx, cfg.TracingEndpoint, spans); err != nil {
+			glog.Errorf("Unable to export the trace spans: %v", err)
+		}
+	}
+}
+
+// closeMetrics stops serving the metrics once the grace period of
+// gracePeriodSeconds following the build is over.
+func closeMetrics(server *http.Server, gracePeriodSeconds int64) {
+	if gracePeriodSeconds > 0 {
+		glog.V(1).Infof("Serving the metrics for %d more seconds", gracePeriodSeconds)
+		time.Sleep(time.Duration(gracePeriodSeconds) * time.Second)
+	}
+	server.Close()
+}
+
+// buildContext returns the context of the build, which expires after
+// cfg.BuildDeadlineSeconds when set.
+func buildContext(cfg *api.Config) (context.Context, context.CancelFunc) {
+	if cfg.BuildDeadlineSeconds > 0 {
+		return context.WithTimeout(context.Background(), time.Duration(cfg.BuildDeadlineSeconds)*time.Second)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// failureMessage returns the message logged for a build which failed, telling
+// whether it was cancelled or exceeded its deadline through ctx.
+func failureMessage(ctx context.Context, cfg *api.Config) string {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return fmt.Sprintf("Build did not complete within %d seconds", cfg.BuildDeadlineSeconds)
+	case context.Canceled:
+		return "Build cancelled"
+	default:
+		return "Build failed"
+	}
+}
 
-	jsonParser := json.NewDecoder(file)
-	err = jsonParser.Decode(apiConfig)
+// runUntilSignal runs fn, calling cancel when a termination signal is caught
+// so that fn stops and removes its containers before returning. The context
+// cancel belongs to is left as it is when fn returns on its own.
+func runUntilSignal(cancel context.CancelFunc, fn func() error) error {
+	return interrupt.New(func(signal os.Signal) {
+		cancelBuild(signal)
+		cancel()
+	}).Run(fn)
+}
+
+// cancelBuild is called once the build was cancelled by a termination signal.
+// Unlike the default handler it does not exit, so that the build can remove
+// its containers.
+func cancelBuild(signal os.Signal) {
+	if signal == syscall.SIGQUIT {
+		buf := make([]byte, 1<<16)
+		runtime.Stack(buf, true)
+		fmt.Printf("%s", buf)
+	}
+	glog.V(0).Infof("Received %v, cancelling the build ...", signal)
+}
+
+// Usage runs the usage script of the builder image.
+func Usage(cfg *api.Config) error {
+	cfg.Usage = true
+	if _, err := prepareConfig(cfg); err != nil {
+		return err
+	}
+	client, err := docker.NewClient(cfg.DockerConfig)
 	if err != nil {
-		glog.Errorf("There are some errors in config file, please check the error:\n%v", err)
-		return 1
+		return err
 	}
-	apiConfig.Source, err = git.Parse(apiConfig.SourceURL, apiConfig.IsBinaryURL)
+	// A termination signal kills and removes the container running the
+	// usage script.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	return runUntilSignal(cancel, func() error {
+		uh, err := sti.NewUsage(ctx, client, cfg)
+		if err != nil {
+			return err
+		}
+		return uh.Show()
+	})
+}
+
+// Describe returns the human readable description of the build described by cfg.
+func Describe(cfg *api.Config) (string, error) {
+	setDefaults(cfg)
+	client, err := docker.NewClient(cfg.DockerConfig)
 	if err != nil {
-		glog.Errorf("SourceURL is illegal, please check the error:\n%v", err)
-		return 1
+		return "", err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var description string
+	err = runUntilSignal(cancel, func() error {
+		description = describe.Config(ctx, client, cfg)
+		return nil
+	})
+	return description, err
+}
+
+// Rebuild builds image again from the builder image, source and commit
+// recorded in its labels, and tags the new image with cfg.Tag, or with image
+// when cfg has no tag. The source of cfg is used when the labels do not record
+// it, as for the images built by s2irun. The tag is qualified with the
+// registry of the push authentication, as that of a build.
+func Rebuild(cfg *api.Config, image string) error {
+	setDefaults(cfg)
+	if len(cfg.Tag) == 0 {
+		cfg.Tag = image
+	}
+	if err := completeTag(cfg); err != nil {
+		return err
 	}
-	apiConfig.Tag, err = api.Parse(apiConfig.Tag, apiConfig.PushAuthentication.ServerAddress)
+	client, err := docker.NewClient(cfg.DockerConfig)
 	if err != nil {
-		glog.Errorf("There are some errors in image name, please check the error:\n%v", err)
+		return err
+	}
+	paths := cfg.DockerConfigPaths
+	if len(paths) == 0 {
+		paths = docker.DefaultDockerConfigPaths()
+	}
+	keychain, err := docker.LoadKeychain(paths)
+	if err != nil {
+		return err
+	}
+	auth, ok := keychain.Resolve(image)
+	if !ok {
+		auth = cfg.PushAuthentication
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = runUntilSignal(cancel, func() error {
+		previous, err := docker.GetRebuildImage(ctx, docker.New(client, auth, api.AuthConfig{}), &api.Config{
+			Tag:               image,
+			BuilderPullPolicy: cfg.PreviousImagePullPolicy,
+			AllowedUIDs:       cfg.AllowedUIDs,
+			AssembleUser:      cfg.AssembleUser,
+		})
+		if err != nil {
+			return err
+		}
+		return build.GenerateConfigFromLabels(cfg, previous)
+	})
+	if err != nil {
+		return err
+	}
+	return S2I(cfg)
+}
+
+// App runs a build from the config file pointed to by the S2I_CONFIG_PATH
+// environment variable and returns the process exit code.
+func App() int {
+	apiConfig, err := LoadConfig(os.Getenv(ConfigEnvVariable))
+	if err != nil {
+		glog.Errorf("%v", err)
+		return 1
+	}
+	if err = CompleteConfig(apiConfig); err != nil {
+		glog.Errorf("%v", err)
 		return 1
 	}
 	err = S2I(apiConfig)
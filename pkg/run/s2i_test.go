@@ -0,0 +1,81 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+)
+
+func TestRunUntilSignal(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    func(ctx context.Context) error
+		expected string
+	}{
+		{
+			name:     "build failure",
+			build:    func(ctx context.Context) error { return errors.New("assemble failed") },
+			expected: "Build failed",
+		},
+		{
+			name: "termination signal",
+			build: func(ctx context.Context) error {
+				if process, err := os.FindProcess(os.Getpid()); err == nil {
+					process.Signal(syscall.SIGTERM)
+				}
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			expected: "Build cancelled",
+		},
+	}
+	for _, tc := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		err := runUntilSignal(cancel, func() error { return tc.build(ctx) })
+		if err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if message := failureMessage(ctx, &api.Config{}); message != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, message)
+		}
+		cancel()
+	}
+}
+
+func TestRebuildInvalidTag(t *testing.T) {
+	tests := []struct {
+		tag   string
+		image string
+	}{
+		{tag: "Foo/App:v1", image: "foo/app:v1"},
+		{image: "Foo/App:v1"},
+	}
+	for _, tc := range tests {
+		// The tag is rejected before the previous image is looked up.
+		err := Rebuild(&api.Config{Tag: tc.tag}, tc.image)
+		if err == nil || !strings.Contains(err.Error(), "image name") {
+			t.Errorf("%q %q: expected the invalid tag rejected, got %v", tc.tag, tc.image, err)
+		}
+	}
+}
+
+func TestCompleteTag(t *testing.T) {
+	tests := []struct {
+		config   api.Config
+		expected string
+	}{
+		{config: api.Config{Tag: "foo/app"}, expected: "docker.io/foo/app:latest"},
+		{config: api.Config{Tag: "foo/app:v1", PushAuthentication: api.AuthConfig{ServerAddress: "https://registry.example.com"}}, expected: "registry.example.com/foo/app:v1"},
+		{config: api.Config{Tag: "{{.Env.REGISTRY}}/foo/app:v1"}, expected: "{{.Env.REGISTRY}}/foo/app:v1"},
+	}
+	for _, tc := range tests {
+		if err := completeTag(&tc.config); err != nil || tc.config.Tag != tc.expected {
+			t.Errorf("expected %q, got %q (%v)", tc.expected, tc.config.Tag, err)
+		}
+	}
+}
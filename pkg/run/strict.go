@@ -0,0 +1,126 @@
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/api/schema"
+)
+
+// checkFields returns an error listing the keys of the JSON encoded config
+// which do not match any field of api.Config, along with the closest field
+// name. Keys only differing in case from a field name are rejected too, unlike
+// encoding/json, so that the config is spelled like its schema. Malformed JSON
+// is left for the decoder to report.
+func checkFields(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil
+	}
+	var errs []string
+	walkFields(reflect.TypeOf(api.Config{}), value, "", &errs)
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// walkFields checks the keys of the decoded JSON value against the type t it
+// decodes into, appending an error to errs for every unknown key.
+func walkFields(t reflect.Type, value interface{}, path string, errs *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			// Type mismatches are reported by the decoder.
+			return
+		}
+		fields := schema.Fields(t)
+		for _, key := range sortedKeys(obj) {
+			field, ok := fields[key]
+			if !ok {
+				*errs = append(*errs, unknownField(path, key, fields))
+				continue
+			}
+			walkFields(field.Type, obj[key], fieldPath(path, key), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			walkFields(t.Elem(), item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, key := range sortedKeys(obj) {
+			walkFields(t.Elem(), obj[key], fieldPath(path, key), errs)
+		}
+	}
+}
+
+// unknownField describes the unknown key found at path, suggesting the
+// closest field name if there is one.
+func unknownField(path, key string, fields map[string]reflect.StructField) string {
+	msg := fmt.Sprintf("unknown field %q", fieldPath(path, key))
+	best, bestDistance := "", -1
+	for name := range fields {
+		d := levenshtein(strings.ToLower(key), strings.ToLower(name))
+		if bestDistance < 0 || d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	if bestDistance >= 0 && (bestDistance <= 2 || bestDistance <= len(key)/3) {
+		msg += fmt.Sprintf(", did you mean %q?", fieldPath(path, best))
+	}
+	return msg
+}
+
+func fieldPath(path, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -1,6 +1,7 @@
 package binary
 
 import (
+	"context"
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/api/constants"
 	"github.com/kubesphere/s2irun/pkg/scm/git"
@@ -11,7 +12,6 @@ import (
 	"net/http"
 	"path/filepath"
 	"strconv"
-	"strings"
 )
 
 var glog = utilglog.StderrLog
@@ -23,13 +23,18 @@ type File struct {
 }
 
 // Download download sources from a http link into the working directory.
-// Caller guarantees that config.Source.IsLocal() is true.
-func (f *File) Download(config *api.Config) (*git.SourceInfo, error) {
+// Caller guarantees that config.Source.IsLocal() is true. The download is
+// aborted when ctx is done.
+func (f *File) Download(ctx context.Context, config *api.Config) (*git.SourceInfo, error) {
 	_, filename := filepath.Split(config.Source.String())
 	config.WorkingSourceDir = filepath.Join(config.WorkingDir, constants.Source)
 	binaryPath := filepath.Join(config.WorkingSourceDir, filename)
 	glog.V(0).Infof("Start Download Binary %s", filename)
-	resp, err := http.Get(config.Source.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.Source.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -44,22 +49,28 @@ func (f *File) Download(config *api.Config) (*git.SourceInfo, error) {
 	strsize := resp.Header.Get("Content-Length")
 	size, _ := strconv.ParseUint(strsize, 10, 64)
 
-	counter := &WriteCounter{Size: size}
+	counter := &WriteCounter{Size: size, Progress: utilglog.NewProgressReporter(glog, "download", filename)}
 	_, err = io.Copy(out, io.TeeReader(resp.Body, counter))
+	counter.Progress.Done()
+	if err != nil {
+		return nil, err
+	}
 	glog.V(0).Infof("Finish Download Binary %s", filename)
 	glog.V(0).Infof("Binary size %s", bytefmt.ByteSize(counter.Total))
 	return &git.SourceInfo{
-		Location:   config.Source.String(),
+		Location:   config.Source.StringNoCredentials(),
 		ContextDir: config.ContextDir,
 		BinaryName: filename,
 		BinarySize: counter.Total,
 	}, nil
 }
 
-// write cycle.
+// WriteCounter counts the bytes written to it and reports the progress of the
+// download, Size being zero when the size of the download is unknown.
 type WriteCounter struct {
-	Total uint64
-	Size  uint64
+	Total    uint64
+	Size     uint64
+	Progress *utilglog.ProgressReporter
 }
 
 func (wc *WriteCounter) Write(p []byte) (int, error) {
@@ -69,17 +80,10 @@ func (wc *WriteCounter) Write(p []byte) (int, error) {
 	return n, nil
 }
 
+// PrintProgress reports the progress of the download, at most once per
+// utilglog.DefaultProgressInterval.
 func (wc WriteCounter) PrintProgress() {
-	// Clear the line by using a character return to go back to the start and remove
-	// the remaining characters by filling it with spaces
-	glog.V(0).Infof("\r%s", strings.Repeat(" ", 35))
-
-	// Return again and print current status of download
-	// We use the humanize package to print the bytes in a meaningful way (e.g. 10 MB)
-	if wc.Size > 0 {
-		glog.V(0).Infof("\rDownloading... %s/%s", bytefmt.ByteSize(wc.Total), bytefmt.ByteSize(wc.Size))
-	} else {
-		glog.V(0).Infof("\rDownloading... %s complete", bytefmt.ByteSize(wc.Total))
+	if wc.Progress != nil {
+		wc.Progress.Update(wc.Total, wc.Size)
 	}
-
 }
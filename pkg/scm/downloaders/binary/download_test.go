@@ -1,6 +1,7 @@
 package binary
 
 import (
+	"context"
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/scm/git"
 	testfs "github.com/kubesphere/s2irun/pkg/test/fs"
@@ -15,7 +16,7 @@ func TestDownload(t *testing.T) {
 		Source:      git.MustParse("https://kubesphere.io/etcd-operator.svg"),
 		IsBinaryURL: true,
 	}
-	info, err := f.Download(config)
+	info, err := f.Download(context.Background(), config)
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -1,6 +1,7 @@
 package empty
 
 import (
+	"context"
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/scm/git"
 	utilglog "github.com/kubesphere/s2irun/pkg/utils/glog"
@@ -14,7 +15,7 @@ type Noop struct {
 }
 
 // Download is a no-op downloader so that Noop satisfies build.Downloader
-func (n *Noop) Download(config *api.Config) (*git.SourceInfo, error) {
+func (n *Noop) Download(ctx context.Context, config *api.Config) (*git.SourceInfo, error) {
 	glog.V(1).Info("No source location defined (the assemble script is responsible for obtaining the source)")
 
 	return &git.SourceInfo{}, nil
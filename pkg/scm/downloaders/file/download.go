@@ -1,6 +1,7 @@
 package file
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -27,7 +28,7 @@ type File struct {
 
 // Download copies sources from a local directory into the working directory.
 // Caller guarantees that config.Source.IsLocal() is true.
-func (f *File) Download(config *api.Config) (*git.SourceInfo, error) {
+func (f *File) Download(ctx context.Context, config *api.Config) (*git.SourceInfo, error) {
 	config.WorkingSourceDir = filepath.Join(config.WorkingDir, constants.Source)
 
 	copySrc := config.Source.LocalPath()
@@ -1,6 +1,7 @@
 package file
 
 import (
+	"context"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -17,7 +18,7 @@ func TestDownload(t *testing.T) {
 	config := &api.Config{
 		Source: git.MustParse("/foo"),
 	}
-	info, err := f.Download(config)
+	info, err := f.Download(context.Background(), config)
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -37,7 +38,7 @@ func TestDownloadRecursive(t *testing.T) {
 		Source:     git.MustParse("some/a/../path"),
 		WorkingDir: "b/../some/path/target",
 	}
-	_, err := f.Download(config)
+	_, err := f.Download(context.Background(), config)
 	if err == nil {
 		t.Errorf("Expected recursive copy error, got nil")
 	}
@@ -54,7 +55,7 @@ func TestDownloadWithContext(t *testing.T) {
 		Source:     git.MustParse("/foo"),
 		ContextDir: "bar",
 	}
-	info, err := f.Download(config)
+	info, err := f.Download(context.Background(), config)
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
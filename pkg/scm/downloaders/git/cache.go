@@ -0,0 +1,98 @@
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"github.com/kubesphere/s2irun/pkg/scm/git"
+)
+
+// mirrorRefspec fetches all the refs of the remote into a mirror.
+const mirrorRefspec = "+refs/*:refs/*"
+
+// defaultPorts are the ports left out of the cache keys of the URLs of their
+// scheme.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ssh":   "22",
+	"git":   "9418",
+}
+
+// cacheKey returns the key of the mirror of source, the same for the URLs of
+// a repository which differ by their scheme, credentials, ref or .git suffix.
+// The port is part of the key, unless it is the default port of the scheme.
+func cacheKey(source *git.URL) string {
+	path := strings.TrimSuffix(strings.TrimSuffix(source.URL.Path, "/"), ".git")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	host := source.URL.Host
+	if source.Type == git.URLTypeURL && source.URL.Port() == defaultPorts[strings.ToLower(source.URL.Scheme)] {
+		host = source.URL.Hostname()
+	}
+	return strings.ToLower(host) + path
+}
+
+// mirrorPath returns the mirror of source in the cache directory.
+func mirrorPath(cacheDir string, source *git.URL) string {
+	sum := sha256.Sum256([]byte(cacheKey(source)))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:])+".git")
+}
+
+// updateMirror fetches the source into its mirror in the cache directory, or
+// creates the mirror when it is missing. The mirror is locked until the
+// returned unlock function is called, so that the processes sharing the cache
+// neither update it nor clone with it at the same time. A mirror which cannot
+// be fetched into is left as it is for the other builds.
+func (c *Clone) updateMirror(ctx context.Context, cacheDir string, source *git.URL) (*git.CacheInfo, func(), error) {
+	if err := c.MkdirAll(cacheDir); err != nil {
+		return nil, nil, err
+	}
+	mirror := mirrorPath(cacheDir, source)
+	unlock, err := lockFile(ctx, mirror+".lock")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.Exists(mirror) {
+		err = c.Fetch(ctx, mirror, git.FetchConfig{
+			Remote:   source.StringNoFragment(),
+			Refspecs: []string{mirrorRefspec},
+			Prune:    true,
+		})
+		if err != nil {
+			unlock()
+			return nil, nil, fmt.Errorf("unable to update the mirror %q: %v", mirror, err)
+		}
+		glog.V(1).Infof("Git cache hit for %q, updated the mirror %q", source.StringNoCredentials(), mirror)
+		return &git.CacheInfo{Mirror: mirror, Hit: true}, unlock, nil
+	}
+
+	// The mirror is cloned aside, so that a clone which is interrupted is not
+	// taken for the mirror. The credentials embedded in the URL of the source
+	// are not kept in the config of the shared mirror, which is always fetched
+	// into from the URL of the build.
+	tmp := mirror + ".tmp"
+	c.RemoveDirectory(tmp)
+	err = c.Clone(ctx, source, tmp, git.CloneConfig{Mirror: true, Quiet: true})
+	if err == nil {
+		err = c.SetRemoteURL(tmp, source.StringNoCredentials())
+	}
+	if err == nil {
+		err = c.Rename(tmp, mirror)
+	}
+	if err != nil {
+		c.RemoveDirectory(tmp)
+		unlock()
+		return nil, nil, err
+	}
+	glog.V(1).Infof("Git cache miss for %q, created the mirror %q", source.StringNoCredentials(), mirror)
+	return &git.CacheInfo{Mirror: mirror}, unlock, nil
+}
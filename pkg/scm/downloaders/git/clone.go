@@ -1,16 +1,42 @@
 package git
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/golang/glog"
 
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/api/constants"
 	"github.com/kubesphere/s2irun/pkg/scm/git"
+	"github.com/kubesphere/s2irun/pkg/utils"
 	"github.com/kubesphere/s2irun/pkg/utils/fs"
 )
 
+// The local refs the commits of a refspec build are fetched to.
+const (
+	fetchedSourceRef = "refs/s2i/source"
+	fetchedTargetRef = "refs/s2i/target"
+)
+
+// lfsAttributeRegexp matches the lines of .gitattributes storing files in Git
+// LFS.
+var lfsAttributeRegexp = regexp.MustCompile(`(?m)^[^#\n].*\sfilter=lfs(\s|$)`)
+
+// LFSPullError indicates the files of the source stored in Git LFS could not
+// be pulled.
+type LFSPullError struct {
+	error
+}
+
+// commitRegexp matches the revisions which are commits rather than branches or
+// tags.
+var commitRegexp = regexp.MustCompile("^[0-9a-f]{7,40}$")
+
 // Clone knows how to clone a Git repository.
 type Clone struct {
 	git.Git
@@ -18,8 +44,9 @@ type Clone struct {
 }
 
 // Download downloads the application source code from the Git repository
-// and checkout the Ref specified in the config.
-func (c *Clone) Download(config *api.Config) (*git.SourceInfo, error) {
+// and checkout the Ref specified in the config. The clone is aborted when ctx
+// is done.
+func (c *Clone) Download(ctx context.Context, config *api.Config) (*git.SourceInfo, error) {
 	targetSourceDir := filepath.Join(config.WorkingDir, constants.Source)
 	config.WorkingSourceDir = targetSourceDir
 
@@ -27,12 +54,20 @@ func (c *Clone) Download(config *api.Config) (*git.SourceInfo, error) {
 	if RevisionId == "" {
 		RevisionId = "HEAD"
 	}
+	// The commit of a refspec is fetched once the branch it is merged into, or
+	// the remote HEAD, is cloned.
+	if len(config.SourceRefspec) > 0 {
+		RevisionId = config.MergeInto
+		if RevisionId == "" {
+			RevisionId = "HEAD"
+		}
+	}
 
 	if len(config.ContextDir) > 0 {
 		targetSourceDir = filepath.Join(config.WorkingDir, constants.ContextTmp)
-		glog.V(9).Infof("Downloading %q (%q) ...", config.Source, config.ContextDir)
+		glog.V(9).Infof("Downloading %q (%q) ...", config.Source.StringNoCredentials(), config.ContextDir)
 	} else {
-		glog.V(9).Infof("Downloading %q ...", config.Source)
+		glog.V(9).Infof("Downloading %q ...", config.Source.StringNoCredentials())
 	}
 
 	if !config.IgnoreSubmodules {
@@ -41,28 +76,72 @@ func (c *Clone) Download(config *api.Config) (*git.SourceInfo, error) {
 		glog.V(2).Infof("Cloning sources (ignoring submodules) into %q", targetSourceDir)
 	}
 
-	cloneConfig := git.CloneConfig{Quiet: false}
-	err := c.Clone(config.Source, targetSourceDir, cloneConfig)
+	cloneConfig := cloneConfigFor(config, RevisionId)
+	var cache *git.CacheInfo
+	unlock := func() {}
+	if len(config.GitCacheDir) > 0 && config.Source.Type != git.URLTypeLocal {
+		var err error
+		cache, unlock, err = c.updateMirror(ctx, config.GitCacheDir, config.Source)
+		if err != nil {
+			glog.Warningf("Unable to use the git cache %q, cloning without it: %v", config.GitCacheDir, err)
+			unlock = func() {}
+		} else {
+			cloneConfig.Reference = cache.Mirror
+		}
+	}
+	err := c.Clone(ctx, config.Source, targetSourceDir, cloneConfig)
+	unlock()
 	if err != nil {
 		glog.V(0).Infof("error: git clone failed: %v", err)
 		return nil, err
 	}
 
-	err = c.Checkout(targetSourceDir, RevisionId)
+	if cloneConfig.Sparse {
+		if err = c.SparseCheckout(targetSourceDir, config.ContextDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.SourceRefspec) > 0 {
+		err = c.checkoutRefspec(ctx, targetSourceDir, config.SourceRefspec, config.MergeInto, cloneConfig)
+		RevisionId = config.SourceRefspec
+	} else {
+		err = c.Checkout(targetSourceDir, RevisionId)
+		if err != nil && (cloneConfig.Depth > 0 || cloneConfig.SingleBranch) {
+			glog.V(1).Infof("%q is not in the cloned history, fetching more of it: %v", RevisionId, err)
+			err = c.fetchRevision(ctx, targetSourceDir, RevisionId, cloneConfig)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	glog.V(0).Infof("Checked out to %q", RevisionId)
 	if !config.IgnoreSubmodules {
-		err = c.SubmoduleUpdate(targetSourceDir, true, true)
+		err = c.SubmoduleUpdate(ctx, targetSourceDir, true, true)
 		if err != nil {
 			return nil, err
 		}
 		glog.V(0).Infof("Updated submodules for %q", RevisionId)
 	}
 
+	if !config.DisableGitLFS && c.usesLFS(targetSourceDir, config.ContextDir) {
+		var include []string
+		if len(config.ContextDir) > 0 {
+			include = []string{filepath.ToSlash(filepath.Clean(config.ContextDir)) + "/**"}
+		}
+		if err = c.LFSPull(ctx, targetSourceDir, include...); err != nil {
+			return nil, LFSPullError{fmt.Errorf("unable to pull the Git LFS objects of %q: %v", config.Source.StringNoCredentials(), err)}
+		}
+		glog.V(0).Infof("Pulled the Git LFS objects for %q", RevisionId)
+	}
+
 	info := c.GetInfo(targetSourceDir)
+	info.Cache = cache
+	if len(config.SourceRefspec) > 0 {
+		info.Refspec = config.SourceRefspec
+		info.Ref = utils.FirstNonEmpty(config.MergeInto, refspecSource(config.SourceRefspec))
+	}
 	if len(config.ContextDir) > 0 {
 		originalTargetDir := filepath.Join(config.WorkingDir, constants.Source)
 		c.RemoveDirectory(originalTargetDir)
@@ -80,3 +159,115 @@ func (c *Clone) Download(config *api.Config) (*git.SourceInfo, error) {
 
 	return info, nil
 }
+
+// cloneConfigFor returns the options of the clone of the source of config to
+// check out revision.
+func cloneConfigFor(config *api.Config, revision string) git.CloneConfig {
+	cloneConfig := git.CloneConfig{
+		Quiet:        false,
+		Depth:        config.CloneDepth,
+		SingleBranch: config.CloneSingleBranch,
+		Sparse:       config.CloneSparse && len(config.ContextDir) > 0,
+	}
+	if config.ClonePartial {
+		cloneConfig.Filter = "blob:none"
+	}
+	// A shallow or single branch clone holds the branch or tag to check out,
+	// a commit is fetched when it is not in the history of the remote HEAD.
+	if (cloneConfig.Depth > 0 || cloneConfig.SingleBranch) && revision != "HEAD" && !commitRegexp.MatchString(revision) {
+		cloneConfig.Branch = revision
+	}
+	return cloneConfig
+}
+
+// fetchRevision checks out the revision missing from a shallow or single
+// branch clone, fetching the commit alone first, then the whole history.
+func (c *Clone) fetchRevision(ctx context.Context, repo, revision string, cloneConfig git.CloneConfig) error {
+	if len(revision) == 40 && commitRegexp.MatchString(revision) {
+		err := c.Fetch(ctx, repo, git.FetchConfig{Refspecs: []string{revision}, Depth: cloneConfig.Depth})
+		if err == nil {
+			if err = c.Checkout(repo, revision); err == nil {
+				return nil
+			}
+		}
+		glog.V(1).Infof("Unable to fetch the commit %q alone, fetching the whole history: %v", revision, err)
+	}
+	fetchConfig := git.FetchConfig{Unshallow: cloneConfig.Depth > 0}
+	if cloneConfig.SingleBranch {
+		fetchConfig.Refspecs = []string{"+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*"}
+	}
+	if err := c.Fetch(ctx, repo, fetchConfig); err != nil {
+		return err
+	}
+	return c.Checkout(repo, revision)
+}
+
+// refspecSource returns the remote ref of refspec, such as refs/pull/42/head
+// for +refs/pull/42/head:refs/remotes/pr/42.
+func refspecSource(refspec string) string {
+	return strings.SplitN(strings.TrimPrefix(refspec, "+"), ":", 2)[0]
+}
+
+// checkoutRefspec fetches the commit of refspec and checks it out, or its
+// merge into the target branch when target is set. The whole history of a
+// shallow clone is fetched when the merge fails without it.
+func (c *Clone) checkoutRefspec(ctx context.Context, repo, refspec, target string, cloneConfig git.CloneConfig) error {
+	fetchConfig := git.FetchConfig{
+		Refspecs: []string{"+" + refspecSource(refspec) + ":" + fetchedSourceRef},
+		Depth:    cloneConfig.Depth,
+	}
+	if len(target) > 0 {
+		fetchConfig.Refspecs = append(fetchConfig.Refspecs, "+refs/heads/"+target+":"+fetchedTargetRef)
+	}
+	if err := c.Fetch(ctx, repo, fetchConfig); err != nil {
+		return err
+	}
+	if len(target) == 0 {
+		return c.Checkout(repo, fetchedSourceRef)
+	}
+
+	if err := c.Checkout(repo, fetchedTargetRef); err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Merge %s into %s", refspecSource(refspec), target)
+	err := c.Merge(repo, fetchedSourceRef, message)
+	if err != nil && cloneConfig.Depth > 0 {
+		glog.V(1).Infof("Unable to merge in the shallow history, fetching the whole history: %v", err)
+		fetchConfig.Depth = 0
+		fetchConfig.Unshallow = true
+		if err = c.Fetch(ctx, repo, fetchConfig); err != nil {
+			return err
+		}
+		err = c.Merge(repo, fetchedSourceRef, message)
+	}
+	if err != nil {
+		return err
+	}
+	glog.V(0).Infof("Merged %q into %q", refspecSource(refspec), target)
+	return nil
+}
+
+// usesLFS returns true if the .gitattributes of the repository, or of the
+// directories of contextDir, store files in Git LFS.
+func (c *Clone) usesLFS(repo, contextDir string) bool {
+	dir := repo
+	dirs := []string{dir}
+	if len(contextDir) > 0 {
+		for _, name := range strings.Split(filepath.ToSlash(filepath.Clean(contextDir)), "/") {
+			dir = filepath.Join(dir, name)
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		r, err := c.Open(filepath.Join(dir, ".gitattributes"))
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err == nil && lfsAttributeRegexp.Match(data) {
+			return true
+		}
+	}
+	return false
+}
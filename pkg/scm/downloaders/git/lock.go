@@ -0,0 +1,42 @@
+//go:build !windows
+
+package git
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+)
+
+// lockPollInterval is how often a lock held by another process is tried again.
+const lockPollInterval = 100 * time.Millisecond
+
+// lockFile takes an exclusive lock of the file, creating it, until ctx is
+// done. The lock is released by the returned function, or when the process
+// exits.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return func() {
+				syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+				file.Close()
+			}, nil
+		}
+		if err != syscall.EWOULDBLOCK && err != syscall.EINTR {
+			file.Close()
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package git
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// lockPollInterval is how often a lock held by another process is tried again.
+const lockPollInterval = 100 * time.Millisecond
+
+// lockFile takes an exclusive lock of the file by creating it, until ctx is
+// done. The lock is released by the returned function, which removes the
+// file, and is left held by a process which exits without calling it.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package git
+
+import (
+	"strings"
+)
+
+// Auth is the authentication of the git commands talking to the remote of a
+// repository.
+type Auth struct {
+	// Username and Password are the credentials of the HTTPS remotes.
+	Username string
+	Password string
+	// SSHKeyPath is the private key of the SSH remotes, and KnownHostsPath
+	// the known_hosts file their host keys are checked against.
+	SSHKeyPath     string
+	KnownHostsPath string
+}
+
+// The environment variables the credential helper reads the credentials
+// from.
+const (
+	usernameEnv = "S2I_GIT_USERNAME"
+	passwordEnv = "S2I_GIT_PASSWORD"
+)
+
+// credentialHelper answers the requests of git for credentials with those of
+// the environment, so that they are neither on the command line nor in the
+// config of the cloned repository.
+const credentialHelper = `!f() { test "$1" = get && echo "username=${` + usernameEnv + `}" && echo "password=${` + passwordEnv + `}"; }; f`
+
+// args returns the options of git setting the credential helper.
+func (a Auth) args() []string {
+	if len(a.Password) == 0 {
+		return nil
+	}
+	// The empty helper resets the helpers configured for the user.
+	return []string{"-c", "credential.helper=", "-c", "credential.helper=" + credentialHelper}
+}
+
+// env returns the environment of the git commands holding the credentials
+// and the SSH command.
+func (a Auth) env() []string {
+	env := []string{}
+	if len(a.Password) > 0 {
+		env = append(env, usernameEnv+"="+a.Username, passwordEnv+"="+a.Password, "GIT_TERMINAL_PROMPT=0")
+	}
+	if len(a.SSHKeyPath) > 0 || len(a.KnownHostsPath) > 0 {
+		env = append(env, "GIT_SSH_COMMAND="+a.sshCommand())
+	}
+	return env
+}
+
+// sshCommand returns the SSH command authenticating with the private key and
+// checking the host keys against the known_hosts file.
+func (a Auth) sshCommand() string {
+	command := []string{"ssh"}
+	if len(a.SSHKeyPath) > 0 {
+		command = append(command, "-i", shellQuote(a.SSHKeyPath), "-o", "IdentitiesOnly=yes")
+	}
+	if len(a.KnownHostsPath) > 0 {
+		command = append(command, "-o", "UserKnownHostsFile="+shellQuote(a.KnownHostsPath), "-o", "StrictHostKeyChecking=yes")
+	}
+	return strings.Join(command, " ")
+}
+
+// shellQuote quotes s as a single word of the shell running GIT_SSH_COMMAND.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
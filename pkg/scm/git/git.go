@@ -2,6 +2,7 @@ package git
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -21,26 +22,51 @@ import (
 var glog = utilglog.StderrLog
 var lsTreeRegexp = regexp.MustCompile("([0-7]{6}) [^ ]+ [0-9a-f]{40}\t(.*)")
 
+// lfsSkipSmudge keeps the Git LFS filter, when installed on the host, from
+// downloading the LFS objects while checking out: they are only fetched by
+// LFSPull, for the paths it is given.
+var lfsSkipSmudge = []string{"GIT_LFS_SKIP_SMUDGE=1"}
+
 // Git is an interface used by main STI code to extract/checkout git repositories
 type Git interface {
-	Clone(source *URL, target string, opts CloneConfig) error
+	Clone(ctx context.Context, source *URL, target string, opts CloneConfig) error
 	Checkout(repo, ref string) error
-	SubmoduleUpdate(repo string, init, recursive bool) error
+	Fetch(ctx context.Context, repo string, opts FetchConfig) error
+	Merge(repo, ref, message string) error
+	SetRemoteURL(repo, url string) error
+	SparseCheckout(repo string, paths ...string) error
+	SubmoduleUpdate(ctx context.Context, repo string, init, recursive bool) error
+	LFSPull(ctx context.Context, repo string, include ...string) error
 	LsTree(repo, ref string, recursive bool) ([]os.FileInfo, error)
 	GetInfo(string) *SourceInfo
 }
 
 // New returns a new instance of the default implementation of the Git interface
 func New(fs fs.FileSystem, runner cmd.CommandRunner) Git {
+	return NewWithAuth(fs, runner, Auth{})
+}
+
+// NewWithAuth returns a new instance of the default implementation of the Git
+// interface authenticating to the remotes with auth.
+func NewWithAuth(fs fs.FileSystem, runner cmd.CommandRunner, auth Auth) Git {
 	return &stiGit{
 		FileSystem:    fs,
 		CommandRunner: runner,
+		auth:          auth,
 	}
 }
 
 type stiGit struct {
 	fs.FileSystem
 	cmd.CommandRunner
+	auth Auth
+}
+
+// run runs git with the given arguments, authenticating to the remote, which
+// a partial clone talks to when checking out too.
+func (h *stiGit) run(opts cmd.CommandOpts, args ...string) error {
+	opts.EnvAppend = append(opts.EnvAppend, h.auth.env()...)
+	return h.RunWithOptions(opts, "git", append(h.auth.args(), args...)...)
 }
 
 func cloneConfigToArgs(opts CloneConfig) []string {
@@ -53,6 +79,32 @@ func cloneConfigToArgs(opts CloneConfig) []string {
 	if opts.Recursive {
 		result = append(result, "--recursive")
 	}
+	if opts.Depth > 0 {
+		result = append(result, "--depth", strconv.Itoa(opts.Depth))
+		if !opts.SingleBranch {
+			// --depth implies --single-branch
+			result = append(result, "--no-single-branch")
+		}
+	}
+	if len(opts.Branch) > 0 {
+		result = append(result, "--branch", opts.Branch)
+	}
+	if opts.SingleBranch {
+		result = append(result, "--single-branch")
+	}
+	if len(opts.Filter) > 0 {
+		result = append(result, "--filter="+opts.Filter)
+	}
+	if opts.Sparse {
+		result = append(result, "--sparse")
+	}
+	if opts.Mirror {
+		result = append(result, "--mirror")
+	}
+	if len(opts.Reference) > 0 {
+		// The clone does not depend on the reference once cloned.
+		result = append(result, "--reference-if-able", opts.Reference, "--dissociate")
+	}
 	return result
 }
 
@@ -162,8 +214,9 @@ func HasGitBinary() bool {
 	return err == nil
 }
 
-// Clone clones a git repository to a specific target directory.
-func (h *stiGit) Clone(src *URL, target string, c CloneConfig) error {
+// Clone clones a git repository to a specific target directory. The git
+// process is killed when ctx is done.
+func (h *stiGit) Clone(ctx context.Context, src *URL, target string, c CloneConfig) error {
 	var err error
 
 	source := *src
@@ -185,12 +238,14 @@ func (h *stiGit) Clone(src *URL, target string, c CloneConfig) error {
 	cloneArgs := append([]string{"clone"}, cloneConfigToArgs(c)...)
 	cloneArgs = append(cloneArgs, []string{source.StringNoFragment(), target}...)
 	opts := cmd.CommandOpts{
-		Stderr: os.Stderr,
-		Stdout: os.Stdout,
+		Stderr:    os.Stderr,
+		Stdout:    os.Stdout,
+		Context:   ctx,
+		EnvAppend: lfsSkipSmudge,
 	}
-	err = h.RunWithOptions(opts, "git", cloneArgs...)
+	err = h.run(opts, cloneArgs...)
 	if err != nil {
-		glog.Errorf("Clone failed: source %s, target %s, with output %q", source, target, err)
+		glog.Errorf("Clone failed: source %s, target %s, with output %q", source.StringNoCredentials(), target, err)
 		return err
 	}
 	return nil
@@ -198,15 +253,81 @@ func (h *stiGit) Clone(src *URL, target string, c CloneConfig) error {
 
 // Checkout checks out a specific branch reference of a given git repository
 func (h *stiGit) Checkout(repo, ref string) error {
+	opts := cmd.CommandOpts{
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		Dir:       repo,
+		EnvAppend: lfsSkipSmudge,
+	}
+	if log.V(4) {
+		return h.run(opts, "checkout", ref)
+	}
+	return h.run(opts, "checkout", ref)
+}
+
+// Fetch fetches the refspecs of opts from the origin of a cloned repository,
+// or from the remote of opts.
+// The git process is killed when ctx is done.
+func (h *stiGit) Fetch(ctx context.Context, repo string, c FetchConfig) error {
+	fetchArgs := []string{"fetch"}
+	if c.Unshallow {
+		fetchArgs = append(fetchArgs, "--unshallow")
+	} else if c.Depth > 0 {
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(c.Depth))
+	}
+	if c.Prune {
+		fetchArgs = append(fetchArgs, "--prune")
+	}
+	remote := c.Remote
+	if len(remote) == 0 {
+		remote = "origin"
+	}
+	fetchArgs = append(append(fetchArgs, remote), c.Refspecs...)
+	opts := cmd.CommandOpts{
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		Dir:       repo,
+		Context:   ctx,
+		EnvAppend: lfsSkipSmudge,
+	}
+	return h.run(opts, fetchArgs...)
+}
+
+// Merge merges ref into the checked out commit of a repository, always
+// creating a merge commit.
+func (h *stiGit) Merge(repo, ref, message string) error {
+	opts := cmd.CommandOpts{
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		Dir:       repo,
+		EnvAppend: lfsSkipSmudge,
+	}
+	// The merge commit is created whether or not the identity of the user
+	// is configured.
+	return h.run(opts, "-c", "user.name=s2i", "-c", "user.email=s2i@localhost", "merge", "--no-ff", "--no-edit", "-m", message, ref)
+}
+
+// SetRemoteURL sets the URL of the origin of a repository.
+func (h *stiGit) SetRemoteURL(repo, url string) error {
 	opts := cmd.CommandOpts{
 		Stdout: os.Stdout,
 		Stderr: os.Stderr,
 		Dir:    repo,
 	}
-	if log.V(4) {
-		return h.RunWithOptions(opts, "git", "checkout", ref)
+	return h.run(opts, "remote", "set-url", "origin", url)
+}
+
+// SparseCheckout restricts the checkout of a repository cloned with
+// CloneConfig.Sparse to the files of the root directory and of the given
+// directories.
+func (h *stiGit) SparseCheckout(repo string, paths ...string) error {
+	opts := cmd.CommandOpts{
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		Dir:       repo,
+		EnvAppend: lfsSkipSmudge,
 	}
-	return h.RunWithOptions(opts, "git", "checkout", ref)
+	return h.run(opts, append([]string{"sparse-checkout", "set", "--"}, paths...)...)
 }
 
 // SubmoduleInit initializes/clones submodules
@@ -216,12 +337,12 @@ func (h *stiGit) SubmoduleInit(repo string) error {
 		Stderr: os.Stderr,
 		Dir:    repo,
 	}
-	return h.RunWithOptions(opts, "git", "submodule", "init")
+	return h.run(opts, "submodule", "init")
 }
 
 // SubmoduleUpdate checks out submodules to their correct version.
 // Optionally also inits submodules, optionally operates recursively.
-func (h *stiGit) SubmoduleUpdate(repo string, init, recursive bool) error {
+func (h *stiGit) SubmoduleUpdate(ctx context.Context, repo string, init, recursive bool) error {
 	updateArgs := []string{"submodule", "update"}
 	if init {
 		updateArgs = append(updateArgs, "--init")
@@ -231,11 +352,30 @@ func (h *stiGit) SubmoduleUpdate(repo string, init, recursive bool) error {
 	}
 
 	opts := cmd.CommandOpts{
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
-		Dir:    repo,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		Dir:       repo,
+		Context:   ctx,
+		EnvAppend: lfsSkipSmudge,
+	}
+	return h.run(opts, updateArgs...)
+}
+
+// LFSPull fetches the Git LFS objects of the checked out commit and replaces
+// their pointer files with their content, for the paths matching the include
+// patterns only when given.
+func (h *stiGit) LFSPull(ctx context.Context, repo string, include ...string) error {
+	pullArgs := []string{"lfs", "pull"}
+	if len(include) > 0 {
+		pullArgs = append(pullArgs, "--include="+strings.Join(include, ","))
+	}
+	opts := cmd.CommandOpts{
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		Dir:     repo,
+		Context: ctx,
 	}
-	return h.RunWithOptions(opts, "git", updateArgs...)
+	return h.run(opts, pullArgs...)
 }
 
 // LsTree returns a slice of os.FileInfo objects populated with the paths and
@@ -308,9 +448,10 @@ func (h *stiGit) GetInfo(repo string) *SourceInfo {
 		return strings.TrimSpace(string(out))
 	}
 	return &SourceInfo{
-		Location:       git("config", "--get", "remote.origin.url"),
+		Location:       RedactURL(git("config", "--get", "remote.origin.url")),
 		Ref:            git("rev-parse", "--abbrev-ref", "HEAD"),
 		CommitID:       git("rev-parse", "--verify", "HEAD"),
+		ParentIDs:      strings.Fields(git("--no-pager", "show", "-s", "--format=%P", "HEAD")),
 		AuthorName:     git("--no-pager", "show", "-s", "--format=%an", "HEAD"),
 		AuthorEmail:    git("--no-pager", "show", "-s", "--format=%ae", "HEAD"),
 		CommitterName:  git("--no-pager", "show", "-s", "--format=%cn", "HEAD"),
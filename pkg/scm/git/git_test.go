@@ -1,14 +1,18 @@
 package git
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	testcmd "github.com/kubesphere/s2irun/pkg/test/cmd"
 	testfs "github.com/kubesphere/s2irun/pkg/test/fs"
+	"github.com/kubesphere/s2irun/pkg/utils/cmd"
 	"github.com/kubesphere/s2irun/pkg/utils/fs"
 )
 
@@ -81,7 +85,7 @@ func getGit() (Git, *testcmd.FakeCmdRunner) {
 
 func TestGitClone(t *testing.T) {
 	gh, ch := getGit()
-	err := gh.Clone(MustParse("source1"), "target1", CloneConfig{Quiet: true, Recursive: true})
+	err := gh.Clone(context.Background(), MustParse("source1"), "target1", CloneConfig{Quiet: true, Recursive: true})
 	if err != nil {
 		t.Errorf("Unexpected error returned from clone: %v", err)
 	}
@@ -93,11 +97,77 @@ func TestGitClone(t *testing.T) {
 	}
 }
 
+func TestGitCloneShallow(t *testing.T) {
+	gh, ch := getGit()
+	err := gh.Clone(context.Background(), MustParse("source1"), "target1", CloneConfig{Quiet: true, Depth: 1, Branch: "v1", SingleBranch: true, Filter: "blob:none", Sparse: true})
+	if err != nil {
+		t.Errorf("Unexpected error returned from clone: %v", err)
+	}
+	if !reflect.DeepEqual(ch.Args, []string{"clone", "--quiet", "--depth", "1", "--branch", "v1", "--single-branch", "--filter=blob:none", "--sparse", "source1", "target1"}) {
+		t.Errorf("Unexpected command arguments: %#v", ch.Args)
+	}
+
+	err = gh.Fetch(context.Background(), "repo1", FetchConfig{Refspecs: []string{"1bf4f04"}, Depth: 1})
+	if err != nil {
+		t.Errorf("Unexpected error returned from fetch: %v", err)
+	}
+	if !reflect.DeepEqual(ch.Args, []string{"fetch", "--depth", "1", "origin", "1bf4f04"}) || ch.Opts.Dir != "repo1" {
+		t.Errorf("Unexpected command arguments: %#v in %q", ch.Args, ch.Opts.Dir)
+	}
+	if !reflect.DeepEqual(ch.Opts.EnvAppend, []string{"GIT_LFS_SKIP_SMUDGE=1"}) {
+		t.Errorf("Unexpected command environment: %#v", ch.Opts.EnvAppend)
+	}
+}
+
+func TestGitCloneAuth(t *testing.T) {
+	cr := &testcmd.FakeCmdRunner{}
+	gh := NewWithAuth(&testfs.FakeFileSystem{}, cr, Auth{Username: "user", Password: "secret", SSHKeyPath: "/keys/id rsa", KnownHostsPath: "/keys/known_hosts"})
+	err := gh.Clone(context.Background(), MustParse("source1"), "target1", CloneConfig{Quiet: true})
+	if err != nil {
+		t.Errorf("Unexpected error returned from clone: %v", err)
+	}
+	if !reflect.DeepEqual(firstArgs(cr.Args, 4), []string{"-c", "credential.helper=", "-c", "credential.helper=" + credentialHelper}) || strings.Contains(strings.Join(cr.Args, " "), "secret") {
+		t.Errorf("Unexpected command arguments: %#v", cr.Args)
+	}
+	expected := []string{
+		"GIT_LFS_SKIP_SMUDGE=1",
+		"S2I_GIT_USERNAME=user",
+		"S2I_GIT_PASSWORD=secret",
+		"GIT_TERMINAL_PROMPT=0",
+		`GIT_SSH_COMMAND=ssh -i '/keys/id rsa' -o IdentitiesOnly=yes -o UserKnownHostsFile='/keys/known_hosts' -o StrictHostKeyChecking=yes`,
+	}
+	if !reflect.DeepEqual(cr.Opts.EnvAppend, expected) {
+		t.Errorf("Unexpected command environment: %#v", cr.Opts.EnvAppend)
+	}
+
+	if !HasGitBinary() {
+		return
+	}
+	// git gets the credentials from the helper
+	var out bytes.Buffer
+	runner := cmd.NewCommandRunner()
+	opts := cmd.CommandOpts{Stdin: strings.NewReader("protocol=https\nhost=example.com\n\n"), Stdout: &out, EnvAppend: cr.Opts.EnvAppend}
+	if err = runner.RunWithOptions(opts, "git", append(firstArgs(cr.Args, 4), "credential", "fill")...); err != nil {
+		t.Fatalf("Unexpected error filling the credentials: %v", err)
+	}
+	if !strings.Contains(out.String(), "username=user\npassword=secret\n") {
+		t.Errorf("Unexpected credentials %q", out.String())
+	}
+}
+
+// firstArgs returns the first n elements of args.
+func firstArgs(args []string, n int) []string {
+	if len(args) < n {
+		return args
+	}
+	return args[:n]
+}
+
 func TestGitCloneError(t *testing.T) {
 	gh, ch := getGit()
 	runErr := fmt.Errorf("Run Error")
 	ch.Err = runErr
-	err := gh.Clone(MustParse("source1"), "target1", CloneConfig{})
+	err := gh.Clone(context.Background(), MustParse("source1"), "target1", CloneConfig{})
 	if err != runErr {
 		t.Errorf("Unexpected error returned from clone: %v", err)
 	}
@@ -118,6 +188,9 @@ func TestGitCheckout(t *testing.T) {
 	if ch.Opts.Dir != "repo1" {
 		t.Errorf("Unexpected value in exec directory: %q", ch.Opts.Dir)
 	}
+	if !reflect.DeepEqual(ch.Opts.EnvAppend, []string{"GIT_LFS_SKIP_SMUDGE=1"}) {
+		t.Errorf("Unexpected command environment: %#v", ch.Opts.EnvAppend)
+	}
 }
 
 func TestGitCheckoutError(t *testing.T) {
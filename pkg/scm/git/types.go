@@ -5,6 +5,48 @@ package git
 type CloneConfig struct {
 	Recursive bool
 	Quiet     bool
+	// Depth truncates the history to this number of commits, the whole
+	// history is cloned when it is 0.
+	Depth int
+	// Branch is the branch or tag checked out instead of the remote HEAD.
+	Branch string
+	// SingleBranch clones the history of Branch only, or of the remote HEAD.
+	SingleBranch bool
+	// Filter is the partial clone filter, such as "blob:none" to fetch the
+	// content of the files when they are checked out.
+	Filter string
+	// Sparse checks out the files of the root directory only, until other
+	// directories are added with SparseCheckout.
+	Sparse bool
+	// Mirror makes a bare mirror of the repository, holding all its refs.
+	Mirror bool
+	// Reference is a repository, such as a mirror, the objects are copied
+	// from rather than fetched when it holds them.
+	Reference string
+}
+
+// FetchConfig specifies the options used when fetching into a cloned
+// repository.
+type FetchConfig struct {
+	// Refspecs are fetched from origin, its configured refspecs when empty.
+	Refspecs []string
+	// Depth truncates the fetched history to this number of commits.
+	Depth int
+	// Unshallow fetches the whole history of a shallow clone.
+	Unshallow bool
+	// Remote is the URL fetched from instead of origin.
+	Remote string
+	// Prune removes the refs which no longer exist on the remote.
+	Prune bool
+}
+
+// CacheInfo records the use of the mirror of a source in a cache.
+type CacheInfo struct {
+	// Mirror is the bare mirror of the source in the cache.
+	Mirror string `json:"mirror"`
+	// Hit is true when the mirror was in the cache and updated, false when it
+	// was created.
+	Hit bool `json:"hit"`
 }
 
 // SourceInfo stores information about the source code
@@ -35,6 +77,16 @@ type SourceInfo struct {
 	// CommitterEmail contains the e-mail of the committer
 	CommitterEmail string
 
+	// ParentIDs contains the parents of CommitID, the commit of the merged
+	// branch and the merged commit for a merge commit.
+	// The output image will contain the parents of a merge commit as
+	// 'io.openshift.build.commit.parents' label.
+	ParentIDs []string
+
+	// Refspec contains the ref fetched to build, such as refs/pull/42/head.
+	// The output image will contain this information as 'io.openshift.build.commit.refspec' label.
+	Refspec string
+
 	// Message represents the first 80 characters from the commit message.
 	// The output image will contain this information as 'io.openshift.build.commit.message' label.
 	Message string
@@ -49,6 +101,9 @@ type SourceInfo struct {
 	// label.
 	ContextDir string
 
+	// Cache records the use of the mirror the source was cloned with, if any.
+	Cache *CacheInfo
+
 	// Binary file name.
 	BinaryName string
 	// Binary file size.
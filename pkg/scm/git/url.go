@@ -185,6 +185,28 @@ func (u URL) StringNoFragment() string {
 	return u.String()
 }
 
+// StringNoCredentials returns a string representation of the URL without the
+// credentials embedded in it: the password, and the user of the HTTP URLs,
+// which can be a token. The user of the SSH URLs, such as git, is kept.
+func (u URL) StringNoCredentials() string {
+	if user := u.URL.User; user != nil {
+		if _, hasPassword := user.Password(); hasPassword || strings.HasPrefix(strings.ToLower(u.URL.Scheme), "http") {
+			u.URL.User = nil
+		}
+	}
+	return u.String()
+}
+
+// RedactURL returns the Git URL rawurl without the credentials embedded in
+// it, or rawurl when it cannot be parsed.
+func RedactURL(rawurl string) string {
+	u, err := Parse(rawurl, false)
+	if err != nil {
+		return rawurl
+	}
+	return u.StringNoCredentials()
+}
+
 // IsLocal returns true if the Git URL refers to a local repository
 func (u URL) IsLocal() bool {
 	return u.Type == URLTypeLocal || (u.Type == URLTypeURL && u.URL.Scheme == "file" && u.URL.Opaque == "")
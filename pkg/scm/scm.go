@@ -1,6 +1,7 @@
 package scm
 
 import (
+	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/build"
 	"github.com/kubesphere/s2irun/pkg/errors"
 	"github.com/kubesphere/s2irun/pkg/scm/downloaders/binary"
@@ -16,13 +17,13 @@ import (
 var glog = utilglog.StderrLog
 
 // DownloaderForSource determines what SCM plugin should be used for downloading
-// the sources from the repository.
-func DownloaderForSource(fs fs.FileSystem, s *git.URL, forceCopy bool) (build.Downloader, error) {
-	glog.V(9).Infof("DownloadForSource %s", s)
-
+// the sources from the repository, cloned with auth.
+func DownloaderForSource(fs fs.FileSystem, s *git.URL, forceCopy bool, auth api.GitAuthConfig) (build.Downloader, error) {
 	if s == nil {
+		glog.V(9).Infof("DownloadForSource <nil>")
 		return &empty.Noop{}, nil
 	}
+	glog.V(9).Infof("DownloadForSource %s", s.StringNoCredentials())
 	if s.Type == git.URLTypeBinary {
 		return &binary.File{FileSystem: fs}, nil
 	}
@@ -52,5 +53,23 @@ func DownloaderForSource(fs fs.FileSystem, s *git.URL, forceCopy bool) (build.Do
 		}
 	}
 
-	return &gitdownloader.Clone{Git: git.New(fs, cmd.NewCommandRunner()), FileSystem: fs}, nil
+	return &gitdownloader.Clone{Git: git.NewWithAuth(fs, cmd.NewCommandRunner(), gitAuth(auth)), FileSystem: fs}, nil
+}
+
+// gitAuth returns the authentication of the git commands for auth. A token is
+// the password of the user "oauth2" unless a username is given.
+func gitAuth(auth api.GitAuthConfig) git.Auth {
+	username, password := auth.Username, auth.Password
+	if len(auth.Token) > 0 {
+		password = auth.Token
+		if len(username) == 0 {
+			username = "oauth2"
+		}
+	}
+	return git.Auth{
+		Username:       username,
+		Password:       password,
+		SSHKeyPath:     auth.SSHKeyPath,
+		KnownHostsPath: auth.KnownHostsPath,
+	}
 }
@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/scm/git"
 	"github.com/kubesphere/s2irun/pkg/utils/fs"
 )
@@ -36,7 +37,7 @@ func TestDownloaderForSource(t *testing.T) {
 	}
 
 	for s, expected := range tc {
-		r, err := DownloaderForSource(fs.NewFileSystem(), s, false)
+		r, err := DownloaderForSource(fs.NewFileSystem(), s, false, api.GitAuthConfig{})
 		if err != nil {
 			t.Errorf("Unexpected error %q for %q, expected %q", err, s, expected)
 			continue
@@ -56,7 +57,7 @@ func TestDownloaderForSourceOnRelativeGit(t *testing.T) {
 	}
 	defer os.RemoveAll(gitLocalDir)
 	os.Chdir(gitLocalDir)
-	r, err := DownloaderForSource(fs.NewFileSystem(), git.MustParse("."), false)
+	r, err := DownloaderForSource(fs.NewFileSystem(), git.MustParse("."), false, api.GitAuthConfig{})
 	if err != nil {
 		t.Errorf("Unexpected error %q for %q, expected %q", err, ".", "git.Clone")
 	}
@@ -72,7 +73,7 @@ func TestDownloaderForceCopy(t *testing.T) {
 	}
 	defer os.RemoveAll(gitLocalDir)
 	os.Chdir(gitLocalDir)
-	r, err := DownloaderForSource(fs.NewFileSystem(), git.MustParse("."), true)
+	r, err := DownloaderForSource(fs.NewFileSystem(), git.MustParse("."), true, api.GitAuthConfig{})
 	if err != nil {
 		t.Errorf("Unexpected error %q for %q, expected %q", err, ".", "*file.File")
 	}
@@ -1,6 +1,7 @@
 package scripts
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/url"
@@ -18,12 +19,12 @@ var glog = utilglog.StderrLog
 
 // Downloader downloads the specified URL to the target file location
 type Downloader interface {
-	Download(url *url.URL, target string) (*git.SourceInfo, error)
+	Download(ctx context.Context, url *url.URL, target string) (*git.SourceInfo, error)
 }
 
 // schemeReader creates an io.Reader from the given url.
 type schemeReader interface {
-	Read(*url.URL) (io.ReadCloser, error)
+	Read(context.Context, *url.URL) (io.ReadCloser, error)
 }
 
 type downloader struct {
@@ -46,7 +47,7 @@ func NewDownloader(proxyConfig *api.ProxyConfig) Downloader {
 // Download downloads the file pointed to by URL into local targetFile
 // Returns information a boolean flag informing whether any download/copy operation
 // happened and an error if there was a problem during that operation
-func (d *downloader) Download(url *url.URL, targetFile string) (*git.SourceInfo, error) {
+func (d *downloader) Download(ctx context.Context, url *url.URL, targetFile string) (*git.SourceInfo, error) {
 	r := d.schemeReaders[url.Scheme]
 	info := &git.SourceInfo{}
 	if r == nil {
@@ -54,7 +55,7 @@ func (d *downloader) Download(url *url.URL, targetFile string) (*git.SourceInfo,
 		return nil, s2ierr.NewURLHandlerError(url.String())
 	}
 
-	reader, err := r.Read(url)
+	reader, err := r.Read(ctx, url)
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +82,7 @@ func (d *downloader) Download(url *url.URL, targetFile string) (*git.SourceInfo,
 
 // HTTPURLReader retrieves a response from a given HTTP(S) URL.
 type HTTPURLReader struct {
-	Get func(url string) (*http.Response, error)
+	Get func(ctx context.Context, url string) (*http.Response, error)
 }
 
 var transportMap map[api.ProxyConfig]*http.Transport
@@ -93,7 +94,7 @@ func init() {
 
 // NewHTTPURLReader returns a new HTTPURLReader.
 func NewHTTPURLReader(proxyConfig *api.ProxyConfig) *HTTPURLReader {
-	getFunc := http.Get
+	client := http.DefaultClient
 	if proxyConfig != nil {
 		transportMapMutex.Lock()
 		transport, ok := transportMap[*proxyConfig]
@@ -109,17 +110,23 @@ func NewHTTPURLReader(proxyConfig *api.ProxyConfig) *HTTPURLReader {
 			transportMap[*proxyConfig] = transport
 		}
 		transportMapMutex.Unlock()
-		client := &http.Client{
+		client = &http.Client{
 			Transport: transport,
 		}
-		getFunc = client.Get
+	}
+	getFunc := func(ctx context.Context, url string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		return client.Do(req)
 	}
 	return &HTTPURLReader{Get: getFunc}
 }
 
 // Read produces an io.Reader from an http(s) URL.
-func (h *HTTPURLReader) Read(url *url.URL) (io.ReadCloser, error) {
-	resp, err := h.Get(url.String())
+func (h *HTTPURLReader) Read(ctx context.Context, url *url.URL) (io.ReadCloser, error) {
+	resp, err := h.Get(ctx, url.String())
 	if err != nil {
 		if resp != nil {
 			defer resp.Body.Close()
@@ -136,7 +143,7 @@ func (h *HTTPURLReader) Read(url *url.URL) (io.ReadCloser, error) {
 type FileURLReader struct{}
 
 // Read produces an io.Reader from a file URL
-func (*FileURLReader) Read(url *url.URL) (io.ReadCloser, error) {
+func (*FileURLReader) Read(ctx context.Context, url *url.URL) (io.ReadCloser, error) {
 	// for some reason url.Host may contain information about the ./ or ../ when
 	// specifying relative path, thus using that value as well
 	return os.Open(filepath.Join(url.Host, url.Path))
@@ -146,6 +153,6 @@ func (*FileURLReader) Read(url *url.URL) (io.ReadCloser, error) {
 type ImageReader struct{}
 
 // Read throws Not implemented error
-func (*ImageReader) Read(url *url.URL) (io.ReadCloser, error) {
+func (*ImageReader) Read(ctx context.Context, url *url.URL) (io.ReadCloser, error) {
 	return nil, s2ierr.NewScriptsInsideImageError(url.String())
 }
@@ -1,6 +1,7 @@
 package scripts
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -21,7 +22,7 @@ type FakeHTTPGet struct {
 	statusCode int
 }
 
-func (f *FakeHTTPGet) get(url string) (*http.Response, error) {
+func (f *FakeHTTPGet) get(ctx context.Context, url string) (*http.Response, error) {
 	f.url = url
 	f.body = ioutil.NopCloser(strings.NewReader(f.content))
 	return &http.Response{
@@ -40,7 +41,7 @@ func getHTTPReader() (*HTTPURLReader, *FakeHTTPGet) {
 func TestHTTPRead(t *testing.T) {
 	u, _ := url.Parse("http://test.url/test")
 	sr, fg := getHTTPReader()
-	rc, err := sr.Read(u)
+	rc, err := sr.Read(context.Background(), u)
 	if rc != fg.body {
 		t.Errorf("Unexpected readcloser returned: %#v", rc)
 	}
@@ -53,7 +54,7 @@ func TestHTTPReadGetError(t *testing.T) {
 	u, _ := url.Parse("http://test.url/test")
 	sr, fg := getHTTPReader()
 	fg.err = fmt.Errorf("URL Error")
-	rc, err := sr.Read(u)
+	rc, err := sr.Read(context.Background(), u)
 	if rc != nil {
 		t.Errorf("Unexpected stream returned: %#v", rc)
 	}
@@ -66,7 +67,7 @@ func TestHTTPReadErrorCode(t *testing.T) {
 	u, _ := url.Parse("http://test.url/test")
 	sr, fg := getHTTPReader()
 	fg.statusCode = 500
-	rc, err := sr.Read(u)
+	rc, err := sr.Read(context.Background(), u)
 	if rc != nil {
 		t.Errorf("Unexpected stream returned: %#v", rc)
 	}
@@ -80,7 +81,7 @@ type FakeSchemeReader struct {
 	err     error
 }
 
-func (f *FakeSchemeReader) Read(url *url.URL) (io.ReadCloser, error) {
+func (f *FakeSchemeReader) Read(ctx context.Context, url *url.URL) (io.ReadCloser, error) {
 	return ioutil.NopCloser(strings.NewReader(f.content)), f.err
 }
 
@@ -105,7 +106,7 @@ func TestDownload(t *testing.T) {
 	defer os.Remove(temp.Name())
 	u, _ := url.Parse("http://www.test.url/a/file")
 	temp.Close()
-	info, err := dl.Download(u, temp.Name())
+	info, err := dl.Download(context.Background(), u, temp.Name())
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -125,7 +126,7 @@ func TestNoDownload(t *testing.T) {
 		},
 	}
 	u, _ := url.Parse("image:///tmp/testfile")
-	_, err := dl.Download(u, "")
+	_, err := dl.Download(context.Background(), u, "")
 	if err == nil {
 		t.Error("Expected error with information about scripts inside the image!")
 	}
@@ -139,7 +140,7 @@ func TestNoDownloader(t *testing.T) {
 		schemeReaders: map[string]schemeReader{},
 	}
 	u, _ := url.Parse("http://www.test.url/a/file")
-	_, err := dl.Download(u, "")
+	_, err := dl.Download(context.Background(), u, "")
 	if err == nil {
 		t.Errorf("Expected error, got nil!")
 	}
@@ -1,6 +1,7 @@
 package scripts
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"path/filepath"
@@ -16,14 +17,14 @@ import (
 // Installer interface is responsible for installing scripts needed to run the
 // build.
 type Installer interface {
-	InstallRequired(scripts []string, dstDir string) ([]api.InstallResult, error)
-	InstallOptional(scripts []string, dstDir string) []api.InstallResult
+	InstallRequired(ctx context.Context, scripts []string, dstDir string) ([]api.InstallResult, error)
+	InstallOptional(ctx context.Context, scripts []string, dstDir string) []api.InstallResult
 }
 
 // ScriptHandler provides an interface for various scripts source handlers.
 type ScriptHandler interface {
 	Get(script string) *api.InstallResult
-	Install(*api.InstallResult) error
+	Install(context.Context, *api.InstallResult) error
 	SetDestinationDir(string)
 	String() string
 }
@@ -86,13 +87,13 @@ func (s *URLScriptHandler) Get(script string) *api.InstallResult {
 }
 
 // Install downloads the script and fix its permissions.
-func (s *URLScriptHandler) Install(r *api.InstallResult) error {
+func (s *URLScriptHandler) Install(ctx context.Context, r *api.InstallResult) error {
 	downloadURL, err := url.Parse(r.URL)
 	if err != nil {
 		return err
 	}
 	dst := filepath.Join(s.DestinationDir, constants.UploadScripts, r.Script)
-	if _, err := s.Download.Download(downloadURL, dst); err != nil {
+	if _, err := s.Download.Download(ctx, downloadURL, dst); err != nil {
 		if e, ok := err.(s2ierr.Error); ok {
 			if e.ErrorCode == s2ierr.ScriptsInsideImageError {
 				r.Installed = true
@@ -139,7 +140,7 @@ func (s *SourceScriptHandler) String() string {
 }
 
 // Install copies the script into upload directory and fix its permissions.
-func (s *SourceScriptHandler) Install(r *api.InstallResult) error {
+func (s *SourceScriptHandler) Install(ctx context.Context, r *api.InstallResult) error {
 	dst := filepath.Join(s.DestinationDir, constants.UploadScripts, r.Script)
 	if err := s.fs.Rename(r.URL, dst); err != nil {
 		return err
@@ -191,7 +192,7 @@ func (m *DefaultScriptSourceManager) Add(s ScriptHandler) {
 }
 
 // NewInstaller returns a new instance of the default Installer implementation
-func NewInstaller(image string, scriptsURL string, proxyConfig *api.ProxyConfig, docker docker.Docker, auth api.AuthConfig, fs fs.FileSystem) Installer {
+func NewInstaller(ctx context.Context, image string, scriptsURL string, proxyConfig *api.ProxyConfig, docker docker.Docker, auth api.AuthConfig, fs fs.FileSystem) Installer {
 	m := DefaultScriptSourceManager{
 		Image:      image,
 		ScriptsURL: scriptsURL,
@@ -211,7 +212,7 @@ func NewInstaller(image string, scriptsURL string, proxyConfig *api.ProxyConfig,
 	if m.docker != nil {
 		// If the detection handlers above fail, try to get the script url from the
 		// docker image itself.
-		defaultURL, err := m.docker.GetScriptsURL(m.Image)
+		defaultURL, err := m.docker.GetScriptsURL(ctx, m.Image)
 		if err == nil && defaultURL != "" {
 			m.Add(&URLScriptHandler{URL: defaultURL, Download: m.download, FS: m.fs, Name: ImageURLHandler})
 		}
@@ -222,8 +223,8 @@ func NewInstaller(image string, scriptsURL string, proxyConfig *api.ProxyConfig,
 // InstallRequired Downloads and installs required scripts into dstDir, the result is a
 // map of scripts with detailed information about each of the scripts install process
 // with error if installing some of them failed
-func (m *DefaultScriptSourceManager) InstallRequired(scripts []string, dstDir string) ([]api.InstallResult, error) {
-	result := m.InstallOptional(scripts, dstDir)
+func (m *DefaultScriptSourceManager) InstallRequired(ctx context.Context, scripts []string, dstDir string) ([]api.InstallResult, error) {
+	result := m.InstallOptional(ctx, scripts, dstDir)
 	failedScripts := []string{}
 	var err error
 	for _, r := range result {
@@ -239,7 +240,7 @@ func (m *DefaultScriptSourceManager) InstallRequired(scripts []string, dstDir st
 
 // InstallOptional downloads and installs a set of scripts into dstDir, the result is a
 // map of scripts with detailed information about each of the scripts install process
-func (m *DefaultScriptSourceManager) InstallOptional(scripts []string, dstDir string) []api.InstallResult {
+func (m *DefaultScriptSourceManager) InstallOptional(ctx context.Context, scripts []string, dstDir string) []api.InstallResult {
 	result := []api.InstallResult{}
 	for _, script := range scripts {
 		installed := false
@@ -249,7 +250,7 @@ func (m *DefaultScriptSourceManager) InstallOptional(scripts []string, dstDir st
 			h := e.(ScriptHandler)
 			h.SetDestinationDir(dstDir)
 			if r := h.Get(script); r != nil {
-				if err := h.Install(r); err != nil {
+				if err := h.Install(ctx, r); err != nil {
 					failedSources = append(failedSources, h.String())
 					// all this means is this source didn't have this particular script
 					glog.V(4).Infof("script %q found by the %s, but failed to install: %v", script, h, err)
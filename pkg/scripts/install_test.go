@@ -1,6 +1,7 @@
 package scripts
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"reflect"
@@ -41,7 +42,7 @@ func newFakeInstaller(config *fakeScriptManagerConfig) Installer {
 	}
 	m.Add(&URLScriptHandler{URL: m.ScriptsURL, Download: m.download, FS: m.fs, Name: ScriptURLHandler})
 	m.Add(&SourceScriptHandler{fs: m.fs})
-	defaultURL, err := m.docker.GetScriptsURL(m.Image)
+	defaultURL, err := m.docker.GetScriptsURL(context.Background(), m.Image)
 	if err == nil && defaultURL != "" {
 		m.Add(&URLScriptHandler{URL: defaultURL, Download: m.download, FS: m.fs, Name: ImageURLHandler})
 	}
@@ -70,7 +71,7 @@ func TestInstallOptionalFromURL(t *testing.T) {
 	config := newFakeConfig()
 	inst := newFakeInstaller(config)
 	scripts := []string{constants.Assemble, constants.Run}
-	results := inst.InstallOptional(scripts, "/output")
+	results := inst.InstallOptional(context.Background(), scripts, "/output")
 	for _, r := range results {
 		isValidInstallResult(r, t)
 	}
@@ -105,7 +106,7 @@ func TestInstallRequiredFromURL(t *testing.T) {
 	}
 	inst := newFakeInstaller(config)
 	scripts := []string{constants.Assemble, constants.Run}
-	_, err := inst.InstallRequired(scripts, "/output")
+	_, err := inst.InstallRequired(context.Background(), scripts, "/output")
 	if err == nil {
 		t.Errorf("expected assemble to fail install")
 	}
@@ -122,7 +123,7 @@ func TestInstallRequiredFromDocker(t *testing.T) {
 	config.docker.(*dockerpkg.FakeDocker).DefaultURLResult = defaultDockerURL
 	inst := newFakeInstaller(config)
 	scripts := []string{constants.Assemble, constants.Run}
-	results, err := inst.InstallRequired(scripts, "/output")
+	results, err := inst.InstallRequired(context.Background(), scripts, "/output")
 	if err != nil {
 		t.Errorf("unexpected error, assemble should be installed from docker image url")
 	}
@@ -159,7 +160,7 @@ func TestInstallRequiredFromSource(t *testing.T) {
 	}
 	inst := newFakeInstaller(config)
 	scripts := []string{constants.Assemble, constants.Run}
-	result, err := inst.InstallRequired(scripts, "/workdir")
+	result, err := inst.InstallRequired(context.Background(), scripts, "/workdir")
 	if err != nil {
 		t.Errorf("unexpected error, assemble should be installed from docker image url: %v", err)
 	}
@@ -214,7 +215,7 @@ func TestInstallRequiredOrder(t *testing.T) {
 	config.docker.(*dockerpkg.FakeDocker).DefaultURLResult = defaultDockerURL
 	scripts := []string{constants.Assemble, constants.Run, constants.SaveArtifacts}
 	inst := newFakeInstaller(config)
-	result, err := inst.InstallRequired(scripts, "/workdir")
+	result, err := inst.InstallRequired(context.Background(), scripts, "/workdir")
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -248,7 +249,7 @@ func TestInstallRequiredError(t *testing.T) {
 	config.url = ""
 	scripts := []string{constants.Assemble, constants.Run}
 	inst := newFakeInstaller(config)
-	result, err := inst.InstallRequired(scripts, "/output")
+	result, err := inst.InstallRequired(context.Background(), scripts, "/output")
 	if err == nil {
 		t.Errorf("expected error, got %+v", result)
 	}
@@ -259,7 +260,7 @@ func TestInstallRequiredFromInvalidURL(t *testing.T) {
 	config.url = "../invalid-url"
 	scripts := []string{constants.Assemble}
 	inst := newFakeInstaller(config)
-	result, err := inst.InstallRequired(scripts, "/output")
+	result, err := inst.InstallRequired(context.Background(), scripts, "/output")
 	if err == nil {
 		t.Errorf("expected error, got %+v", result)
 	}
@@ -267,7 +268,7 @@ func TestInstallRequiredFromInvalidURL(t *testing.T) {
 
 func TestNewInstaller(t *testing.T) {
 	docker := &dockerpkg.FakeDocker{DefaultURLResult: "image://docker"}
-	inst := NewInstaller("test-image", "http://foo.bar", nil, docker, api.AuthConfig{}, &testfs.FakeFileSystem{})
+	inst := NewInstaller(context.Background(), "test-image", "http://foo.bar", nil, docker, api.AuthConfig{}, &testfs.FakeFileSystem{})
 	sources := inst.(*DefaultScriptSourceManager).sources
 	firstHandler, ok := sources[0].(*URLScriptHandler)
 	if !ok {
@@ -294,7 +295,7 @@ func (f *fakeSource) Get(script string) *api.InstallResult {
 	return &api.InstallResult{Script: script}
 }
 
-func (f *fakeSource) Install(r *api.InstallResult) error {
+func (f *fakeSource) Install(ctx context.Context, r *api.InstallResult) error {
 	if _, fail := f.failOn[r.Script]; fail {
 		return fmt.Errorf("error")
 	}
@@ -319,7 +320,7 @@ func TestInstallOptionalFailedSources(t *testing.T) {
 		"two":   {"failing1", "failing2"},
 		"three": {"failing1", "failing2", "almostpassing"},
 	}
-	results := m.InstallOptional([]string{"one", "two", "three"}, "foo")
+	results := m.InstallOptional(context.Background(), []string{"one", "two", "three"}, "foo")
 	for _, result := range results {
 		if !reflect.DeepEqual(result.FailedSources, expect[result.Script]) {
 			t.Errorf("Did not get expected failed sources: %#v", result)
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"net/url"
 	"sync"
 
@@ -16,7 +17,7 @@ type FakeDownloader struct {
 }
 
 // Download downloads a fake file from the URL
-func (f *FakeDownloader) Download(url *url.URL, target string) (*git.SourceInfo, error) {
+func (f *FakeDownloader) Download(ctx context.Context, url *url.URL, target string) (*git.SourceInfo, error) {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
 
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"os"
 
 	"github.com/kubesphere/s2irun/pkg/scm/git"
@@ -16,6 +17,23 @@ type FakeGit struct {
 	CheckoutRef   string
 	CheckoutError error
 
+	FetchRepo   string
+	FetchConfig git.FetchConfig
+	FetchError  error
+
+	MergeRepo    string
+	MergeRef     string
+	MergeMessage string
+	MergeError   error
+
+	SetRemoteURLRepo  string
+	SetRemoteURLURL   string
+	SetRemoteURLError error
+
+	SparseCheckoutRepo  string
+	SparseCheckoutPaths []string
+	SparseCheckoutError error
+
 	SubmoduleInitRepo  string
 	SubmoduleInitError error
 
@@ -23,10 +41,14 @@ type FakeGit struct {
 	SubmoduleUpdateInit      bool
 	SubmoduleUpdateRecursive bool
 	SubmoduleUpdateError     error
+
+	LFSPullRepo    string
+	LFSPullInclude []string
+	LFSPullError   error
 }
 
 // Clone clones the fake source Git repository to target directory
-func (f *FakeGit) Clone(source *git.URL, target string, c git.CloneConfig) error {
+func (f *FakeGit) Clone(ctx context.Context, source *git.URL, target string, c git.CloneConfig) error {
 	f.CloneSource = source
 	f.CloneTarget = target
 	return f.CloneError
@@ -39,6 +61,35 @@ func (f *FakeGit) Checkout(repo, ref string) error {
 	return f.CheckoutError
 }
 
+// Fetch fetches into the fake Git repository
+func (f *FakeGit) Fetch(ctx context.Context, repo string, c git.FetchConfig) error {
+	f.FetchRepo = repo
+	f.FetchConfig = c
+	return f.FetchError
+}
+
+// Merge merges a ref in the fake Git repository
+func (f *FakeGit) Merge(repo, ref, message string) error {
+	f.MergeRepo = repo
+	f.MergeRef = ref
+	f.MergeMessage = message
+	return f.MergeError
+}
+
+// SetRemoteURL sets the URL of the origin of the fake Git repository
+func (f *FakeGit) SetRemoteURL(repo, url string) error {
+	f.SetRemoteURLRepo = repo
+	f.SetRemoteURLURL = url
+	return f.SetRemoteURLError
+}
+
+// SparseCheckout restricts the checkout of the fake Git repository
+func (f *FakeGit) SparseCheckout(repo string, paths ...string) error {
+	f.SparseCheckoutRepo = repo
+	f.SparseCheckoutPaths = paths
+	return f.SparseCheckoutError
+}
+
 // SubmoduleInit initializes / clones submodules.
 func (f *FakeGit) SubmoduleInit(repo string) error {
 	f.SubmoduleInitRepo = repo
@@ -46,7 +97,7 @@ func (f *FakeGit) SubmoduleInit(repo string) error {
 }
 
 // SubmoduleUpdate checks out submodules to their correct version
-func (f *FakeGit) SubmoduleUpdate(repo string, init, recursive bool) error {
+func (f *FakeGit) SubmoduleUpdate(ctx context.Context, repo string, init, recursive bool) error {
 	f.SubmoduleUpdateRepo = repo
 	f.SubmoduleUpdateRecursive = recursive
 	f.SubmoduleUpdateInit = init
@@ -68,3 +119,10 @@ func (f *FakeGit) GetInfo(repo string) *git.SourceInfo {
 		Location: "file:///foo",
 	}
 }
+
+// LFSPull pulls the Git LFS objects of the fake Git repository
+func (f *FakeGit) LFSPull(ctx context.Context, repo string, include ...string) error {
+	f.LFSPullRepo = repo
+	f.LFSPullInclude = include
+	return f.LFSPullError
+}
@@ -1,6 +1,8 @@
 package test
 
 import (
+	"context"
+
 	"github.com/kubesphere/s2irun/pkg/api"
 )
 
@@ -19,11 +21,11 @@ func (f *FakeInstaller) run(scripts []string, dstDir string) []api.InstallResult
 }
 
 // InstallRequired downloads and installs required scripts into dstDir
-func (f *FakeInstaller) InstallRequired(scripts []string, dstDir string) ([]api.InstallResult, error) {
+func (f *FakeInstaller) InstallRequired(ctx context.Context, scripts []string, dstDir string) ([]api.InstallResult, error) {
 	return f.run(scripts, dstDir), f.Error
 }
 
 // InstallOptional downloads and installs optional scripts into dstDir
-func (f *FakeInstaller) InstallOptional(scripts []string, dstDir string) []api.InstallResult {
+func (f *FakeInstaller) InstallOptional(ctx context.Context, scripts []string, dstDir string) []api.InstallResult {
 	return f.run(scripts, dstDir)
 }
@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServiceName is the name of the service the spans are reported for.
+const ServiceName = "s2irun"
+
+// tracesPath is the path of the OTLP/HTTP endpoint receiving the traces.
+const tracesPath = "/v1/traces"
+
+// The OTLP JSON encoding of the spans, see
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// The span kind and status codes of OTLP.
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusCodeOK     = 1
+	otlpStatusCodeError  = 2
+)
+
+// Encode returns the OTLP JSON encoding of spans.
+func Encode(spans []Span) ([]byte, error) {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: ServiceName}, Spans: []otlpSpan{}}
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: unixNano(span.StartTime),
+			EndTimeUnixNano:   unixNano(span.EndTime),
+			Attributes:        keyValues(span.Attributes),
+			Status:            otlpStatus{Code: otlpStatusCodeOK},
+		}
+		if span.Failed {
+			s.Status = otlpStatus{Code: otlpStatusCodeError, Message: span.Error}
+		}
+		scope.Spans = append(scope.Spans, s)
+	}
+	return json.Marshal(otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource:   otlpResource{Attributes: keyValues(map[string]string{"service.name": ServiceName})},
+			ScopeSpans: []otlpScopeSpans{scope},
+		}},
+	})
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// keyValues returns the attributes sorted by key.
+func keyValues(attributes map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: otlpValue{StringValue: attributes[k]}})
+	}
+	return kvs
+}
+
+// WriteFile writes the OTLP JSON encoding of spans to the file at path.
+func WriteFile(path string, spans []Span) error {
+	data, err := Encode(spans)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Export sends spans to the OTLP/HTTP endpoint of a collector, such as
+// "http://collector:4318". The /v1/traces path is added when the endpoint has
+// no path.
+func Export(ctx context.Context, endpoint string, spans []Span) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid tracing endpoint %q: %v", endpoint, err)
+	}
+	if len(strings.Trim(u.Path, "/")) == 0 {
+		u.Path = tracesPath
+	}
+	data, err := Encode(spans)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("exporting spans to %s failed: %s: %s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
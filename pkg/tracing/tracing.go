@@ -0,0 +1,163 @@
+// Package tracing turns the stages and steps recorded for a build into trace
+// spans, and exports them in the OTLP JSON encoding to an OpenTelemetry
+// collector or to a local file.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/scm/git"
+)
+
+// TraceParentEnvVariable holds a W3C traceparent header. When it is set, the
+// build span is a child of the span it identifies, for instance the span of
+// the pipeline running the build.
+const TraceParentEnvVariable = "TRACEPARENT"
+
+// The attributes set on the spans.
+const (
+	AttributeBuilderImage  = "s2i.builder_image"
+	AttributeImage         = "s2i.image"
+	AttributeTag           = "s2i.tag"
+	AttributeSourceURL     = "s2i.source_url"
+	AttributeCommitID      = "s2i.commit_id"
+	AttributeRef           = "s2i.ref"
+	AttributeStrategy      = "s2i.strategy"
+	AttributeFailureReason = "s2i.failure_reason"
+)
+
+// BuildSpanName is the name of the span covering the whole build.
+const BuildSpanName = "Build"
+
+// Span is a timed operation of the build.
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]string
+	// Error is the error message of a failed operation.
+	Error string
+	// Failed is set when the operation failed.
+	Failed bool
+}
+
+var traceParentRegexp = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// SpansFromResult returns the spans of the build which ran from start to end:
+// a span for the build, with a child span for each recorded stage, each with
+// a child span for each of its steps.
+func SpansFromResult(config *api.Config, result *api.Result, start, end time.Time) []Span {
+	build := Span{
+		TraceID:    newID(16),
+		SpanID:     newID(8),
+		Name:       BuildSpanName,
+		StartTime:  start,
+		EndTime:    end,
+		Attributes: buildAttributes(config),
+	}
+	if m := traceParentRegexp.FindStringSubmatch(os.Getenv(TraceParentEnvVariable)); m != nil {
+		build.TraceID, build.ParentSpanID = m[1], m[2]
+	}
+	if !result.Success {
+		build.Failed = true
+		build.Error = string(result.BuildInfo.FailureReason.Message)
+		if reason := result.BuildInfo.FailureReason.Reason; len(reason) > 0 {
+			build.Attributes[AttributeFailureReason] = string(reason)
+		}
+	}
+
+	spans := []Span{build}
+	for _, stage := range result.BuildInfo.Stages {
+		stageSpan := Span{
+			TraceID:      build.TraceID,
+			SpanID:       newID(8),
+			ParentSpanID: build.SpanID,
+			Name:         string(stage.Name),
+			StartTime:    stage.StartTime,
+			EndTime:      stage.StartTime.Add(time.Duration(stage.DurationMilliseconds) * time.Millisecond),
+			Attributes:   map[string]string{},
+		}
+		spans = append(spans, stageSpan)
+		for _, step := range stage.Steps {
+			spans = append(spans, Span{
+				TraceID:      build.TraceID,
+				SpanID:       newID(8),
+				ParentSpanID: stageSpan.SpanID,
+				Name:         string(step.Name),
+				StartTime:    step.StartTime,
+				EndTime:      step.StartTime.Add(time.Duration(step.DurationMilliseconds) * time.Millisecond),
+				Attributes:   stepAttributes(config, step.Name),
+			})
+		}
+	}
+	return spans
+}
+
+// buildAttributes returns the attributes of the build span.
+func buildAttributes(config *api.Config) map[string]string {
+	attributes := map[string]string{}
+	set := func(key, value string) {
+		if len(value) > 0 {
+			attributes[key] = value
+		}
+	}
+	set(AttributeBuilderImage, config.BuilderImage)
+	set(AttributeTag, config.Tag)
+	set(AttributeSourceURL, git.RedactURL(config.SourceURL))
+	if len(config.AsDockerfile) > 0 {
+		set(AttributeStrategy, "dockerfile")
+	} else if config.LayeredBuild {
+		set(AttributeStrategy, "layered")
+	}
+	if config.SourceInfo != nil {
+		set(AttributeCommitID, config.SourceInfo.CommitID)
+		set(AttributeRef, config.SourceInfo.Ref)
+	}
+	return attributes
+}
+
+// stepAttributes returns the attributes of the span of the given step, such
+// as the image it pulls or pushes.
+func stepAttributes(config *api.Config, step api.StepName) map[string]string {
+	attributes := map[string]string{}
+	var image string
+	switch step {
+	case api.StepPullBuilderImage:
+		image = config.BuilderImage
+	case api.StepPullRuntimeImage, api.StepAssembleRuntimeScripts:
+		image = config.RuntimeImage
+	case api.StepPullPreviousImage:
+		image = config.IncrementalFromTag
+		if len(image) == 0 {
+			image = config.Tag
+		}
+	case api.StepPushImage, api.StepCommitContainer:
+		image = config.Tag
+	case api.StepDownloadSource:
+		if len(config.SourceURL) > 0 {
+			attributes[AttributeSourceURL] = git.RedactURL(config.SourceURL)
+		}
+		if config.SourceInfo != nil && len(config.SourceInfo.CommitID) > 0 {
+			attributes[AttributeCommitID] = config.SourceInfo.CommitID
+		}
+	}
+	if len(image) > 0 {
+		attributes[AttributeImage] = image
+	}
+	return attributes
+}
+
+// newID returns a random identifier of n bytes, hex encoded.
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
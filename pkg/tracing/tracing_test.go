@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kubesphere/s2irun/pkg/api"
+	"github.com/kubesphere/s2irun/pkg/scm/git"
+	utilstatus "github.com/kubesphere/s2irun/pkg/utils/status"
+)
+
+func testSpans() []Span {
+	start := time.Unix(1000, 0)
+	config := &api.Config{
+		BuilderImage: "builder:latest",
+		Tag:          "docker.io/foo/app:v1",
+		SourceInfo:   &git.SourceInfo{CommitID: "0123456789abcdef"},
+	}
+	stages := api.RecordStageAndStepInfo(nil, api.StagePullImages, api.StepPullBuilderImage, start, start.Add(time.Second))
+	stages = api.RecordStageAndStepInfo(stages, api.StagePushImage, api.StepPushImage, start.Add(time.Second), start.Add(3*time.Second))
+	result := &api.Result{
+		BuildInfo: api.BuildInfo{
+			Stages: stages,
+			FailureReason: utilstatus.NewFailureReason(
+				utilstatus.ReasonPushImageFailed,
+				utilstatus.ReasonMessagePushImageFailed,
+			),
+		},
+	}
+	return SpansFromResult(config, result, start, start.Add(4*time.Second))
+}
+
+func TestSpansFromResult(t *testing.T) {
+	os.Setenv(TraceParentEnvVariable, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	defer os.Unsetenv(TraceParentEnvVariable)
+	spans := testSpans()
+
+	names := []string{}
+	for _, span := range spans {
+		names = append(names, span.Name)
+		if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%s: unexpected trace ID %s", span.Name, span.TraceID)
+		}
+	}
+	expected := []string{BuildSpanName, "PullImages", "PullBuilderImage", "PushImage", "PushImage"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("got spans %v, expected %v", names, expected)
+	}
+
+	build := spans[0]
+	if build.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("build span should be a child of the trace parent, got %q", build.ParentSpanID)
+	}
+	if !build.Failed || build.Error != string(utilstatus.ReasonMessagePushImageFailed) {
+		t.Errorf("build span should have failed, got %+v", build)
+	}
+	if build.Attributes[AttributeCommitID] != "0123456789abcdef" || build.Attributes[AttributeFailureReason] != string(utilstatus.ReasonPushImageFailed) {
+		t.Errorf("unexpected build span attributes %v", build.Attributes)
+	}
+	if spans[1].ParentSpanID != build.SpanID || spans[2].ParentSpanID != spans[1].SpanID || spans[4].ParentSpanID != spans[3].SpanID {
+		t.Errorf("unexpected span hierarchy %+v", spans)
+	}
+	if spans[2].Attributes[AttributeImage] != "builder:latest" || spans[4].Attributes[AttributeImage] != "docker.io/foo/app:v1" {
+		t.Errorf("unexpected step span attributes %v, %v", spans[2].Attributes, spans[4].Attributes)
+	}
+	if d := spans[3].EndTime.Sub(spans[3].StartTime); d != 2*time.Second {
+		t.Errorf("unexpected stage span duration %v", d)
+	}
+}
+
+func TestExport(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != tracesPath || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &received); err != nil {
+			t.Errorf("invalid body %s: %v", data, err)
+		}
+	}))
+	defer server.Close()
+
+	if err := Export(context.Background(), server.URL, testSpans()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	spans := received["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 5 {
+		t.Fatalf("expected 5 spans, got %d", len(spans))
+	}
+	build := spans[0].(map[string]interface{})
+	if build["startTimeUnixNano"] != "1000000000000" || build["endTimeUnixNano"] != "1004000000000" {
+		t.Errorf("unexpected build span times %v", build)
+	}
+	if code := build["status"].(map[string]interface{})["code"]; code != float64(otlpStatusCodeError) {
+		t.Errorf("unexpected build span status %v", build["status"])
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	if err := Export(context.Background(), failing.URL, testSpans()); err == nil {
+		t.Errorf("expected an error exporting to a failing collector")
+	}
+}
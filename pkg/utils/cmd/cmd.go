@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"io"
 	"os"
 	"os/exec"
@@ -9,10 +10,13 @@ import (
 // CommandOpts contains options to attach Stdout/err to a command to run
 // or set its initial directory
 type CommandOpts struct {
+	Stdin     io.Reader
 	Stdout    io.Writer
 	Stderr    io.Writer
 	Dir       string
 	EnvAppend []string
+	// Context, when set, kills the command once it is done.
+	Context context.Context
 }
 
 // CommandRunner executes OS commands with the given parameters and options
@@ -35,7 +39,10 @@ type runner struct {
 
 // RunWithOptions runs a command with the provided options
 func (c *runner) RunWithOptions(opts CommandOpts, name string, arg ...string) error {
-	cmd := exec.Command(name, arg...)
+	cmd := command(opts, name, arg...)
+	if opts.Stdin != nil {
+		cmd.Stdin = opts.Stdin
+	}
 	if opts.Stdout != nil {
 		cmd.Stdout = opts.Stdout
 	}
@@ -60,7 +67,7 @@ func (c *runner) Run(name string, arg ...string) error {
 // StartWithStdoutPipe executes a command returning a ReadCloser connected to
 // the command's stdout.
 func (c *runner) StartWithStdoutPipe(opts CommandOpts, name string, arg ...string) (io.ReadCloser, error) {
-	c.cmd = exec.Command(name, arg...)
+	c.cmd = command(opts, name, arg...)
 	if opts.Stderr != nil {
 		c.cmd.Stderr = opts.Stderr
 	}
@@ -82,3 +89,11 @@ func (c *runner) StartWithStdoutPipe(opts CommandOpts, name string, arg ...strin
 func (c *runner) Wait() error {
 	return c.cmd.Wait()
 }
+
+// command returns the command to run, bound to the context of opts if any.
+func command(opts CommandOpts, name string, arg ...string) *exec.Cmd {
+	if opts.Context != nil {
+		return exec.CommandContext(opts.Context, name, arg...)
+	}
+	return exec.Command(name, arg...)
+}
@@ -1,12 +1,12 @@
 package glog
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/golang/glog"
 )
@@ -23,6 +23,7 @@ type Logger interface {
 	Error(args ...interface{})
 	Fatalf(format string, args ...interface{})
 	Fatal(args ...interface{})
+	Progress(p Progress)
 }
 
 // VerboseLogger is roughly equivalent to glog's Verbose.
@@ -36,11 +37,19 @@ type VerboseLogger interface {
 func ToFile(x io.Writer, level int32) Logger {
 	return &FileLogger{
 		&sync.Mutex{},
-		bufio.NewWriter(x),
+		NewTextSink(x),
 		level,
 	}
 }
 
+// SetSink replaces the sink StderrLog writes its records to, for instance
+// with NewJSONSink(os.Stderr).
+func SetSink(sink Sink) {
+	if f, ok := StderrLog.(*FileLogger); ok {
+		f.SetSink(sink)
+	}
+}
+
 var (
 	// None implements the Logger interface but does nothing with the log output.
 	None Logger = discard{}
@@ -93,14 +102,25 @@ func (discard) Fatalf(string, ...interface{}) {
 func (discard) Fatal(...interface{}) {
 }
 
-// FileLogger logs the provided messages at level or below to the writer, or delegates
+// Progress records the progress of a transfer.
+func (discard) Progress(Progress) {
+}
+
+// FileLogger logs the provided messages at level or below to the sink, or delegates
 // to glog.
 type FileLogger struct {
 	mutex *sync.Mutex
-	w     *bufio.Writer
+	sink  Sink
 	level int32
 }
 
+// SetSink replaces the sink the records are written to.
+func (f *FileLogger) SetSink(sink Sink) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.sink = sink
+}
+
 // Is returns whether the current logging level is greater than or equal to the parameter.
 func (f *FileLogger) Is(level int32) bool {
 	return level <= f.level
@@ -130,36 +150,50 @@ const (
 type elevated func(int, ...interface{})
 
 type severityDetail struct {
-	prefix     string
+	level      string
 	delegateFn elevated
 }
 
 var severities = []severityDetail{
-	infoLog:    {"", log.InfoDepth},
-	warningLog: {"WARNING: ", log.WarningDepth},
-	errorLog:   {"ERROR: ", log.ErrorDepth},
-	fatalLog:   {"FATAL: ", log.FatalDepth},
+	infoLog:    {"info", log.InfoDepth},
+	warningLog: {"warning", log.WarningDepth},
+	errorLog:   {"error", log.ErrorDepth},
+	fatalLog:   {"fatal", log.FatalDepth},
 }
 
 func (f *FileLogger) writeln(sev severity, line string) {
+	f.write(sev, &Record{Message: line})
+}
+
+func (f *FileLogger) write(sev severity, r *Record) {
 	severity := severities[sev]
+	r.Time = time.Now()
+	r.Level = severity.level
+	r.Fields = CurrentFields()
+
+	// sinks are not threadsafe, so serialize access to the stream
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 
 	// If the loglevel has been elevated above this file logger's verbosity (generally set to 2)
-	// then delegate ALL messages to elevated logger in order to leverage its file/line/timestamp
-	// prefix information.
-	if log.V(log.Level(f.level + 1)) {
-		severity.delegateFn(3, line)
-	} else {
-		// buf.io is not threadsafe, so serialize access to the stream
-		f.mutex.Lock()
-		defer f.mutex.Unlock()
-		f.w.WriteString(severity.prefix)
-		f.w.WriteString(line)
-		if !strings.HasSuffix(line, "\n") {
-			f.w.WriteByte('\n')
-		}
-		f.w.Flush()
+	// then delegate ALL text messages to elevated logger in order to leverage its file/line/timestamp
+	// prefix information. glog prefixes the message with its severity, so the
+	// prefix of the text sink is left out.
+	if _, ok := f.sink.(*TextSink); ok && bool(log.V(log.Level(f.level+1))) {
+		severity.delegateFn(4, delegatedMessage(r))
+		return
 	}
+	f.sink.Write(r)
+}
+
+// delegatedMessage returns the message of r followed by its fields, which
+// are not part of the prefix written by glog.
+func delegatedMessage(r *Record) string {
+	fields := r.Fields.String()
+	if len(fields) == 0 {
+		return r.Message
+	}
+	return strings.TrimRight(r.Message, "\n") + " " + fields
 }
 
 func (f *FileLogger) outputf(sev severity, format string, args ...interface{}) {
@@ -211,3 +245,8 @@ func (f *FileLogger) Fatal(args ...interface{}) {
 	defer os.Exit(1)
 	f.output(fatalLog, args...)
 }
+
+// Progress records the progress of a transfer.
+func (f *FileLogger) Progress(p Progress) {
+	f.write(infoLog, &Record{Message: p.String(), Progress: &p})
+}
@@ -0,0 +1,85 @@
+package glog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kubesphere/s2irun/pkg/utils/bytefmt"
+)
+
+// DefaultProgressInterval is the minimum interval between two progress
+// records of a transfer.
+const DefaultProgressInterval = 2 * time.Second
+
+// Progress describes the progress of a transfer.
+type Progress struct {
+	// Operation is the kind of transfer, such as "download", "pull" or "push".
+	Operation string `json:"operation"`
+	// Target is what is transferred, such as a file or an image name.
+	Target string `json:"target,omitempty"`
+	// Current is the number of bytes transferred so far.
+	Current uint64 `json:"current"`
+	// Total is the number of bytes to transfer, zero when it is unknown.
+	Total uint64 `json:"total,omitempty"`
+}
+
+// String returns the human readable description of the progress.
+func (p Progress) String() string {
+	size := bytefmt.ByteSize(p.Current)
+	if p.Total > 0 {
+		size += "/" + bytefmt.ByteSize(p.Total)
+	}
+	if len(p.Target) == 0 {
+		return fmt.Sprintf("%s: %s", p.Operation, size)
+	}
+	return fmt.Sprintf("%s %s: %s", p.Operation, p.Target, size)
+}
+
+// ProgressReporter logs the progress of a transfer at most once per interval,
+// except for its completion which is always logged.
+type ProgressReporter struct {
+	logger   Logger
+	interval time.Duration
+	progress Progress
+
+	mutex  sync.Mutex
+	last   time.Time
+	logged bool
+}
+
+// NewProgressReporter returns a reporter logging the progress of the transfer
+// of target to logger.
+func NewProgressReporter(logger Logger, operation, target string) *ProgressReporter {
+	return &ProgressReporter{
+		logger:   logger,
+		interval: DefaultProgressInterval,
+		progress: Progress{Operation: operation, Target: target},
+	}
+}
+
+// Update records that current bytes out of total were transferred, total being
+// zero when unknown.
+func (r *ProgressReporter) Update(current, total uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.progress.Current, r.progress.Total = current, total
+	r.logged = false
+	now := time.Now()
+	if now.Sub(r.last) < r.interval && (total == 0 || current < total) {
+		return
+	}
+	r.last = now
+	r.logged = true
+	r.logger.Progress(r.progress)
+}
+
+// Done logs the last progress of the transfer unless it was already logged.
+func (r *ProgressReporter) Done() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.logged && r.progress.Current > 0 {
+		r.logged = true
+		r.logger.Progress(r.progress)
+	}
+}
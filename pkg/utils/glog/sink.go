@@ -0,0 +1,140 @@
+package glog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The formats of the log records.
+const (
+	// TextFormat writes the messages as they are, prefixed with their severity.
+	TextFormat = "text"
+	// JSONFormat writes every record as a JSON object on its own line.
+	JSONFormat = "json"
+)
+
+// Fields are the attributes of the build attached to every log record.
+type Fields struct {
+	// Stage is the build stage being run.
+	Stage string `json:"stage,omitempty"`
+	// ContainerID is the ID of the container being run.
+	ContainerID string `json:"containerID,omitempty"`
+	// Image is the image of the container being run.
+	Image string `json:"image,omitempty"`
+}
+
+// String returns the fields which are set, as "stage=Assemble image=builder".
+func (f Fields) String() string {
+	var parts []string
+	for _, field := range []struct{ name, value string }{
+		{"stage", f.Stage},
+		{"containerID", f.ContainerID},
+		{"image", f.Image},
+	} {
+		if len(field.value) > 0 {
+			parts = append(parts, field.name+"="+field.value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+var (
+	fieldsMutex sync.RWMutex
+	fields      Fields
+)
+
+// CurrentFields returns the fields attached to the log records.
+func CurrentFields() Fields {
+	fieldsMutex.RLock()
+	defer fieldsMutex.RUnlock()
+	return fields
+}
+
+// SetFields replaces the fields attached to the log records.
+func SetFields(f Fields) {
+	fieldsMutex.Lock()
+	defer fieldsMutex.Unlock()
+	fields = f
+}
+
+// SetStage sets the build stage attached to the log records.
+func SetStage(stage string) {
+	fieldsMutex.Lock()
+	defer fieldsMutex.Unlock()
+	fields.Stage = stage
+}
+
+// Record is a log entry.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"msg"`
+	Fields
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// Sink writes the log records. Its methods are not called concurrently.
+type Sink interface {
+	Write(r *Record)
+}
+
+// TextSink writes the messages of the records, one per line.
+type TextSink struct {
+	w *bufio.Writer
+}
+
+// NewTextSink returns a sink writing the messages of the records to w.
+func NewTextSink(w io.Writer) *TextSink {
+	return &TextSink{w: bufio.NewWriter(w)}
+}
+
+// textPrefixes are the prefixes of the messages by severity.
+var textPrefixes = map[string]string{
+	"warning": "WARNING: ",
+	"error":   "ERROR: ",
+	"fatal":   "FATAL: ",
+}
+
+func (s *TextSink) format(r *Record) string {
+	return textPrefixes[r.Level] + r.Message
+}
+
+// Write writes the message of r.
+func (s *TextSink) Write(r *Record) {
+	line := s.format(r)
+	s.w.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		s.w.WriteByte('\n')
+	}
+	s.w.Flush()
+}
+
+// JSONSink writes the records as JSON lines.
+type JSONSink struct {
+	encoder *json.Encoder
+}
+
+// NewJSONSink returns a sink writing the records to w as JSON lines.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{encoder: json.NewEncoder(w)}
+}
+
+// Write writes r as a JSON line. The trailing line breaks of the message,
+// such as those of the output of the containers, are removed.
+func (s *JSONSink) Write(r *Record) {
+	record := *r
+	record.Message = strings.TrimRight(record.Message, "\r\n")
+	s.encoder.Encode(&record)
+}
+
+// NewSink returns the sink writing to w in the given format.
+func NewSink(format string, w io.Writer) Sink {
+	if format == JSONFormat {
+		return NewJSONSink(w)
+	}
+	return NewTextSink(w)
+}
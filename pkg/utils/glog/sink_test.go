@@ -0,0 +1,115 @@
+package glog
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJSONSink(t *testing.T) {
+	defer SetFields(CurrentFields())
+	SetFields(Fields{ContainerID: "abc123", Image: "builder:latest"})
+	SetStage("Assemble")
+
+	var buf bytes.Buffer
+	logger := &FileLogger{mutex: &sync.Mutex{}, sink: NewJSONSink(&buf)}
+	logger.Warning("assembling\n")
+	logger.Progress(Progress{Operation: "push", Target: "foo/app:v1", Current: 512, Total: 1024})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %q", buf.String())
+	}
+	var record Record
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("invalid record %s: %v", lines[0], err)
+	}
+	if record.Level != "warning" || record.Message != "assembling" || record.Stage != "Assemble" || record.ContainerID != "abc123" || record.Image != "builder:latest" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if record.Time.IsZero() || record.Progress != nil {
+		t.Errorf("unexpected record %+v", record)
+	}
+	record = Record{}
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("invalid record %s: %v", lines[1], err)
+	}
+	if record.Progress == nil || record.Progress.Current != 512 || record.Progress.Total != 1024 || record.Message != "push foo/app:v1: 512B/1K" {
+		t.Errorf("unexpected progress record %+v", record)
+	}
+}
+
+func TestFileLoggerDelegation(t *testing.T) {
+	defer SetFields(CurrentFields())
+	SetFields(Fields{})
+	SetStage("Assemble")
+	v := flag.Lookup("v").Value.String()
+	defer flag.Set("v", v)
+	flag.Set("v", "3")
+	defer func(original []severityDetail) { severities = original }(severities)
+	var delegated []string
+	severities = []severityDetail{}
+	for _, level := range []string{"info", "warning", "error", "fatal"} {
+		severities = append(severities, severityDetail{level, func(depth int, args ...interface{}) {
+			delegated = append(delegated, fmt.Sprint(args...))
+		}})
+	}
+
+	var buf bytes.Buffer
+	logger := &FileLogger{mutex: &sync.Mutex{}, level: 2, sink: NewTextSink(&buf)}
+	logger.Warning("assembling\n")
+	logger.Errorf("failed")
+
+	expected := []string{"assembling stage=Assemble", "failed stage=Assemble"}
+	if !reflect.DeepEqual(delegated, expected) {
+		t.Errorf("expected the messages %q to be delegated, got %q", expected, delegated)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("expected the delegated messages not to be written, got %q", buf.String())
+	}
+}
+
+type progressLogger struct {
+	discard
+	progress []Progress
+}
+
+func (l *progressLogger) Progress(p Progress) {
+	l.progress = append(l.progress, p)
+}
+
+func TestProgressReporter(t *testing.T) {
+	logger := &progressLogger{}
+	r := NewProgressReporter(logger, "download", "source.tar")
+	r.interval = time.Hour
+
+	r.Update(10, 100)
+	r.Update(20, 100)
+	r.Update(30, 100)
+	if len(logger.progress) != 1 || logger.progress[0].Current != 10 {
+		t.Fatalf("expected only the first update to be logged, got %v", logger.progress)
+	}
+	r.Update(100, 100)
+	if len(logger.progress) != 2 || logger.progress[1].Current != 100 {
+		t.Fatalf("expected the completion to be logged, got %v", logger.progress)
+	}
+	r.Done()
+	if len(logger.progress) != 2 {
+		t.Errorf("expected the logged completion not to be logged again, got %v", logger.progress)
+	}
+
+	r = NewProgressReporter(logger, "pull", "builder:latest")
+	r.interval = time.Hour
+	r.Update(10, 0)
+	r.Update(50, 0)
+	r.Done()
+	if len(logger.progress) != 4 || logger.progress[3].Current != 50 {
+		t.Errorf("expected the last update to be logged when done, got %v", logger.progress)
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/kubesphere/s2irun/pkg/api"
 	"github.com/kubesphere/s2irun/pkg/api/constants"
@@ -54,6 +55,10 @@ func GenerateLabelsFromSourceInfo(labels map[string]string, info *git.SourceInfo
 	addBuildLabel(labels, "commit.date", info.Date, namespace)
 	addBuildLabel(labels, "commit.id", info.CommitID, namespace)
 	addBuildLabel(labels, "commit.ref", info.Ref, namespace)
+	addBuildLabel(labels, "commit.refspec", info.Refspec, namespace)
+	if len(info.ParentIDs) > 1 {
+		addBuildLabel(labels, "commit.parents", strings.Join(info.ParentIDs, ","), namespace)
+	}
 	addBuildLabel(labels, "commit.message", info.Message, namespace)
 	//addBuildLabel(labels, "source-location", info.Location, namespace)
 	addBuildLabel(labels, "source-context-dir", info.ContextDir, namespace)
@@ -1,6 +1,8 @@
 package status
 
 import (
+	"context"
+
 	"github.com/kubesphere/s2irun/pkg/api"
 )
 
@@ -23,6 +25,20 @@ const (
 
 	ReasonMessagePushImageFailed api.StepFailureMessage = "Failed to push the final image."
 
+	// ReasonPushAdditionalTagsFailed is the reason associated with failing to
+	// push the image to some of its additional tags.
+	ReasonPushAdditionalTagsFailed api.StepFailureReason = "PushAdditionalTagsFailed"
+	// ReasonMessagePushAdditionalTagsFailed is the message associated with
+	// failing to push the image to some of its additional tags.
+	ReasonMessagePushAdditionalTagsFailed api.StepFailureMessage = "Failed to push the final image to some of its additional tags."
+
+	// ReasonInvalidTag is the reason associated with a tag template which does
+	// not expand to a valid tag.
+	ReasonInvalidTag api.StepFailureReason = "InvalidTag"
+	// ReasonMessageInvalidTag is the message associated with a tag template
+	// which does not expand to a valid tag.
+	ReasonMessageInvalidTag api.StepFailureMessage = "Failed to compute the tag of the image from its template."
+
 	// ReasonPullRuntimeImageFailed is the reason associated with failing to pull
 	// the runtime image.
 	ReasonPullRuntimeImageFailed api.StepFailureReason = "PullRuntimeImageFailed"
@@ -45,12 +61,29 @@ const (
 	// commit the container to the final image.
 	ReasonMessageCommitContainerFailed api.StepFailureMessage = "Failed to commit container."
 
+	// ReasonAssembleOCIImageFailed is the reason associated with failing to
+	// assemble the final image as OCI layers.
+	ReasonAssembleOCIImageFailed api.StepFailureReason = "AssembleOCIImageFailed"
+	// ReasonMessageAssembleOCIImageFailed is the message associated with failing
+	// to assemble the final image as OCI layers.
+	ReasonMessageAssembleOCIImageFailed api.StepFailureMessage = "Failed to assemble the OCI image."
+
+	// ReasonExportImageFailed is the reason associated with failing to save
+	// the final image to an archive.
+	ReasonExportImageFailed api.StepFailureReason = "ExportImageFailed"
+	// ReasonMessageExportImageFailed is the message associated with failing
+	// to save the final image to an archive.
+	ReasonMessageExportImageFailed api.StepFailureMessage = "Failed to export the image to an archive."
+
 	// ReasonFetchSourceFailed is the reason associated with failing to download
 	// the source of the build.
 	ReasonFetchSourceFailed api.StepFailureReason = "FetchSourceFailed"
 	// ReasonMessageFetchSourceFailed is the message associated with failing to download
 	// the source of the build.
 	ReasonMessageFetchSourceFailed api.StepFailureMessage = "Failed to fetch source for build."
+	// ReasonMessageFetchLFSObjectsFailed is the message associated with failing
+	// to pull the Git LFS objects of the source of the build.
+	ReasonMessageFetchLFSObjectsFailed api.StepFailureMessage = "Failed to fetch the Git LFS objects of the source for build."
 
 	// ReasonDockerImageBuildFailed is the reason associated with a failed
 	// Docker image build.
@@ -123,6 +156,20 @@ const (
 	// ReasonMessageAssembleUserForbidden is the failure reason associated with an image that
 	// uses a forbidden AssembleUser.
 	ReasonMessageAssembleUserForbidden api.StepFailureMessage = "Assemble user for S2I build is forbidden."
+
+	// ReasonBuildDeadlineExceeded is the reason associated with a build
+	// running longer than its deadline.
+	ReasonBuildDeadlineExceeded api.StepFailureReason = "BuildDeadlineExceeded"
+	// ReasonMessageBuildDeadlineExceeded is the message associated with a build
+	// running longer than its deadline.
+	ReasonMessageBuildDeadlineExceeded api.StepFailureMessage = "Build did not complete before its deadline."
+
+	// ReasonBuildCancelled is the reason associated with a build cancelled
+	// before it completed, such as on SIGTERM.
+	ReasonBuildCancelled api.StepFailureReason = "BuildCancelled"
+	// ReasonMessageBuildCancelled is the message associated with a build
+	// cancelled before it completed, such as on SIGTERM.
+	ReasonMessageBuildCancelled api.StepFailureMessage = "Build was cancelled."
 )
 
 // NewFailureReason initializes a new failure reason that contains both the
@@ -133,3 +180,16 @@ func NewFailureReason(reason api.StepFailureReason, message api.StepFailureMessa
 		Message: message,
 	}
 }
+
+// NewContextFailureReason returns the failure reason of a build aborted because
+// its context is done. It returns false if the context is not done.
+func NewContextFailureReason(ctx context.Context) (api.FailureReason, bool) {
+	switch ctx.Err() {
+	case nil:
+		return api.FailureReason{}, false
+	case context.DeadlineExceeded:
+		return NewFailureReason(ReasonBuildDeadlineExceeded, ReasonMessageBuildDeadlineExceeded), true
+	default:
+		return NewFailureReason(ReasonBuildCancelled, ReasonMessageBuildCancelled), true
+	}
+}
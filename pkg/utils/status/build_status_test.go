@@ -1,6 +1,7 @@
 package status
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -19,6 +20,26 @@ func TestNewFailureReason(t *testing.T) {
 	}
 }
 
+func TestNewContextFailureReason(t *testing.T) {
+	if _, ok := NewContextFailureReason(context.Background()); ok {
+		t.Errorf("Expected no failure reason for a context which is not done")
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	reason, ok := NewContextFailureReason(cancelled)
+	if !ok || reason.Reason != ReasonBuildCancelled {
+		t.Errorf("Expected reason to be: %s, got %s", ReasonBuildCancelled, reason.Reason)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	reason, ok = NewContextFailureReason(expired)
+	if !ok || reason.Reason != ReasonBuildDeadlineExceeded {
+		t.Errorf("Expected reason to be: %s, got %s", ReasonBuildDeadlineExceeded, reason.Reason)
+	}
+}
+
 func TestAddNewStage(t *testing.T) {
 	buildInfo := new(api.BuildInfo)
 
@@ -75,3 +96,18 @@ func TestUpdateStageDuration(t *testing.T) {
 	}
 
 }
+
+func TestMergeStages(t *testing.T) {
+	start := time.Now()
+	stages := api.RecordStageAndStepInfo(nil, api.StageFetchSource, api.StepDownloadSource, start, start.Add(time.Second))
+	other := api.RecordStageAndStepInfo(nil, api.StageFetchSource, api.StepApplyIgnoreRules, start.Add(time.Second), start.Add(2*time.Second))
+	other = api.RecordStageAndStepInfo(other, api.StageBuild, api.StepBuildDockerImage, start.Add(2*time.Second), start.Add(3*time.Second))
+
+	stages = api.MergeStageInfo(stages, other)
+	if len(stages) != 2 {
+		t.Fatalf("Stages should be 2 but was %v instead.", len(stages))
+	}
+	if len(stages[0].Steps) != 2 || stages[0].DurationMilliseconds != 2000 {
+		t.Errorf("Steps not merged in Stage, got %#v", stages[0])
+	}
+}
@@ -0,0 +1,44 @@
+// Package version provides the version information of the s2irun binary.
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+var (
+	// commitFromGit is the git commit s2irun was built from. It is set at
+	// build time through -ldflags.
+	commitFromGit string
+	// versionFromGit is the version s2irun was built from. It is set at build
+	// time through -ldflags.
+	versionFromGit = "unknown"
+	// buildDate is the date s2irun was built at, in ISO8601 format. It is set
+	// at build time through -ldflags.
+	buildDate string
+)
+
+// Info contains the versioning information.
+type Info struct {
+	GitVersion string `json:"gitVersion"`
+	GitCommit  string `json:"gitCommit"`
+	BuildDate  string `json:"buildDate"`
+	GoVersion  string `json:"goVersion"`
+	Platform   string `json:"platform"`
+}
+
+// Get returns the version information of the running binary.
+func Get() Info {
+	return Info{
+		GitVersion: versionFromGit,
+		GitCommit:  commitFromGit,
+		BuildDate:  buildDate,
+		GoVersion:  runtime.Version(),
+		Platform:   fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+	}
+}
+
+// String returns the git version of the binary.
+func (info Info) String() string {
+	return info.GitVersion
+}